@@ -19,7 +19,7 @@
       clankersOverlay = final: prev: {
         clankers = final.callPackage (
           { buildGoModule, lib }:
-          buildGoModule {
+          buildGoModule rec {
             pname = "clankers";
             version = "0.1.0";
             src = ./packages/cli;
@@ -28,6 +28,7 @@
             ldflags = [
               "-s"
               "-w"
+              "-X github.com/dxta-dev/clankers/internal/cli.Version=${version}"
             ];
 
             flags = [ "-trimpath" ];
@@ -133,7 +134,10 @@
               wantedBy = [ "multi-user.target" ];
 
               serviceConfig = {
-                Type = "simple";
+                # The daemon sends READY=1 once it is listening, and
+                # WATCHDOG=1 while it runs.
+                Type = "notify";
+                WatchdogSec = 30;
                 User = cfg.user;
                 Group = cfg.group;
                 ExecStart =
@@ -263,7 +267,7 @@
               GOARCH,
               suffix,
             }:
-            pkgs.buildGoModule {
+            pkgs.buildGoModule rec {
               pname = "clankers-${name}";
               version = "0.1.0";
               src = ./packages/cli;
@@ -272,6 +276,7 @@
               ldflags = [
                 "-s"
                 "-w"
+                "-X github.com/dxta-dev/clankers/internal/cli.Version=${version}"
               ];
 
               flags = [ "-trimpath" ];
@@ -315,7 +320,7 @@
         in
         daemonCrossPackages
         // {
-          clankers = pkgs.buildGoModule {
+          clankers = pkgs.buildGoModule rec {
             pname = "clankers";
             version = "0.1.0";
             src = ./packages/cli;
@@ -324,6 +329,7 @@
             ldflags = [
               "-s"
               "-w"
+              "-X github.com/dxta-dev/clankers/internal/cli.Version=${version}"
             ];
 
             flags = [ "-trimpath" ];
@@ -391,6 +397,9 @@
               runHook preCheck
               export HOME=$(mktemp -d)
               go test -v ./internal/config/... ./internal/paths/... ./internal/storage/...
+              # The storage package calls into the transpiled SQLite C code
+              # directly; -race turns on checkptr for those calls.
+              CGO_ENABLED=1 go test -race ./internal/storage/...
               runHook postCheck
             '';
 
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/dxta-dev/clankers/internal/config"
+	"github.com/dxta-dev/clankers/internal/formatters"
 	"github.com/spf13/cobra"
 )
 
@@ -157,7 +159,7 @@ func configProfilesCmd() *cobra.Command {
 
 // profilesListCmd returns the 'config profiles list' command
 func profilesListCmd() *cobra.Command {
-	var format string
+	var output outputFlags
 
 	cmd := &cobra.Command{
 		Use:   "list",
@@ -169,25 +171,14 @@ func profilesListCmd() *cobra.Command {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			switch format {
-			case "json":
-				type profileInfo struct {
-					Name   string `json:"name"`
-					Active bool   `json:"active"`
-				}
-				var profiles []profileInfo
-				for name := range cfg.Profiles {
-					profiles = append(profiles, profileInfo{
-						Name:   name,
-						Active: name == cfg.ActiveProfile,
-					})
-				}
-				encoder := json.NewEncoder(os.Stdout)
-				encoder.SetIndent("", "  ")
-				return encoder.Encode(profiles)
+			names := make([]string, 0, len(cfg.Profiles))
+			for name := range cfg.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
 
-			default:
-				for name := range cfg.Profiles {
+			if output.format == "text" {
+				for _, name := range names {
 					if name == cfg.ActiveProfile {
 						fmt.Printf("* %s (active)\n", name)
 					} else {
@@ -196,10 +187,18 @@ func profilesListCmd() *cobra.Command {
 				}
 				return nil
 			}
+
+			result := &formatters.ResultSet{
+				Columns: []formatters.Column{{Name: "name"}, {Name: "active"}},
+			}
+			for _, name := range names {
+				result.Rows = append(result.Rows, []any{name, name == cfg.ActiveProfile})
+			}
+			return output.print(result)
 		},
 	}
 
-	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json")
+	output.register(cmd, "text", "text")
 
 	return cmd
 }
@@ -2,20 +2,31 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/dxta-dev/clankers/internal/daemon"
+	"github.com/dxta-dev/clankers/internal/httpapi"
+	"github.com/dxta-dev/clankers/internal/ingest"
+	"github.com/dxta-dev/clankers/internal/journal"
 	"github.com/dxta-dev/clankers/internal/logging"
 	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/peercred"
 	"github.com/dxta-dev/clankers/internal/rpc"
 	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/dxta-dev/clankers/internal/systemd"
 	"github.com/sourcegraph/jsonrpc2"
 	"github.com/spf13/cobra"
 )
@@ -57,13 +68,41 @@ func (f *filteredJsonrpc2Logger) Printf(format string, v ...interface{}) {
 	}
 }
 
+// daemonOptions are the daemon flags. They are persistent so that
+// 'daemon start' and 'daemon restart' accept them and pass them on to the
+// detached process.
+type daemonOptions struct {
+	socketPath string
+	dataRoot   string
+	dbPath     string
+	logLevel   string
+	batchSize  int
+	batchDelay time.Duration
+	noJournal  bool
+	listen     string
+	http       string
+
+	shutdownTimeout time.Duration
+	allowUsers      []string
+	allowGroups     []string
+}
+
+// applyEnv exports the path overrides so paths.* resolve them here and in
+// any child process.
+func (o *daemonOptions) applyEnv() {
+	if o.dataRoot != "" {
+		os.Setenv("CLANKERS_DATA_PATH", o.dataRoot)
+	}
+	if o.dbPath != "" {
+		os.Setenv("CLANKERS_DB_PATH", o.dbPath)
+	}
+	if o.socketPath != "" {
+		os.Setenv("CLANKERS_SOCKET_PATH", o.socketPath)
+	}
+}
+
 func daemonCmd() *cobra.Command {
-	var (
-		socketPath string
-		dataRoot   string
-		dbPath     string
-		logLevel   string
-	)
+	var opts daemonOptions
 
 	cmd := &cobra.Command{
 		Use:   "daemon",
@@ -72,147 +111,520 @@ func daemonCmd() *cobra.Command {
 and stores session data to the local database.
 
 The daemon listens on a Unix socket (macOS/Linux) or TCP (Windows)
-and accepts JSON-RPC requests from editor plugins.`,
+and accepts JSON-RPC requests from editor plugins.
+
+With --listen tcp://127.0.0.1:7878 it also accepts connections over TCP,
+for plugins in containers or remote workspaces. Their requests must carry
+the token from the discovery file (daemon.json in the data directory),
+which is regenerated on every start.
+
+With --http 127.0.0.1:7878 it also serves a REST/JSON API, for tools that
+speak HTTP but not JSON-RPC: sessions, session detail, read-only SQL, stats
+and ingestion, described by GET /v1/openapi.json. Requests need the same
+token as "Authorization: Bearer <token>".
+
+Without a subcommand the daemon runs in the foreground. Use 'daemon start'
+to run it in the background. Only one daemon runs per data directory: a
+second one exits with an error instead of taking over the socket.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			log.SetOutput(&filteredLogWriter{w: os.Stderr})
+			return runDaemon(&opts)
+		},
+	}
 
-			if dataRoot != "" {
-				os.Setenv("CLANKERS_DATA_PATH", dataRoot)
-			}
-			if dbPath != "" {
-				os.Setenv("CLANKERS_DB_PATH", dbPath)
-			}
-			if socketPath == "" {
-				socketPath = paths.GetSocketPath()
-			}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(
+		&opts.socketPath,
+		"socket",
+		"",
+		"socket path (default: data root + dxta-clankers.sock)",
+	)
+	flags.StringVar(&opts.dataRoot, "data-root", "", "data root directory (overrides CLANKERS_DATA_PATH)")
+	flags.StringVar(&opts.dbPath, "db-path", "", "database file path (overrides CLANKERS_DB_PATH)")
+	flags.StringVar(&opts.logLevel, "log-level", "info", "log level: debug, info, warn, error")
+	flags.IntVar(&opts.batchSize, "batch-size", ingest.DefaultMaxBatch, "maximum writes per group-commit transaction")
+	flags.DurationVar(&opts.batchDelay, "batch-delay", ingest.DefaultMaxDelay, "how long to wait for more writes before committing")
+	flags.BoolVar(&opts.noJournal, "no-journal", false, "do not record accepted writes in the event journal")
+	flags.StringVar(&opts.listen, "listen", "", "also accept token-authenticated connections on tcp://host:port")
+	flags.StringVar(&opts.http, "http", "", "also serve the token-authenticated HTTP API on host:port")
+	flags.StringSliceVar(&opts.allowUsers, "allow-user", nil, "also let these users (names or uids) report sessions over the socket; reads, status and shutdown stay with the daemon's user")
+	flags.StringSliceVar(&opts.allowGroups, "allow-group", nil, "like --allow-user, for processes whose primary group is one of these (names or gids)")
+	flags.DurationVar(&opts.shutdownTimeout, "shutdown-timeout", 10*time.Second, "how long shutdown waits for in-flight requests before closing connections")
 
-			// Initialize structured logger
-			logger, err := logging.New(logLevel, paths.GetLogDir())
-			if err != nil {
-				// Fall back to stderr logging on error
-				log.Printf("failed to initialize logger: %v", err)
-				log.Printf("falling back to stderr logging only")
+	cmd.AddCommand(daemonStartCmd(&opts))
+	cmd.AddCommand(daemonStopCmd(&opts))
+	cmd.AddCommand(daemonRestartCmd(&opts))
+	cmd.AddCommand(daemonStatusCmd(&opts))
+
+	return cmd
+}
+
+// runDaemon runs the daemon in the foreground until SIGINT, SIGTERM or a
+// shutdown request.
+func runDaemon(opts *daemonOptions) error {
+	log.SetOutput(&filteredLogWriter{w: os.Stderr})
+
+	opts.applyEnv()
+	socketPath := paths.GetSocketPath()
+
+	policy, err := peercred.ParsePolicy(opts.allowUsers, opts.allowGroups)
+	if err != nil {
+		return err
+	}
+
+	// Taken before anything touches the socket, so a second daemon fails
+	// here instead of unlinking the first one's socket.
+	lock, err := daemon.Acquire(paths.GetDataDir())
+	if err != nil {
+		if errors.Is(err, daemon.ErrAlreadyRunning) {
+			return fmt.Errorf("%w; stop it with 'clankers daemon stop'", err)
+		}
+		return fmt.Errorf("failed to take daemon lock: %w", err)
+	}
+	defer lock.Release()
+
+	// Set once the daemon has created the socket itself. Sockets passed by
+	// systemd belong to the socket unit and are left alone.
+	ownSocket := false
+	defer func() {
+		// Runs after the database is closed; the lock is still held, so
+		// this is our socket.
+		if ownSocket {
+			os.Remove(socketPath)
+		}
+	}()
+
+	// Initialize structured logger
+	logger, err := logging.New(opts.logLevel, paths.GetLogDir())
+	if err != nil {
+		// Fall back to stderr logging on error
+		log.Printf("failed to initialize logger: %v", err)
+		log.Printf("falling back to stderr logging only")
+	} else {
+		defer logger.Close()
+		logger.Infof("daemon", "daemon starting with log level %s (pid %d)", opts.logLevel, os.Getpid())
+	}
+
+	// Start cleanup job for old log files
+	cleanupStop := logging.StartCleanupJob(paths.GetLogDir())
+	defer close(cleanupStop)
+
+	resolvedDbPath := paths.GetDbPath()
+	created, err := storage.EnsureDb(resolvedDbPath)
+	if err != nil {
+		return fmt.Errorf("failed to ensure database: %w", err)
+	}
+	if created {
+		if logger != nil {
+			logger.Infof("daemon", "created database at %s", resolvedDbPath)
+		} else {
+			log.Printf("created database at %s", resolvedDbPath)
+		}
+	}
+
+	store, err := storage.Open(resolvedDbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer closeStore(store, logger)
+
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return fmt.Errorf("failed to use socket from systemd: %w", err)
+	}
+
+	var listener net.Listener
+	switch {
+	case len(activated) > 0:
+		listener = activated[0]
+		for _, extra := range activated[1:] {
+			extra.Close()
+		}
+		if logger != nil {
+			logger.Infof("daemon", "listening on %s (socket activated)", listener.Addr())
+		} else {
+			log.Printf("listening on %s (socket activated)", listener.Addr())
+		}
+	case runtime.GOOS == "windows":
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		if logger != nil {
+			logger.Infof("daemon", "listening on %s", listener.Addr())
+		} else {
+			log.Printf("listening on %s", listener.Addr())
+		}
+	default:
+		os.Remove(socketPath)
+		listener, err = net.Listen("unix", socketPath)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+		}
+		ownSocket = true
+		// Not left to the umask. Other users allowed by the policy need
+		// to open the socket; admitPeer still checks each of them.
+		mode := os.FileMode(0600)
+		if policy.Shared() {
+			mode = 0666
+		}
+		if err := os.Chmod(socketPath, mode); err != nil {
+			return fmt.Errorf("failed to set permissions on %s: %w", socketPath, err)
+		}
+		if logger != nil {
+			logger.Infof("daemon", "listening on %s", socketPath)
+		} else {
+			log.Printf("listening on %s", socketPath)
+		}
+	}
+
+	var tcpListener net.Listener
+	if opts.listen != "" {
+		address, err := parseListenAddress(opts.listen)
+		if err != nil {
+			return err
+		}
+		if tcpListener, err = listenTCP(address, logger); err != nil {
+			return err
+		}
+	}
+	var httpListener net.Listener
+	if opts.http != "" {
+		if httpListener, err = listenTCP(opts.http, logger); err != nil {
+			return fmt.Errorf("--http: %w", err)
+		}
+	}
+
+	var token string
+	if tcpListener != nil || httpListener != nil {
+		token, err = rpc.GenerateToken()
+		if err != nil {
+			return fmt.Errorf("failed to generate token: %w", err)
+		}
+		// Rewritten on every start with a fresh token, and removed on exit.
+		discovery := &daemon.Discovery{Token: token, PID: os.Getpid()}
+		if tcpListener != nil {
+			discovery.Address = tcpListener.Addr().String()
+		}
+		if httpListener != nil {
+			discovery.HTTPAddress = httpListener.Addr().String()
+		}
+		discoveryPath := paths.GetDiscoveryPath()
+		if err := daemon.WriteDiscovery(discoveryPath, discovery); err != nil {
+			return fmt.Errorf("failed to write %s: %w", discoveryPath, err)
+		}
+		defer os.Remove(discoveryPath)
+		if tcpListener != nil {
+			if logger != nil {
+				logger.Infof("daemon", "listening on tcp://%s (token in %s)", tcpListener.Addr(), discoveryPath)
 			} else {
-				defer logger.Close()
-				logger.Infof("daemon", "daemon starting with log level %s", logLevel)
+				log.Printf("listening on tcp://%s (token in %s)", tcpListener.Addr(), discoveryPath)
 			}
+		}
+		if httpListener != nil {
+			if logger != nil {
+				logger.Infof("daemon", "serving HTTP on http://%s (token in %s)", httpListener.Addr(), discoveryPath)
+			} else {
+				log.Printf("serving HTTP on http://%s (token in %s)", httpListener.Addr(), discoveryPath)
+			}
+		}
+	}
 
-			// Start cleanup job for old log files
-			cleanupStop := logging.StartCleanupJob(paths.GetLogDir())
-			defer close(cleanupStop)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-			resolvedDbPath := paths.GetDbPath()
-			created, err := storage.EnsureDb(resolvedDbPath)
-			if err != nil {
-				return fmt.Errorf("failed to ensure database: %w", err)
-			}
-			if created {
+	var events *journal.Journal
+	if !opts.noJournal {
+		events, err = journal.Open(paths.GetJournalDir())
+		if err != nil {
+			return fmt.Errorf("failed to open event journal: %w", err)
+		}
+		defer events.Close()
+	}
+
+	// Closed before the store (defers run in reverse), so queued
+	// writes are committed on shutdown.
+	writes := ingest.NewQueue(store, logger, ingest.Options{
+		MaxBatch: opts.batchSize,
+		MaxDelay: opts.batchDelay,
+	})
+	defer writes.Close()
+
+	rpc.Version = Version
+	handler := rpc.NewHandler(store, writes, events, logger)
+
+	var httpServer *http.Server
+	if httpListener != nil {
+		httpServer = &http.Server{
+			Handler:           httpapi.New(handler, token, logger),
+			ReadHeaderTimeout: 10 * time.Second,
+			ErrorLog:          log.New(&filteredLogWriter{w: os.Stderr}, "", log.LstdFlags),
+		}
+		go func() {
+			if err := httpServer.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				if logger != nil {
-					logger.Infof("daemon", "created database at %s", resolvedDbPath)
+					logger.Errorf("daemon", "HTTP server stopped: %v", err)
 				} else {
-					log.Printf("created database at %s", resolvedDbPath)
+					log.Printf("HTTP server stopped: %v", err)
 				}
 			}
+		}()
+	}
 
-			store, err := storage.Open(resolvedDbPath)
-			if err != nil {
-				return fmt.Errorf("failed to open database: %w", err)
-			}
-			defer store.Close()
+	stopping := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigCh:
+		case <-handler.ShutdownRequested():
+		}
+		if logger != nil {
+			logger.Infof("daemon", "shutting down...")
+		} else {
+			log.Println("shutting down...")
+		}
+		systemd.Notify(systemd.Stopping)
+		close(stopping)
+		listener.Close()
+		if tcpListener != nil {
+			tcpListener.Close()
+		}
+	}()
 
-			if runtime.GOOS != "windows" {
-				os.Remove(socketPath)
-			}
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		go watchdog(interval/2, stopping)
+	}
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		if logger != nil {
+			logger.Warnf("daemon", "failed to notify systemd: %v", err)
+		} else {
+			log.Printf("failed to notify systemd: %v", err)
+		}
+	}
 
-			var listener net.Listener
-			if runtime.GOOS == "windows" {
-				listener, err = net.Listen("tcp", "127.0.0.1:0")
-				if err != nil {
-					return fmt.Errorf("failed to listen: %w", err)
-				}
-				if logger != nil {
-					logger.Infof("daemon", "listening on %s", listener.Addr())
-				} else {
-					log.Printf("listening on %s", listener.Addr())
-				}
-			} else {
-				listener, err = net.Listen("unix", socketPath)
-				if err != nil {
-					return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
-				}
-				if logger != nil {
-					logger.Infof("daemon", "listening on %s", socketPath)
-				} else {
-					log.Printf("listening on %s", socketPath)
+	var conns sync.WaitGroup
+	// accept serves one listener until shutdown. token is empty for the
+	// Unix socket and required on the TCP listener.
+	accept := func(listener net.Listener, token string) {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				select {
+				case <-stopping:
+					return
+				default:
+					if logger != nil {
+						logger.Warnf("daemon", "accept error: %v", err)
+					} else {
+						log.Printf("accept error: %v", err)
+					}
+					continue
 				}
 			}
 
-			ctx, cancel := context.WithCancel(context.Background())
-			defer cancel()
-
-			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			conns.Add(1)
 			go func() {
-				<-sigCh
-				if logger != nil {
-					logger.Infof("daemon", "shutting down...")
+				defer conns.Done()
+				var connHandler jsonrpc2.Handler = handler
+				if token != "" {
+					connHandler = handler.RequireToken(token, conn.RemoteAddr().String())
 				} else {
-					log.Println("shutting down...")
+					cred, ok := admitPeer(conn, policy, logger)
+					if !ok {
+						conn.Close()
+						return
+					}
+					if cred != nil && !cred.Owner() {
+						connHandler = handler.RestrictPeer(cred.String())
+					}
 				}
-				cancel()
-				listener.Close()
+				serveConn(ctx, conn, handler, connHandler, logger)
 			}()
+		}
+	}
 
-			handler := rpc.NewHandler(store, logger)
-			for {
-				conn, err := listener.Accept()
-				if err != nil {
-					select {
-					case <-ctx.Done():
-						return nil
-					default:
-						if logger != nil {
-							logger.Warnf("daemon", "accept error: %v", err)
-						} else {
-							log.Printf("accept error: %v", err)
-						}
-						continue
-					}
-				}
+	tcpDone := make(chan struct{})
+	if tcpListener != nil {
+		go func() {
+			defer close(tcpDone)
+			accept(tcpListener, token)
+		}()
+	} else {
+		close(tcpDone)
+	}
+	accept(listener, "")
+	<-tcpDone
 
-				go serveConn(ctx, conn, handler, logger)
+	shutdownDaemon(handler, httpServer, cancel, &conns, opts.shutdownTimeout, logger)
+	return nil
+}
+
+// admitPeer applies the peer credential policy to a socket connection,
+// before any request reaches the handler, and returns the peer's
+// credentials. Where the platform cannot report them, the socket's file
+// mode is the only check and the credentials are nil.
+func admitPeer(conn net.Conn, policy *peercred.Policy, logger *logging.Logger) (*peercred.Cred, bool) {
+	cred, err := peercred.Get(conn)
+	if errors.Is(err, peercred.ErrUnsupported) {
+		return nil, true
+	}
+	if err != nil {
+		if logger != nil {
+			logger.Warnf("daemon", "rejected connection: failed to read peer credentials: %v", err)
+		} else {
+			log.Printf("rejected connection: failed to read peer credentials: %v", err)
+		}
+		return nil, false
+	}
+	if policy.Allow(cred) {
+		return cred, true
+	}
+
+	if logger != nil {
+		logger.Warnf("daemon", "rejected connection from %s: not allowed by policy", cred)
+	} else {
+		log.Printf("rejected connection from %s: not allowed by policy", cred)
+	}
+	return nil, false
+}
+
+// parseListenAddress returns the host:port of a --listen address, given as
+// tcp://host:port.
+func parseListenAddress(listen string) (string, error) {
+	u, err := url.Parse(listen)
+	if err != nil || u.Scheme != "tcp" || u.Port() == "" || (u.Path != "" && u.Path != "/") {
+		return "", fmt.Errorf("invalid --listen address %q: expected tcp://host:port", listen)
+	}
+	return u.Host, nil
+}
+
+// listenTCP opens a --listen or --http address, given as host:port. Port 0
+// picks a free port; the discovery file has the one chosen.
+func listenTCP(address string, logger *logging.Logger) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: expected host:port", address)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		if logger != nil {
+			logger.Warnf("daemon", "%s is reachable beyond this machine; requests still need the token", address)
+		} else {
+			log.Printf("%s is reachable beyond this machine; requests still need the token", address)
+		}
+	}
+	return listener, nil
+}
+
+// shutdownDaemon runs once the listener is closed: it lets in-flight
+// requests reply and closes every connection, within timeout. HTTP requests
+// finish first, since they need the handler to answer. The deferred
+// calls in runDaemon then commit queued writes, close the journal,
+// checkpoint and close the database, remove the socket and release the
+// lock, in that order.
+func shutdownDaemon(handler *rpc.Handler, httpServer *http.Server, cancel context.CancelFunc, conns *sync.WaitGroup, timeout time.Duration, logger *logging.Logger) {
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+	defer cancelTimeout()
+
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			if logger != nil {
+				logger.Warnf("daemon", "HTTP requests still running after %s, closing anyway", timeout)
+			} else {
+				log.Printf("HTTP requests still running after %s, closing anyway", timeout)
 			}
-		},
+			httpServer.Close()
+		}
 	}
 
-	cmd.Flags().StringVar(
-		&socketPath,
-		"socket",
-		"",
-		"socket path (default: data root + dxta-clankers.sock)",
-	)
-	cmd.Flags().StringVar(&dataRoot, "data-root", "", "data root directory (overrides CLANKERS_DATA_PATH)")
-	cmd.Flags().StringVar(&dbPath, "db-path", "", "database file path (overrides CLANKERS_DB_PATH)")
-	cmd.Flags().StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn, error")
+	if err := handler.Drain(ctx); err != nil {
+		if logger != nil {
+			logger.Warnf("daemon", "shutdown timeout reached: %v", err)
+		} else {
+			log.Printf("shutdown timeout reached: %v", err)
+		}
+	}
 
-	return cmd
+	// Also closes connections accepted too late for Drain to see them.
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if logger != nil {
+			logger.Warnf("daemon", "connections still open after %s, closing anyway", timeout)
+		} else {
+			log.Printf("connections still open after %s, closing anyway", timeout)
+		}
+	}
+}
+
+// watchdog pings systemd until the daemon starts stopping. The accept loop
+// and the write queue run in their own goroutines, so this only proves the
+// process is scheduled; a wedged daemon is still caught by stop timeouts.
+func watchdog(every time.Duration, stopping <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			systemd.Notify(systemd.Watchdog)
+		case <-stopping:
+			return
+		}
+	}
 }
 
-func serveConn(ctx context.Context, conn net.Conn, handler *rpc.Handler, logger *logging.Logger) {
+// closeStore checkpoints the WAL before closing, so committed data does not
+// live only in the -wal file after the daemon exits. A sleep or power cut
+// right after shutdown then cannot leave the WAL half-applied.
+func closeStore(store *storage.Store, logger *logging.Logger) {
+	if err := store.Checkpoint(); err != nil {
+		if logger != nil {
+			logger.Warnf("daemon", "failed to checkpoint WAL: %v", err)
+		} else {
+			log.Printf("failed to checkpoint WAL: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		if logger != nil {
+			logger.Warnf("daemon", "failed to close database: %v", err)
+		} else {
+			log.Printf("failed to close database: %v", err)
+		}
+	}
+}
+
+// serveConn serves one connection, passing its requests to connHandler:
+// handler itself, or a wrapper that requires a token or restricts a peer.
+func serveConn(ctx context.Context, conn net.Conn, handler *rpc.Handler, connHandler jsonrpc2.Handler, logger *logging.Logger) {
 	defer conn.Close()
 
 	stream := jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{})
+	// handler replies itself; wrapping it in jsonrpc2.HandlerWithError
+	// would send a second, empty reply to every request.
 	rpcConn := jsonrpc2.NewConn(
 		ctx,
 		stream,
-		jsonrpc2.HandlerWithError(
-			func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (interface{}, error) {
-				handler.Handle(ctx, conn, req)
-				return nil, nil
-			},
-		),
+		connHandler,
 		jsonrpc2.SetLogger(&filteredJsonrpc2Logger{logger: logger}),
 	)
+	handler.Connect(rpcConn)
+	defer handler.Disconnect(rpcConn)
 
-	<-rpcConn.DisconnectNotify()
+	select {
+	case <-rpcConn.DisconnectNotify():
+	case <-ctx.Done():
+		rpcConn.Close()
+	}
 }
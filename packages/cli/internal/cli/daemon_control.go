@@ -0,0 +1,279 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/daemon"
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/spf13/cobra"
+)
+
+// daemonOutputFile receives the detached daemon's stdout and stderr, which
+// catches panics and errors from before the structured logger is up.
+const daemonOutputFile = "daemon.out"
+
+// daemonFlagNames are the persistent daemon flags 'daemon start' forwards
+// to the detached process.
+var daemonFlagNames = []string{
+	"socket", "data-root", "db-path", "log-level", "batch-size", "batch-delay",
+	"no-journal", "listen", "http", "shutdown-timeout", "allow-user", "allow-group",
+}
+
+const pollInterval = 50 * time.Millisecond
+
+func daemonStartCmd(opts *daemonOptions) *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start the daemon in the background",
+		Long: `Start the daemon as a detached process and wait until it answers on its
+socket. Its stdout and stderr are appended to daemon.out in the log
+directory. Daemon flags given here are passed on to it.
+
+Examples:
+  clankers daemon start
+  clankers daemon start --log-level debug`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pid, err := startDaemon(cmd, opts, timeout)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("daemon started (pid %d)\n", pid)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "how long to wait for the daemon to become ready")
+
+	return cmd
+}
+
+func daemonStopCmd(opts *daemonOptions) *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the running daemon",
+		Long: `Ask the running daemon to shut down and wait for it to exit. The daemon
+commits queued writes before exiting. If it does not answer on its socket,
+it is sent SIGTERM instead.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pid, err := stopDaemon(opts, timeout)
+			if err != nil {
+				return err
+			}
+			if pid == 0 {
+				fmt.Println("daemon is not running")
+				return nil
+			}
+			fmt.Printf("daemon stopped (pid %d)\n", pid)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "how long to wait for the daemon to exit")
+
+	return cmd
+}
+
+func daemonRestartCmd(opts *daemonOptions) *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Stop the daemon if it is running, then start it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := stopDaemon(opts, timeout); err != nil {
+				return err
+			}
+			pid, err := startDaemon(cmd, opts, timeout)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("daemon restarted (pid %d)\n", pid)
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "how long to wait for the daemon to stop and to start")
+
+	return cmd
+}
+
+func daemonStatusCmd(opts *daemonOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Report whether the daemon is running",
+		Long: `Report whether a daemon holds the lock for this data directory and
+whether it answers on its socket. Exits non-zero when it is not running.
+See 'clankers status' for what a running daemon is doing.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.applyEnv()
+
+			pid, err := daemon.Running(paths.GetDataDir())
+			if err != nil {
+				return err
+			}
+			if pid == 0 {
+				return rpc.ErrNotRunning
+			}
+
+			socketPath := paths.GetSocketPath()
+			health, err := pingDaemon(socketPath)
+			if err != nil {
+				return fmt.Errorf("daemon is running (pid %d) but not answering on %s: %w", pid, socketPath, err)
+			}
+			fmt.Printf("daemon is running (pid %d, version %s, socket %s)\n", pid, health.Version, socketPath)
+			return nil
+		},
+	}
+}
+
+// startDaemon launches 'clankers daemon' detached with the daemon flags set
+// on cmd, and returns its pid once it answers health.
+func startDaemon(cmd *cobra.Command, opts *daemonOptions, timeout time.Duration) (int, error) {
+	opts.applyEnv()
+
+	dataDir := paths.GetDataDir()
+	if pid, err := daemon.Running(dataDir); err != nil {
+		return 0, err
+	} else if pid != 0 {
+		return 0, fmt.Errorf("daemon is already running (pid %d)", pid)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find clankers executable: %w", err)
+	}
+
+	args := []string{"daemon"}
+	for _, name := range daemonFlagNames {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || !flag.Changed {
+			continue
+		}
+		// String() of a list flag is "[a,b]", which would not parse back.
+		if list, ok := flag.Value.(interface{ GetSlice() []string }); ok {
+			for _, v := range list.GetSlice() {
+				args = append(args, "--"+name+"="+v)
+			}
+			continue
+		}
+		args = append(args, "--"+name+"="+flag.Value.String())
+	}
+
+	logDir := paths.GetLogDir()
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	outputPath := filepath.Join(logDir, daemonOutputFile)
+	output, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", outputPath, err)
+	}
+	defer output.Close()
+
+	child := exec.Command(exe, args...)
+	child.Stdout = output
+	child.Stderr = output
+	child.SysProcAttr = daemon.DetachedAttr()
+	if err := child.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start daemon: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- child.Wait() }()
+
+	socketPath := paths.GetSocketPath()
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("daemon exited during startup (%v); see %s", err, outputPath)
+		case <-time.After(pollInterval):
+		}
+
+		if _, err := pingDaemon(socketPath); err == nil {
+			return child.Process.Pid, nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("daemon (pid %d) did not become ready within %s; see %s", child.Process.Pid, timeout, outputPath)
+		}
+	}
+}
+
+// stopDaemon asks the daemon to shut down over RPC, falling back to a
+// signal, and waits for it to release its lock. It returns the pid that was
+// stopped, or 0 if no daemon was running.
+func stopDaemon(opts *daemonOptions, timeout time.Duration) (int, error) {
+	opts.applyEnv()
+
+	dataDir := paths.GetDataDir()
+	pid, err := daemon.Running(dataDir)
+	if err != nil || pid == 0 {
+		return 0, err
+	}
+
+	if err := requestShutdown(paths.GetSocketPath()); err != nil {
+		if err := daemon.Terminate(pid); err != nil {
+			return 0, fmt.Errorf("failed to signal daemon (pid %d): %w", pid, err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		running, err := daemon.Running(dataDir)
+		if err != nil {
+			return 0, err
+		}
+		if running != pid {
+			return pid, nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("daemon (pid %d) did not stop within %s", pid, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func requestShutdown(socketPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := rpc.Dial(ctx, socketPath, cliClient())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var result rpc.OkResult
+	return client.Call(ctx, "shutdown", client.Envelope(), &result)
+}
+
+func pingDaemon(socketPath string) (*rpc.HealthResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := rpc.Dial(ctx, socketPath, cliClient())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var health rpc.HealthResult
+	if err := client.Call(ctx, "health", client.Envelope(), &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
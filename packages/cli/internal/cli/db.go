@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// dbCmd returns the db command group
+func dbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the local database",
+		Long:  "Inspect and maintain the local clankers database.",
+	}
+
+	cmd.AddCommand(dbMigrateCmd())
+
+	return cmd
+}
+
+// dbMigrateCmd returns the 'db migrate' command
+func dbMigrateCmd() *cobra.Command {
+	var (
+		target int
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending schema migrations",
+		Long: `Apply pending schema migrations to the local database.
+
+A backup copy of the database is written next to it before any migration
+is applied. The daemon also applies pending migrations on startup.
+
+Examples:
+  clankers db migrate
+  clankers db migrate --dry-run
+  clankers db migrate --to 1`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dbPath := paths.GetDbPath()
+			if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+				return fmt.Errorf("database not found at %s (start the daemon to create it)", dbPath)
+			}
+
+			result, err := storage.Migrate(dbPath, storage.MigrateOptions{
+				Target: target,
+				DryRun: dryRun,
+				Backup: true,
+			})
+			if err != nil {
+				return fmt.Errorf("migration failed: %w", err)
+			}
+
+			fmt.Printf("Database: %s\n", dbPath)
+			fmt.Printf("Current schema version: %d (latest: %d)\n", result.FromVersion, storage.LatestSchemaVersion())
+
+			if len(result.Pending) == 0 {
+				fmt.Println("Schema is up to date.")
+				return nil
+			}
+
+			if dryRun {
+				fmt.Printf("\n%d pending migration(s):\n", len(result.Pending))
+				for _, m := range result.Pending {
+					fmt.Printf("\n-- %03d: %s\n", m.Version, m.Description)
+					fmt.Println(strings.TrimSpace(m.Up))
+				}
+				fmt.Println("\nDry run: no changes were made.")
+				return nil
+			}
+
+			if result.BackupPath != "" {
+				fmt.Printf("Backup written to %s\n", result.BackupPath)
+			}
+			for _, m := range result.Pending {
+				fmt.Printf("Applied %03d: %s\n", m.Version, m.Description)
+			}
+			fmt.Printf("Schema version is now %d.\n", result.ToVersion)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&target, "to", 0, "target schema version (default: latest)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show pending migrations without applying them")
+
+	return cmd
+}
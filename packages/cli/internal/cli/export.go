@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dxta-dev/clankers/internal/export"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd returns the export command group
+func exportCmd() *cobra.Command {
+	var (
+		all        bool
+		since      string
+		outputPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export session data",
+		Long: `Export sessions as shareable documents, or the whole database as a
+portable archive.
+
+With --all, every session and its messages, tools, errors and compaction
+events are written as JSON Lines. The archive is gzip-compressed when the
+output file ends in .gz. Load it on another machine with 'clankers import'.
+
+Examples:
+  clankers export --all -o archive.jsonl.gz
+  clankers export --all --since 2025-01-01 -o recent.jsonl.gz
+  clankers export session ses_abc123 --format html -o incident.html`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all {
+				return fmt.Errorf("use --all to export the whole database, or 'clankers export session <id>' for one session")
+			}
+			var sinceMs int64
+			if since != "" {
+				var err error
+				if sinceMs, err = parseSince(since); err != nil {
+					return err
+				}
+			}
+			if outputPath == "" && isTerminal(os.Stdout) {
+				return fmt.Errorf("refusing to write an archive to a terminal; use -o <file>")
+			}
+
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			var counts export.TableCounts
+			err = writeOutput(outputPath, func(w io.Writer) error {
+				if !strings.HasSuffix(outputPath, ".gz") {
+					counts, err = export.WriteArchive(w, r, sinceMs)
+				} else {
+					gz := gzip.NewWriter(w)
+					if counts, err = export.WriteArchive(gz, r, sinceMs); err == nil {
+						err = gz.Close()
+					}
+				}
+				if err != nil {
+					return fmt.Errorf("failed to export archive: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			parts := make([]string, 0, len(storage.Tables))
+			for _, table := range storage.Tables {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[table], table))
+			}
+			fmt.Fprintf(os.Stderr, "Exported %s\n", strings.Join(parts, ", "))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "export every session as a JSONL archive")
+	cmd.Flags().StringVar(&since, "since", "", "only sessions created on or after this date (YYYY-MM-DD) or duration ago (7d, 24h)")
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "write to a file instead of stdout (.gz compresses)")
+
+	cmd.AddCommand(exportSessionCmd())
+
+	return cmd
+}
+
+// exportSessionCmd returns the 'export session' command
+func exportSessionCmd() *cobra.Command {
+	var (
+		format     string
+		outputPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "session <id>",
+		Short: "Export one session as Markdown, HTML or JSON",
+		Long: `Export a session as a self-contained document.
+
+Formats:
+  md    Markdown transcript with a metadata header; tool calls are
+        collapsible <details> blocks (renders on GitHub and GitLab)
+  html  Single HTML page with inline styles and collapsible tool calls
+  json  Versioned bundle with the session row and all of its messages,
+        tools, session_errors and compaction_events rows
+
+Examples:
+  clankers export session ses_abc123 > transcript.md
+  clankers export session ses_abc123 --format html -o incident.html
+  clankers export session ses_abc123 --format json -o ses_abc123.json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			return writeOutput(outputPath, func(w io.Writer) error {
+				if err := export.WriteSession(w, r, args[0], export.Format(format)); err != nil {
+					return fmt.Errorf("failed to export session: %w", err)
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", string(export.FormatMarkdown), "Output format: md, html, json")
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "write to a file instead of stdout")
+
+	return cmd
+}
+
+// writeOutput calls write with stdout, or with a new file at path. The file
+// is removed again if write fails, so no partial export is left behind.
+func writeOutput(path string, write func(io.Writer) error) error {
+	if path == "" || path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dxta-dev/clankers/internal/export"
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// importCmd returns the import command
+func importCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <archive>",
+		Short: "Import a database archive",
+		Long: `Import an archive written by 'clankers export --all'.
+
+Rows are merged with the same rules the daemon uses, so importing the same
+archive twice changes nothing and existing non-empty fields are kept. Rows
+older than the stored copy are counted as stale and do not overwrite it.
+
+When the daemon is running, rows are sent to it in batches, so they are
+journaled and reach subscribers like any other write. Each batch commits on
+its own, and rows the daemon rejects are skipped and reported. Otherwise the
+whole archive is applied directly in one transaction, and the database is
+created if it does not exist. Use - to read from stdin.
+
+Examples:
+  clankers import archive.jsonl.gz
+  ssh old-laptop clankers export --all | clankers import -`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var input io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open archive: %w", err)
+				}
+				defer f.Close()
+				input = f
+			}
+
+			dbPath := paths.GetDbPath()
+			client := rpc.ClientInfo{Name: "clankers import", Version: Version}
+			var stats export.ImportStats
+			var err error
+			if daemonClient := dialDaemon(dbPath, client); daemonClient != nil {
+				defer daemonClient.Close()
+				stats, err = importThroughDaemon(input, daemonClient)
+			} else {
+				stats, err = importDirect(input, dbPath, storage.Client(client))
+			}
+			if stats == nil {
+				return fmt.Errorf("failed to import archive: %w", err)
+			}
+
+			fmt.Printf("%-18s %9s %9s %9s %9s\n", "TABLE", "INSERTED", "UPDATED", "SKIPPED", "STALE")
+			for _, table := range storage.Tables {
+				counts := stats[table]
+				fmt.Printf("%-18s %9d %9d %9d %9d\n", table,
+					counts[storage.ChangeInserted], counts[storage.ChangeUpdated],
+					counts[storage.ChangeSkipped], counts[storage.ChangeStale])
+			}
+			return err
+		},
+	}
+
+	return cmd
+}
+
+// importDirect applies the archive in one transaction on a database opened
+// by this process. It refuses while a daemon owns the database.
+func importDirect(input io.Reader, dbPath string, client storage.Client) (export.ImportStats, error) {
+	if err := checkNoDaemon(); err != nil {
+		return nil, err
+	}
+	if _, err := storage.EnsureDb(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to prepare database: %w", err)
+	}
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer store.Close()
+
+	return export.ImportArchive(input, store, client)
+}
+
+// importThroughDaemon sends the archive to the daemon in ingestBatch calls
+// of at most rpc.MaxIngestBatchItems rows. Rows the daemon rejects are
+// skipped like in any batch; once the archive is sent, they are reported in
+// the error alongside the stats for the rows that applied.
+func importThroughDaemon(input io.Reader, client *rpc.Client) (export.ImportStats, error) {
+	stats := export.NewImportStats()
+	var items []rpc.IngestItem
+	var tables []string
+	failed := 0
+	var firstFailure string
+
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		var result rpc.IngestBatchResult
+		params := rpc.IngestBatchParams{RequestEnvelope: client.Envelope(), Items: items}
+		if err := client.Call(context.Background(), "ingestBatch", params, &result); err != nil {
+			return daemonError(err)
+		}
+		for i, r := range result.Results {
+			if r.Error != nil {
+				if failed == 0 {
+					firstFailure = fmt.Sprintf("%s row: %s", tables[i], r.Error.Message)
+				}
+				failed++
+				continue
+			}
+			stats[tables[i]][r.Change]++
+		}
+		items, tables = items[:0], tables[:0]
+		return nil
+	}
+
+	err := export.ReadArchive(input, func(table string, row any) error {
+		item, err := ingestItem(row)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+		tables = append(tables, table)
+		if len(items) < rpc.MaxIngestBatchItems {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if failed > 0 {
+		return stats, fmt.Errorf("the daemon rejected %d rows (first: %s)", failed, firstFailure)
+	}
+	return stats, nil
+}
+
+// ingestItem wraps an archive row as an ingestBatch item.
+func ingestItem(row any) (rpc.IngestItem, error) {
+	switch row := row.(type) {
+	case *storage.Session:
+		return rpc.IngestItem{Kind: rpc.KindSession, Session: row}, nil
+	case *storage.Message:
+		return rpc.IngestItem{Kind: rpc.KindMessage, Message: row}, nil
+	case *storage.Tool:
+		return rpc.IngestItem{Kind: rpc.KindTool, Tool: row}, nil
+	case *storage.SessionError:
+		return rpc.IngestItem{Kind: rpc.KindSessionError, SessionError: row}, nil
+	case *storage.CompactionEvent:
+		return rpc.IngestItem{Kind: rpc.KindCompactionEvent, CompactionEvent: row}, nil
+	default:
+		return rpc.IngestItem{}, fmt.Errorf("unsupported row %T", row)
+	}
+}
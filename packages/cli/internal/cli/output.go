@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dxta-dev/clankers/internal/formatters"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// outputFlags holds the --format, --no-header and --max-width flags shared by
+// commands that print rows.
+type outputFlags struct {
+	format   string
+	noHeader bool
+	maxWidth int
+}
+
+// register adds the output flags to cmd. extraFormats are command-specific
+// formats (such as "text") handled by the command itself.
+func (o *outputFlags) register(cmd *cobra.Command, defaultFormat string, extraFormats ...string) {
+	formats := extraFormats
+	for _, f := range formatters.SupportedFormats {
+		formats = append(formats, string(f))
+	}
+
+	cmd.Flags().StringVarP(&o.format, "format", "f", defaultFormat, fmt.Sprintf("Output format (%s)", strings.Join(formats, ", ")))
+	cmd.Flags().BoolVar(&o.noHeader, "no-header", false, "omit the header row (table, csv, tsv)")
+	cmd.Flags().IntVar(&o.maxWidth, "max-width", formatters.DefaultMaxWidth, "truncate table cells wider than this (0 disables truncation)")
+}
+
+func (o *outputFlags) formatter() (formatters.Formatter, error) {
+	opts := formatters.Options{MaxWidth: o.maxWidth, NoHeader: o.noHeader}
+	// --max-width 0 means no limit, which formatters.Options spells as -1.
+	if o.maxWidth <= 0 {
+		opts.MaxWidth = -1
+	}
+	return formatters.NewFormatter(formatters.FormatType(o.format), opts)
+}
+
+// print formats result and writes it to stdout.
+func (o *outputFlags) print(result *formatters.ResultSet) error {
+	formatter, err := o.formatter()
+	if err != nil {
+		return err
+	}
+
+	output, err := formatter.Format(result)
+	if err != nil {
+		return fmt.Errorf("failed to format results: %w", err)
+	}
+
+	fmt.Print(output)
+	return nil
+}
+
+// toResultSet converts a storage query result into the formatter model.
+func toResultSet(result *storage.QueryResult) *formatters.ResultSet {
+	columns := make([]formatters.Column, len(result.Columns))
+	for i, col := range result.Columns {
+		columns[i] = formatters.Column{Name: col.Name, Type: col.DeclType}
+	}
+	return &formatters.ResultSet{Columns: columns, Rows: result.Rows}
+}
@@ -1,94 +1,121 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/dxta-dev/clankers/internal/formatters"
-	"github.com/dxta-dev/clankers/internal/paths"
 	"github.com/dxta-dev/clankers/internal/storage"
 	"github.com/spf13/cobra"
 )
 
 func queryCmd() *cobra.Command {
-	var format string
+	var (
+		output      outputFlags
+		interactive bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "query <SQL>",
 		Short: "Query session data using SQL",
 		Long: `Execute read-only SQL queries against the Clankers database.
 
-Only SELECT queries are allowed. Write operations (INSERT, UPDATE, DELETE,
-DROP, CREATE, ALTER, etc.) are blocked for safety.
+Queries run on a read-only database connection, one statement at a time.
+When the daemon is running they run inside it; otherwise the database is
+opened read-only.
+Any statement that would modify the database (INSERT, UPDATE, DELETE,
+DROP, CREATE, ALTER, ATTACH, etc.) is rejected by SQLite before it runs.
+Read-only pragmas such as PRAGMA table_info(sessions) are allowed.
 
 Examples:
   clankers query "SELECT * FROM sessions LIMIT 10"
   clankers query "SELECT id, title FROM sessions WHERE project_name = 'my-app'"
   clankers query "SELECT * FROM messages WHERE session_id = 'abc123'"
   clankers query "SELECT * FROM sessions" --format json
+  clankers query "SELECT model, SUM(cost) FROM sessions GROUP BY model" -f csv
+  clankers query "SELECT id, title FROM sessions" -f markdown
+  clankers query "PRAGMA table_info(tools)"
+  clankers query --interactive
+
+Use --interactive (or 'clankers shell') for a SQL prompt with history,
+multi-line statements and tab completion.
 
 Tables:
   sessions  - AI chat sessions
   messages  - Individual messages within sessions
 `,
-		Args: cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			sql := strings.TrimSpace(args[0])
-
-			// Get database path
-			dbPath := paths.GetDbPath()
-			store, err := storage.Open(dbPath)
-			if err != nil {
-				return fmt.Errorf("failed to open database: %w", err)
+		Args: func(cmd *cobra.Command, args []string) error {
+			if interactive {
+				return cobra.NoArgs(cmd, args)
 			}
-			defer store.Close()
-
-			// Execute query
-			results, err := store.ExecuteQuery(sql)
-			if err != nil {
-				// Provide helpful error messages
-				if strings.Contains(err.Error(), "no such column") {
-					return formatColumnError(err, sql, store)
-				}
-				if strings.Contains(err.Error(), "no such table") {
-					return formatTableError(err)
-				}
-				if strings.Contains(err.Error(), "syntax error") {
-					return formatSyntaxError(err, sql)
-				}
-				return fmt.Errorf("query failed: %w", err)
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var sql string
+			if len(args) > 0 {
+				sql = strings.TrimSpace(args[0])
 			}
 
-			// Format and output results
-			formatter, err := formatters.NewFormatter(formatters.FormatType(format))
+			r, err := openReader()
 			if err != nil {
 				return err
 			}
+			defer r.Close()
 
-			// Convert QueryResult slice to map slice
-			rows := make([]map[string]interface{}, len(results))
-			for i, r := range results {
-				rows[i] = map[string]interface{}(r)
+			if interactive {
+				return runShell(r, output)
 			}
 
-			output, err := formatter.Format(rows)
+			results, err := r.Query(sql)
 			if err != nil {
-				return fmt.Errorf("failed to format results: %w", err)
+				return queryError(err, sql, r)
 			}
 
-			fmt.Print(output)
+			if err := output.print(toResultSet(results)); err != nil {
+				return err
+			}
+			warnTruncated(results)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&format, "format", "f", "table", "Output format (table, json)")
+	cmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "start an interactive SQL shell")
+	output.register(cmd, string(formatters.FormatTable))
 
 	return cmd
 }
 
+// warnTruncated tells the user on stderr when the daemon cut the result
+// short.
+func warnTruncated(results *storage.QueryResult) {
+	if results.Truncated {
+		fmt.Fprintf(os.Stderr, "(only the first %d rows are shown; the daemon limits query results)\n", len(results.Rows))
+	}
+}
+
+// queryError turns an ExecuteQuery error into a user-facing one, printing
+// hints to stderr for common mistakes.
+func queryError(err error, sql string, r reader) error {
+	if errors.Is(err, storage.ErrWriteNotAllowed) {
+		return err
+	}
+	// Provide helpful error messages
+	if strings.Contains(err.Error(), "no such column") {
+		return formatColumnError(err, sql, r)
+	}
+	if strings.Contains(err.Error(), "no such table") {
+		return formatTableError(err)
+	}
+	if strings.Contains(err.Error(), "syntax error") {
+		return formatSyntaxError(err, sql)
+	}
+	return fmt.Errorf("query failed: %w", err)
+}
+
 // formatColumnError provides a user-friendly error for missing columns
-func formatColumnError(err error, sql string, store *storage.Store) error {
+func formatColumnError(err error, sql string, r reader) error {
 	// Extract column name from error
 	errStr := err.Error()
 	var colName string
@@ -109,7 +136,7 @@ func formatColumnError(err error, sql string, store *storage.Store) error {
 	fmt.Fprintf(os.Stderr, "Error: Column '%s' not found\n\n", colName)
 
 	if tableName != "" {
-		columns, _ := store.GetTableSchema(tableName)
+		columns, _ := r.TableColumns(tableName)
 		if len(columns) > 0 {
 			fmt.Fprintf(os.Stderr, "Available columns in '%s':\n", tableName)
 			for _, col := range columns {
@@ -117,7 +144,7 @@ func formatColumnError(err error, sql string, store *storage.Store) error {
 			}
 
 			// Suggest similar columns
-			suggestions, _ := store.SuggestColumnNames(tableName, colName)
+			suggestions := storage.MatchColumnNames(columns, colName)
 			if len(suggestions) > 0 {
 				fmt.Fprintf(os.Stderr, "\nDid you mean:\n")
 				for _, sug := range suggestions {
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/daemon"
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// reader is what read commands need from the database. A running daemon
+// serves it, so the database has a single owner; otherwise the database is
+// opened read-only.
+type reader interface {
+	Query(sql string) (*storage.QueryResult, error)
+	TableNames() ([]string, error)
+	TableColumns(table string) ([]string, error)
+	SchemaSQL(table string) ([]string, error)
+	ListSessions(filter storage.SessionFilter) (*storage.SessionPage, error)
+	GetTranscript(id string) (*storage.Transcript, error)
+	GetHistory(sessionID string) ([]storage.HistoryEntry, error)
+	Search(terms string, opts storage.SearchOptions) ([]storage.SearchHit, error)
+	Close() error
+}
+
+// openReader asks the daemon when it is running and serves the database
+// this command would open, and opens the database read-only otherwise.
+func openReader() (reader, error) {
+	dbPath := paths.GetDbPath()
+	if r := dialReader(dbPath); r != nil {
+		return r, nil
+	}
+	store, err := openReadOnly(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return storeReader{store}, nil
+}
+
+// openReadOnly opens the database without a writer, for commands that read
+// it directly.
+func openReadOnly(dbPath string) (*storage.Store, error) {
+	store, err := storage.OpenReadOnly(dbPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("database not found at %s (start the daemon to create it)", dbPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return store, nil
+}
+
+// openWritable opens the database with a writer, for commands that write
+// to it outside the daemon. It refuses while a daemon holds the data
+// directory, since the daemon owns the database and its writer would be
+// locked out.
+func openWritable(dbPath string) (*storage.Store, error) {
+	if err := checkNoDaemon(); err != nil {
+		return nil, err
+	}
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return store, nil
+}
+
+// checkNoDaemon fails when a daemon holds the lock in the data directory.
+func checkNoDaemon() error {
+	pid, err := daemon.Running(paths.GetDataDir())
+	if err != nil {
+		return fmt.Errorf("failed to check for a running daemon: %w", err)
+	}
+	if pid != 0 {
+		return fmt.Errorf("the daemon (pid %d) owns the database; stop it first with 'clankers daemon stop'", pid)
+	}
+	return nil
+}
+
+// dialReader returns nil when no daemon answers, or when it serves another
+// database, e.g. because CLANKERS_DB_PATH points elsewhere.
+func dialReader(dbPath string) reader {
+	client := dialDaemon(dbPath, cliClient())
+	if client == nil {
+		return nil
+	}
+	return daemonReader{client}
+}
+
+// dialDaemon connects to the daemon as info. It returns nil when no daemon
+// answers, or when it serves a database other than dbPath.
+func dialDaemon(dbPath string, info rpc.ClientInfo) *rpc.Client {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client, err := rpc.Dial(ctx, paths.GetSocketPath(), info)
+	if err != nil {
+		return nil
+	}
+
+	var result rpc.GetDbPathResult
+	if err := client.Call(ctx, "getDbPath", client.Envelope(), &result); err != nil || !samePath(result.DbPath, dbPath) {
+		client.Close()
+		return nil
+	}
+	return client
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// storeReader reads a database opened by this process.
+type storeReader struct {
+	*storage.Store
+}
+
+func (r storeReader) Query(sql string) (*storage.QueryResult, error) {
+	return r.ExecuteQuery(context.Background(), sql, 0)
+}
+
+func (r storeReader) TableNames() ([]string, error) {
+	return r.GetTableNames()
+}
+
+func (r storeReader) TableColumns(table string) ([]string, error) {
+	return r.GetTableSchema(table)
+}
+
+func (r storeReader) SchemaSQL(table string) ([]string, error) {
+	return r.GetSchemaSQL(table)
+}
+
+// daemonReader reads through the daemon's read methods.
+type daemonReader struct {
+	client *rpc.Client
+}
+
+func (r daemonReader) call(method string, params, result any) error {
+	return daemonError(r.client.Call(context.Background(), method, params, result))
+}
+
+func (r daemonReader) Query(sql string) (*storage.QueryResult, error) {
+	// QueryResult decodes INTEGER and REAL values to the types a direct
+	// query returns.
+	var result storage.QueryResult
+	if err := r.call("query", rpc.QueryParams{RequestEnvelope: r.client.Envelope(), SQL: sql}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// The schema methods mirror the storage.Store methods of the same purpose
+// with the query method, which takes no arguments, so names are quoted into
+// the SQL.
+
+func (r daemonReader) TableNames() ([]string, error) {
+	return r.column(`SELECT name FROM pragma_table_list
+		WHERE schema = 'main' AND type IN ('table', 'view', 'virtual') AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+}
+
+func (r daemonReader) TableColumns(table string) ([]string, error) {
+	return r.column(fmt.Sprintf("SELECT name FROM pragma_table_info(%s)", sqlLiteral(table)))
+}
+
+func (r daemonReader) SchemaSQL(table string) ([]string, error) {
+	return r.column(fmt.Sprintf(`SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL
+			AND name NOT LIKE 'sqlite_%%'
+			AND tbl_name NOT IN (SELECT name FROM pragma_table_list WHERE type = 'shadow')
+			AND (%[1]s = '' OR tbl_name = %[1]s COLLATE NOCASE)
+		ORDER BY tbl_name, type != 'table', name`, sqlLiteral(table)))
+}
+
+// column returns the first column of every row of sql.
+func (r daemonReader) column(sql string) ([]string, error) {
+	result, err := r.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if value, ok := row[0].(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+func sqlLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (r daemonReader) ListSessions(filter storage.SessionFilter) (*storage.SessionPage, error) {
+	var page storage.SessionPage
+	err := r.call("listSessions", rpc.ListSessionsParams{RequestEnvelope: r.client.Envelope(), Filter: filter}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (r daemonReader) GetTranscript(id string) (*storage.Transcript, error) {
+	var transcript storage.Transcript
+	err := r.call("getSession", rpc.GetSessionParams{RequestEnvelope: r.client.Envelope(), ID: id}, &transcript)
+	if err != nil {
+		return nil, err
+	}
+	return &transcript, nil
+}
+
+func (r daemonReader) GetHistory(sessionID string) ([]storage.HistoryEntry, error) {
+	var raw json.RawMessage
+	err := r.call("getHistory", rpc.GetHistoryParams{RequestEnvelope: r.client.Envelope(), SessionID: sessionID}, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep integer column values as written instead of float64.
+	var result rpc.GetHistoryResult
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.History, nil
+}
+
+func (r daemonReader) Search(terms string, opts storage.SearchOptions) ([]storage.SearchHit, error) {
+	var result rpc.SearchResult
+	err := r.call("search", rpc.SearchParams{RequestEnvelope: r.client.Envelope(), Terms: terms, Options: opts}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Hits, nil
+}
+
+func (r daemonReader) Close() error {
+	return r.client.Close()
+}
+
+// daemonError turns a read method's error back into the storage error a
+// direct read would have returned, so callers handle both the same way.
+func daemonError(err error) error {
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	switch rpcErr.Code {
+	case rpc.CodeWriteNotAllowed:
+		return fmt.Errorf("%w%s", storage.ErrWriteNotAllowed, strings.TrimPrefix(rpcErr.Message, storage.ErrWriteNotAllowed.Error()))
+	case rpc.CodeNotFound:
+		return fmt.Errorf("%w%s", storage.ErrSessionNotFound, strings.TrimPrefix(rpcErr.Message, storage.ErrSessionNotFound.Error()))
+	}
+	return errors.New(rpcErr.Message)
+}
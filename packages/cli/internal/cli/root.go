@@ -29,8 +29,19 @@ and configure sync settings.
 
 Usage:
   clankers daemon          Run the background daemon
+  clankers daemon start    Start the daemon in the background (also stop, restart, status)
+  clankers status          Show daemon status and connected clients
+  clankers tail            Stream a live feed of agent activity
+  clankers service         Install systemd units that start the daemon on demand
   clankers config          Manage configuration
   clankers query           Query session data
+  clankers shell           Interactive SQL shell
+  clankers search          Full-text search across sessions
+  clankers sessions        List sessions and show transcripts
+  clankers export          Export sessions as Markdown, HTML or JSON
+  clankers import          Import a database archive
+  clankers replay          Rebuild a database from the event journal
+  clankers db              Manage the local database
   clankers sync            Sync operations
 `,
 		SilenceUsage: true,
@@ -49,9 +60,19 @@ Usage:
 
 	// Add subcommands
 	root.AddCommand(daemonCmd())
+	root.AddCommand(statusCmd())
+	root.AddCommand(tailCmd())
+	root.AddCommand(serviceCmd())
 	root.AddCommand(configCmd())
 	// TODO: Add sync command in Phase 4
 	root.AddCommand(queryCmd())
+	root.AddCommand(shellCmd())
+	root.AddCommand(searchCmd())
+	root.AddCommand(sessionsCmd())
+	root.AddCommand(exportCmd())
+	root.AddCommand(importCmd())
+	root.AddCommand(replayCmd())
+	root.AddCommand(dbCmd())
 	// root.AddCommand(syncCmd())
 
 	return root
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/formatters"
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+func searchCmd() *cobra.Command {
+	var (
+		project string
+		source  string
+		since   string
+		limit   int
+		raw     bool
+		reindex bool
+		output  outputFlags
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search <terms>",
+		Short: "Full-text search over messages and tool calls",
+		Long: `Search message text and tool input/output across all sessions.
+
+Results are ranked by relevance (best first). Every term must match; use
+--raw to pass SQLite FTS5 query syntax (OR, NEAR, prefix*) through as-is.
+
+Examples:
+  clankers search "migration bug"
+  clankers search "EnsureDb" --project clankers --since 7d
+  clankers search "auth* OR token" --raw --format json
+  clankers search "rate limit" -f csv > hits.csv`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !reindex {
+				return fmt.Errorf("search terms are required")
+			}
+
+			opts := storage.SearchOptions{
+				Project: project,
+				Source:  source,
+				Limit:   limit,
+				Raw:     raw,
+			}
+			if since != "" {
+				ts, err := parseSince(since)
+				if err != nil {
+					return err
+				}
+				opts.Since = ts
+			}
+
+			// Only a rebuild writes, so it opens the database itself;
+			// searching goes through the reader.
+			if reindex {
+				if err := rebuildSearchIndex(); err != nil {
+					return err
+				}
+				fmt.Fprintln(os.Stderr, "Search index rebuilt.")
+				if len(args) == 0 {
+					return nil
+				}
+			}
+
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			hits, err := r.Search(args[0], opts)
+			if err != nil {
+				if strings.Contains(err.Error(), "fts5") {
+					return fmt.Errorf("invalid search query: %w", err)
+				}
+				return fmt.Errorf("search failed: %w", err)
+			}
+
+			if output.format == "text" {
+				printSearchHits(hits)
+				return nil
+			}
+			return output.print(searchResultSet(hits))
+		},
+	}
+
+	cmd.Flags().StringVar(&project, "project", "", "only match sessions in this project (name or path)")
+	cmd.Flags().StringVar(&source, "source", "", "only match sessions from this source (e.g. opencode, claude-code)")
+	cmd.Flags().StringVar(&since, "since", "", "only match entries newer than a date (2006-01-02) or age (24h, 7d)")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "maximum number of hits (0 for no limit)")
+	cmd.Flags().BoolVar(&raw, "raw", false, "treat terms as FTS5 query syntax")
+	cmd.Flags().BoolVar(&reindex, "reindex", false, "rebuild the search index before searching")
+	output.register(cmd, "text", "text")
+
+	return cmd
+}
+
+func rebuildSearchIndex() error {
+	store, err := openWritable(paths.GetDbPath())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.RebuildSearchIndex(); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	return nil
+}
+
+func printSearchHits(hits []storage.SearchHit) {
+	if len(hits) == 0 {
+		fmt.Println("(no results)")
+		return
+	}
+
+	highlight := isTerminal(os.Stdout)
+	for i, hit := range hits {
+		title := "Untitled Session"
+		if hit.SessionTitle != nil && *hit.SessionTitle != "" {
+			title = *hit.SessionTitle
+		}
+
+		var meta []string
+		if hit.ProjectName != nil && *hit.ProjectName != "" {
+			meta = append(meta, *hit.ProjectName)
+		}
+		if hit.Source != nil && *hit.Source != "" {
+			meta = append(meta, *hit.Source)
+		}
+		if hit.CreatedAt != nil {
+			meta = append(meta, time.UnixMilli(*hit.CreatedAt).Format("2006-01-02 15:04"))
+		}
+
+		fmt.Printf("%d. %s [%s]", i+1, title, hit.Role)
+		if len(meta) > 0 {
+			fmt.Printf(" (%s)", strings.Join(meta, " · "))
+		}
+		fmt.Println()
+		fmt.Printf("   session: %s\n", hit.SessionID)
+
+		snippet := highlightSnippet(strings.Join(strings.Fields(hit.Snippet), " "), highlight)
+		fmt.Printf("   %s\n\n", snippet)
+	}
+}
+
+func searchResultSet(hits []storage.SearchHit) *formatters.ResultSet {
+	result := &formatters.ResultSet{
+		Columns: []formatters.Column{
+			{Name: "kind"},
+			{Name: "id"},
+			{Name: "session_id"},
+			{Name: "session_title"},
+			{Name: "project_name"},
+			{Name: "source"},
+			{Name: "role"},
+			{Name: "snippet"},
+			{Name: "rank", Type: "REAL"},
+			{Name: "created_at", Type: "INTEGER"},
+		},
+	}
+	for _, hit := range hits {
+		result.Rows = append(result.Rows, []any{
+			hit.Kind,
+			hit.ID,
+			hit.SessionID,
+			nullable(hit.SessionTitle),
+			nullable(hit.ProjectName),
+			nullable(hit.Source),
+			hit.Role,
+			highlightSnippet(hit.Snippet, false),
+			hit.Rank,
+			nullable(hit.CreatedAt),
+		})
+	}
+	return result
+}
+
+// nullable dereferences optional storage fields so formatters see NULL
+// instead of a pointer.
+func nullable[T any](v *T) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// highlightSnippet swaps the storage highlight markers for ANSI bold, or
+// drops them when bold is false.
+func highlightSnippet(snippet string, bold bool) string {
+	on, off := "", ""
+	if bold {
+		on, off = "\x1b[1m", "\x1b[0m"
+	}
+	return strings.NewReplacer(storage.SearchHighlightStart, on, storage.SearchHighlightEnd, off).Replace(snippet)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// parseSince accepts an absolute date (2006-01-02 or RFC 3339) or a relative
+// age such as 90m, 24h or 7d, and returns unix milliseconds.
+func parseSince(value string) (int64, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), nil
+	}
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days >= 0 {
+			return time.Now().AddDate(0, 0, -days).UnixMilli(), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d).UnixMilli(), nil
+	}
+	return 0, fmt.Errorf("invalid date %q (use 2006-01-02, RFC 3339, or an age like 24h or 7d)", value)
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/daemon"
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/systemd"
+	"github.com/spf13/cobra"
+)
+
+// serviceEnv are the path overrides baked into the service unit when set at
+// install time, so the daemon resolves the same paths as the shell that
+// installed it.
+var serviceEnv = []string{
+	"CLANKERS_DATA_PATH",
+	"CLANKERS_DB_PATH",
+	"CLANKERS_SOCKET_PATH",
+	"CLANKERS_LOG_PATH",
+	"CLANKERS_JOURNAL_PATH",
+}
+
+// serviceCmd returns the service command
+func serviceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Run the daemon as a systemd user service",
+	}
+
+	cmd.AddCommand(serviceInstallCmd())
+
+	return cmd
+}
+
+func serviceInstallCmd() *cobra.Command {
+	var (
+		user      bool
+		force     bool
+		printOnly bool
+		binary    string
+		timeout   time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install --user [-- daemon flags]",
+		Short: "Write systemd units that start the daemon on demand",
+		Long: `Write clankers.socket and clankers.service to the systemd user unit
+directory. With the socket enabled, systemd listens on the daemon socket
+from login and starts the daemon on the first plugin connection, so the
+daemon no longer has to be started by hand.
+
+Path overrides (CLANKERS_DATA_PATH, CLANKERS_DB_PATH, ...) set in the
+current environment are written into the service. Flags after -- are
+passed to 'clankers daemon'.
+
+Examples:
+  clankers service install --user
+  clankers service install --user -- --log-level debug
+  systemctl --user daemon-reload
+  systemctl --user enable --now clankers.socket`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !user {
+				return errors.New("only user units are supported; pass --user")
+			}
+			if runtime.GOOS != "linux" {
+				return fmt.Errorf("systemd units are not supported on %s", runtime.GOOS)
+			}
+
+			if binary == "" {
+				exe, err := os.Executable()
+				if err != nil {
+					return fmt.Errorf("failed to find clankers executable: %w", err)
+				}
+				binary = exe
+			}
+
+			opts := systemd.UnitOptions{
+				Command:    append([]string{binary, "daemon"}, args...),
+				SocketPath: paths.GetSocketPath(),
+				// systemd kills the daemon if it has not drained by then.
+				StopTimeout: timeout,
+				Watchdog:    30 * time.Second,
+			}
+			for _, name := range serviceEnv {
+				if v := os.Getenv(name); v != "" {
+					opts.Environment = append(opts.Environment, name+"="+v)
+				}
+			}
+
+			units := []struct {
+				name    string
+				content string
+			}{
+				{systemd.SocketUnitName, systemd.SocketUnit(opts)},
+				{systemd.ServiceUnitName, systemd.ServiceUnit(opts)},
+			}
+
+			if printOnly {
+				for _, unit := range units {
+					fmt.Printf("# %s\n%s\n", unit.name, unit.content)
+				}
+				return nil
+			}
+
+			dir, err := systemd.UserUnitDir()
+			if err != nil {
+				return fmt.Errorf("failed to find systemd user directory: %w", err)
+			}
+			if !force {
+				for _, unit := range units {
+					path := filepath.Join(dir, unit.name)
+					if _, err := os.Stat(path); err == nil {
+						return fmt.Errorf("%s already exists; pass --force to overwrite it", path)
+					}
+				}
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", dir, err)
+			}
+			for _, unit := range units {
+				path := filepath.Join(dir, unit.name)
+				if err := os.WriteFile(path, []byte(unit.content), 0644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", path, err)
+				}
+				fmt.Printf("wrote %s\n", path)
+			}
+
+			fmt.Println()
+			if pid, _ := daemon.Running(paths.GetDataDir()); pid != 0 {
+				fmt.Printf("A daemon is running (pid %d). Stop it first so systemd can take the socket:\n", pid)
+				fmt.Println("  clankers daemon stop")
+			}
+			fmt.Println("Enable with:")
+			fmt.Println("  systemctl --user daemon-reload")
+			fmt.Printf("  systemctl --user enable --now %s\n", systemd.SocketUnitName)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&user, "user", false, "install user units (required)")
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite existing units")
+	cmd.Flags().BoolVar(&printOnly, "print", false, "print the units instead of writing them")
+	cmd.Flags().StringVar(&binary, "binary", "", "clankers executable for ExecStart (default: this executable)")
+	cmd.Flags().DurationVar(&timeout, "stop-timeout", 30*time.Second, "TimeoutStopSec for the service")
+
+	return cmd
+}
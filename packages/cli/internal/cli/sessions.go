@@ -0,0 +1,488 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/formatters"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// transcriptPreviewLength caps tool input/output in transcripts unless --full
+// is given.
+const transcriptPreviewLength = 300
+
+// sessionsCmd returns the sessions command group
+func sessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Browse recorded sessions",
+		Long:  "List sessions and read their transcripts without writing SQL.",
+	}
+
+	cmd.AddCommand(sessionsListCmd())
+	cmd.AddCommand(sessionsShowCmd())
+	cmd.AddCommand(sessionsHistoryCmd())
+
+	return cmd
+}
+
+// sessionsListCmd returns the 'sessions list' command
+func sessionsListCmd() *cobra.Command {
+	var (
+		filter    storage.SessionFilter
+		sortBy    string
+		since     string
+		until     string
+		ascending bool
+		output    outputFlags
+	)
+
+	sorts := make([]string, len(storage.SessionSorts))
+	for i, s := range storage.SessionSorts {
+		sorts[i] = string(s)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List sessions",
+		Long: `List sessions, newest first, with optional filters.
+
+Results are paginated. When more sessions are available, the cursor for the
+next page is printed to stderr; pass it back with --cursor.
+
+Examples:
+  clankers sessions list
+  clankers sessions list --project clankers --since 7d
+  clankers sessions list --source claude-code --model sonnet --status completed
+  clankers sessions list --sort cost -n 10
+  clankers sessions list --since 2026-01-01 --until 2026-02-01 -f csv
+  clankers sessions list --cursor eyJzIjoiY3JlYXRlZCIs...`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter.Sort = storage.SessionSort(sortBy)
+			filter.Ascending = ascending
+			if since != "" {
+				ts, err := parseSince(since)
+				if err != nil {
+					return err
+				}
+				filter.Since = ts
+			}
+			if until != "" {
+				ts, err := parseSince(until)
+				if err != nil {
+					return err
+				}
+				filter.Until = ts
+			}
+
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			page, err := r.ListSessions(filter)
+			if err != nil {
+				return fmt.Errorf("failed to list sessions: %w", err)
+			}
+
+			humanTimes := output.format == string(formatters.FormatTable)
+			if err := output.print(sessionsResultSet(page.Sessions, humanTimes)); err != nil {
+				return err
+			}
+
+			if page.NextCursor != "" {
+				fmt.Fprintf(os.Stderr, "\nMore sessions available. Next page:\n  --cursor %s\n", page.NextCursor)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&filter.Project, "project", "", "only sessions in this project (name or path)")
+	cmd.Flags().StringVar(&filter.Source, "source", "", "only sessions from this source (e.g. opencode, claude-code)")
+	cmd.Flags().StringVar(&filter.Model, "model", "", "only sessions using this model")
+	cmd.Flags().StringVar(&filter.Status, "status", "", "only sessions with this status")
+	cmd.Flags().StringVar(&since, "since", "", "only sessions started at or after a date (2006-01-02) or age (24h, 7d)")
+	cmd.Flags().StringVar(&until, "until", "", "only sessions started before a date (2006-01-02) or age (24h, 7d)")
+	cmd.Flags().StringVar(&sortBy, "sort", string(storage.SortCreated), fmt.Sprintf("sort key (%s)", strings.Join(sorts, ", ")))
+	cmd.Flags().BoolVar(&ascending, "asc", false, "sort ascending instead of descending")
+	cmd.Flags().IntVarP(&filter.Limit, "limit", "n", 20, "sessions per page (0 for all)")
+	cmd.Flags().StringVar(&filter.Cursor, "cursor", "", "continue from a previous page")
+	output.register(cmd, string(formatters.FormatTable))
+
+	return cmd
+}
+
+func sessionsResultSet(sessions []storage.Session, humanTimes bool) *formatters.ResultSet {
+	result := &formatters.ResultSet{
+		Columns: []formatters.Column{
+			{Name: "id"},
+			{Name: "title"},
+			{Name: "project"},
+			{Name: "source"},
+			{Name: "model"},
+			{Name: "status"},
+			{Name: "messages", Type: "INTEGER"},
+			{Name: "tools", Type: "INTEGER"},
+			{Name: "tokens", Type: "INTEGER"},
+			{Name: "cost", Type: "REAL"},
+			{Name: "created_at", Type: "INTEGER"},
+		},
+	}
+
+	for _, s := range sessions {
+		var tokens any
+		if s.PromptTokens != nil || s.CompletionTokens != nil {
+			tokens = valueOrZero(s.PromptTokens) + valueOrZero(s.CompletionTokens)
+		}
+		createdAt := nullable(s.CreatedAt)
+		if humanTimes && s.CreatedAt != nil {
+			createdAt = formatTimestamp(*s.CreatedAt)
+		}
+
+		result.Rows = append(result.Rows, []any{
+			s.ID,
+			nullable(s.Title),
+			nullable(s.ProjectName),
+			nullable(s.Source),
+			nullable(s.Model),
+			nullable(s.Status),
+			nullable(s.MessageCount),
+			nullable(s.ToolCallCount),
+			tokens,
+			nullable(s.Cost),
+			createdAt,
+		})
+	}
+
+	return result
+}
+
+// sessionsShowCmd returns the 'sessions show' command
+func sessionsShowCmd() *cobra.Command {
+	var (
+		format string
+		full   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a session transcript",
+		Long: `Show a session's details and a time-ordered transcript of its messages,
+tool calls, errors and context compactions.
+
+Tool input and output are shortened unless --full is given.
+
+Examples:
+  clankers sessions show ses_abc123
+  clankers sessions show ses_abc123 --full | less
+  clankers sessions show ses_abc123 --format json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			transcript, err := r.GetTranscript(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to load session: %w", err)
+			}
+
+			switch format {
+			case "json":
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(transcript)
+
+			case "text":
+				printTranscript(os.Stdout, transcript, full)
+				return nil
+
+			default:
+				return fmt.Errorf("unknown format: %s (supported: text, json)", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json")
+	cmd.Flags().BoolVar(&full, "full", false, "show complete tool input and output")
+
+	return cmd
+}
+
+// sessionsHistoryCmd returns the 'sessions history' command
+func sessionsHistoryCmd() *cobra.Command {
+	var output outputFlags
+
+	cmd := &cobra.Command{
+		Use:   "history <id>",
+		Short: "Show recorded changes to a session",
+		Long: `Show every recorded write that changed a session, its messages or its
+tool calls, oldest first, with one row per changed column and the client
+that sent it.
+
+Writes that left a row unchanged are not recorded. Long text values are
+stored shortened.
+
+Examples:
+  clankers sessions history ses_abc123
+  clankers sessions history ses_abc123 -f json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			history, err := r.GetHistory(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to load history: %w", err)
+			}
+			if len(history) == 0 {
+				return fmt.Errorf("no history recorded for session %s", args[0])
+			}
+
+			humanTimes := output.format == string(formatters.FormatTable)
+			return output.print(historyResultSet(history, humanTimes))
+		},
+	}
+
+	output.register(cmd, string(formatters.FormatTable))
+
+	return cmd
+}
+
+func historyResultSet(history []storage.HistoryEntry, humanTimes bool) *formatters.ResultSet {
+	result := &formatters.ResultSet{
+		Columns: []formatters.Column{
+			{Name: "changed_at", Type: "INTEGER"},
+			{Name: "table"},
+			{Name: "row"},
+			{Name: "op"},
+			{Name: "column"},
+			{Name: "old"},
+			{Name: "new"},
+			{Name: "client"},
+		},
+	}
+
+	for _, entry := range history {
+		var changedAt any = entry.ChangedAt
+		if humanTimes {
+			changedAt = time.UnixMilli(entry.ChangedAt).Format("2006-01-02 15:04:05")
+		}
+		client := strings.TrimSpace(entry.Client.Name + " " + entry.Client.Version)
+
+		for _, change := range entry.Changes {
+			result.Rows = append(result.Rows, []any{
+				changedAt,
+				entry.Table,
+				entry.RowID,
+				entry.Operation,
+				change.Column,
+				historyCell(change.Old),
+				historyCell(change.New),
+				client,
+			})
+		}
+	}
+
+	return result
+}
+
+// historyCell renders a recorded value; NULL stays nil so formatters show
+// it as NULL.
+func historyCell(v any) any {
+	if v == nil {
+		return nil
+	}
+	return fmt.Sprint(v)
+}
+
+func printTranscript(w io.Writer, t *storage.Transcript, full bool) {
+	s := t.Session
+
+	title := "Untitled Session"
+	if s.Title != nil && *s.Title != "" {
+		title = *s.Title
+	}
+	fmt.Fprintf(w, "%s\n", title)
+	fmt.Fprintf(w, "%s\n", strings.Repeat("=", displayLen(title)))
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-10s %s\n", name+":", value)
+		}
+	}
+	field("ID", s.ID)
+	project := deref(s.ProjectName)
+	if path := deref(s.ProjectPath); path != "" && path != project {
+		if project == "" {
+			project = path
+		} else {
+			project += " (" + path + ")"
+		}
+	}
+	field("Project", project)
+	field("Source", deref(s.Source))
+	model := deref(s.Model)
+	if provider := deref(s.Provider); provider != "" && model != "" {
+		model += " (" + provider + ")"
+	}
+	field("Model", model)
+	field("Status", deref(s.Status))
+	if s.CreatedAt != nil {
+		started := formatTimestamp(*s.CreatedAt)
+		if s.EndedAt != nil && *s.EndedAt >= *s.CreatedAt {
+			started += fmt.Sprintf(" (ran %s)", formatDuration(*s.EndedAt-*s.CreatedAt))
+		}
+		field("Started", started)
+	}
+	if s.PromptTokens != nil || s.CompletionTokens != nil {
+		field("Tokens", fmt.Sprintf("%d in / %d out", valueOrZero(s.PromptTokens), valueOrZero(s.CompletionTokens)))
+	}
+	if s.Cost != nil && *s.Cost > 0 {
+		field("Cost", fmt.Sprintf("$%.4f", *s.Cost))
+	}
+
+	if len(t.Entries) == 0 {
+		fmt.Fprintln(w, "\n(no transcript recorded)")
+		return
+	}
+
+	for _, entry := range t.Entries {
+		fmt.Fprintln(w)
+		stamp := "--:--:--"
+		if entry.CreatedAt != nil {
+			stamp = time.UnixMilli(*entry.CreatedAt).Format("15:04:05")
+		}
+
+		switch entry.Kind {
+		case storage.EntryMessage:
+			m := entry.Message
+			header := m.Role
+			if m.Model != nil && *m.Model != "" && m.Role != "user" {
+				header += " · " + *m.Model
+			}
+			fmt.Fprintf(w, "[%s] %s\n", stamp, header)
+			writeIndented(w, m.TextContent)
+
+		case storage.EntryTool:
+			tool := entry.Tool
+			status := ""
+			if tool.Success != nil {
+				if *tool.Success {
+					status = " ok"
+				} else {
+					status = " failed"
+				}
+			}
+			if tool.DurationMs != nil {
+				status += fmt.Sprintf(" (%s)", formatDuration(*tool.DurationMs))
+			}
+			fmt.Fprintf(w, "[%s] tool %s%s\n", stamp, tool.ToolName, status)
+			if tool.FilePath != nil && *tool.FilePath != "" {
+				fmt.Fprintf(w, "    file:   %s\n", *tool.FilePath)
+			}
+			if tool.ToolInput != nil && *tool.ToolInput != "" {
+				fmt.Fprintf(w, "    input:  %s\n", preview(*tool.ToolInput, full))
+			}
+			if tool.ToolOutput != nil && *tool.ToolOutput != "" {
+				fmt.Fprintf(w, "    output: %s\n", preview(*tool.ToolOutput, full))
+			}
+			if tool.ErrorMessage != nil && *tool.ErrorMessage != "" {
+				fmt.Fprintf(w, "    error:  %s\n", preview(*tool.ErrorMessage, full))
+			}
+
+		case storage.EntryError:
+			e := entry.Error
+			kind := deref(e.ErrorType)
+			if kind == "" {
+				kind = "error"
+			}
+			fmt.Fprintf(w, "[%s] ! %s: %s\n", stamp, kind, deref(e.ErrorMessage))
+
+		case storage.EntryCompaction:
+			c := entry.Compaction
+			var parts []string
+			if c.TokensBefore != nil && c.TokensAfter != nil {
+				parts = append(parts, fmt.Sprintf("%d -> %d tokens", *c.TokensBefore, *c.TokensAfter))
+			}
+			if c.MessagesBefore != nil && c.MessagesAfter != nil {
+				parts = append(parts, fmt.Sprintf("%d -> %d messages", *c.MessagesBefore, *c.MessagesAfter))
+			}
+			detail := ""
+			if len(parts) > 0 {
+				detail = ": " + strings.Join(parts, ", ")
+			}
+			fmt.Fprintf(w, "[%s] -- context compacted%s --\n", stamp, detail)
+		}
+	}
+}
+
+func writeIndented(w io.Writer, text string) {
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		fmt.Fprintln(w, "    (empty)")
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+// preview flattens s to one line and shortens it unless full is set.
+func preview(s string, full bool) string {
+	if full {
+		return strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n            ")
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > transcriptPreviewLength {
+		return string(r[:transcriptPreviewLength]) + "..."
+	}
+	return s
+}
+
+func formatTimestamp(ms int64) string {
+	return time.UnixMilli(ms).Format("2006-01-02 15:04")
+}
+
+func formatDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", ms)
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+func displayLen(s string) int {
+	return len([]rune(s))
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func valueOrZero(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
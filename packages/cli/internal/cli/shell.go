@@ -0,0 +1,331 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dxta-dev/clankers/internal/formatters"
+	"github.com/dxta-dev/clankers/internal/lineedit"
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	shellPrompt             = "clankers> "
+	shellContinuationPrompt = "     ...> "
+)
+
+// shellCmd returns the 'shell' command
+func shellCmd() *cobra.Command {
+	var output outputFlags
+
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Interactive SQL shell",
+		Long: `Start an interactive, read-only SQL shell on the Clankers database.
+
+Statements may span several lines and run when terminated with ';'.
+History is kept in the data directory, and Tab completes table and
+column names. The same restrictions as 'clankers query' apply.
+
+Commands:
+  .tables           List tables
+  .schema [table]   Show CREATE statements
+  .format [format]  Show or change the output format
+  .timer on|off     Print how long each statement took
+  .help             Show this list
+  .quit             Exit (or press Ctrl-D)
+
+Examples:
+  clankers shell
+  clankers shell --format markdown
+  clankers shell < report.sql`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := openReader()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			return runShell(r, output)
+		},
+	}
+
+	output.register(cmd, string(formatters.FormatTable))
+
+	return cmd
+}
+
+type shell struct {
+	reader reader
+	editor *lineedit.Editor
+	output outputFlags
+	timer  bool
+
+	tables  []string
+	columns map[string][]string
+}
+
+// runShell reads statements and dot-commands from stdin until EOF or .quit.
+func runShell(r reader, output outputFlags) error {
+	if _, err := output.formatter(); err != nil {
+		return err
+	}
+
+	sh := &shell{
+		reader: r,
+		editor: lineedit.New(os.Stdin, os.Stdout),
+		output: output,
+	}
+	sh.loadSchema()
+	sh.editor.Complete = sh.complete
+
+	if sh.editor.Interactive() {
+		history, err := lineedit.LoadHistory(paths.GetHistoryPath(), lineedit.DefaultHistorySize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		sh.editor.History = history
+		fmt.Println(`Clankers SQL shell (read-only). Enter ".help" for commands, Ctrl-D to exit.`)
+	}
+
+	return sh.run()
+}
+
+func (sh *shell) run() error {
+	var pending strings.Builder
+
+	for {
+		prompt := shellPrompt
+		if pending.Len() > 0 {
+			prompt = shellContinuationPrompt
+		}
+
+		line, err := sh.editor.ReadLine(prompt)
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			pending.Reset()
+			continue
+		}
+		if err == io.EOF {
+			// Scripts may leave the last statement unterminated.
+			if statements, _ := storage.SplitStatements(pending.String()); len(statements) > 0 {
+				sh.executeAll(statements)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		if sh.editor.Interactive() {
+			if err := sh.editor.History.Add(line); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ".") {
+			if quit := sh.dotCommand(strings.TrimSpace(line)); quit {
+				return nil
+			}
+			continue
+		}
+
+		pending.WriteString(line)
+		pending.WriteByte('\n')
+
+		statements, terminated := storage.SplitStatements(pending.String())
+		if !terminated {
+			if len(statements) == 0 {
+				pending.Reset()
+			}
+			continue
+		}
+		pending.Reset()
+		sh.executeAll(statements)
+	}
+}
+
+func (sh *shell) executeAll(statements []string) {
+	for _, stmt := range statements {
+		sh.execute(stmt)
+	}
+}
+
+func (sh *shell) execute(stmt string) {
+	start := time.Now()
+	results, err := sh.reader.Query(stmt)
+	elapsed := time.Since(start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", queryError(err, stmt, sh.reader))
+		return
+	}
+
+	if err := sh.output.print(toResultSet(results)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	warnTruncated(results)
+	if sh.timer {
+		fmt.Printf("Run Time: %s\n", elapsed.Round(time.Microsecond))
+	}
+}
+
+var shellCommands = []string{".exit", ".format", ".help", ".quit", ".schema", ".tables", ".timer"}
+
+// dotCommand runs a shell command such as ".tables" and reports whether the
+// shell should exit.
+func (sh *shell) dotCommand(line string) bool {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ".quit", ".exit":
+		return true
+
+	case ".help":
+		fmt.Println(`.tables           List tables
+.schema [table]   Show CREATE statements
+.format [format]  Show or change the output format (` + formatters.SupportedFormatList() + `)
+.timer on|off     Print how long each statement took
+.quit             Exit`)
+
+	case ".tables":
+		sh.loadSchema()
+		for _, table := range sh.tables {
+			fmt.Println(table)
+		}
+
+	case ".schema":
+		table := ""
+		if len(args) > 0 {
+			table = args[0]
+		}
+		statements, err := sh.reader.SchemaSQL(table)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read schema: %v\n", err)
+			break
+		}
+		if len(statements) == 0 && table != "" {
+			fmt.Fprintf(os.Stderr, "Error: no such table: %s\n", table)
+			break
+		}
+		for _, stmt := range statements {
+			fmt.Printf("%s;\n", stmt)
+		}
+
+	case ".format":
+		if len(args) == 0 {
+			fmt.Println(sh.output.format)
+			break
+		}
+		next := sh.output
+		next.format = args[0]
+		if _, err := next.formatter(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			break
+		}
+		sh.output = next
+
+	case ".timer":
+		switch {
+		case len(args) == 1 && args[0] == "on":
+			sh.timer = true
+		case len(args) == 1 && args[0] == "off":
+			sh.timer = false
+		default:
+			fmt.Fprintln(os.Stderr, "Usage: .timer on|off")
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q (try .help)\n", name)
+	}
+
+	return false
+}
+
+// loadSchema caches table and column names for completion.
+func (sh *shell) loadSchema() {
+	tables, err := sh.reader.TableNames()
+	if err != nil {
+		return
+	}
+	sh.tables = tables
+	sh.columns = make(map[string][]string, len(tables))
+	for _, table := range tables {
+		if columns, err := sh.reader.TableColumns(table); err == nil {
+			sh.columns[table] = columns
+		}
+	}
+}
+
+// complete suggests dot-commands at the start of a line, table names after
+// ".schema", "table.column" after a table name and a dot, and otherwise any
+// table or column name.
+func (sh *shell) complete(line []rune, pos int) (int, []string) {
+	start := pos
+	for start > 0 && isIdentRune(line[start-1]) {
+		start--
+	}
+	word := string(line[start:pos])
+	before := strings.TrimSpace(string(line[:start]))
+
+	switch {
+	case before == "" && strings.HasPrefix(word, "."):
+		return start, matchPrefix(shellCommands, word)
+	case before == ".schema":
+		return start, matchPrefix(sh.tables, word)
+	}
+
+	if table, column, ok := strings.Cut(word, "."); ok {
+		for name, columns := range sh.columns {
+			if strings.EqualFold(name, table) {
+				var candidates []string
+				for _, c := range matchPrefix(columns, column) {
+					candidates = append(candidates, table+"."+c)
+				}
+				return start, candidates
+			}
+		}
+		return start, nil
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, table := range sh.tables {
+		if !seen[table] {
+			seen[table] = true
+			names = append(names, table)
+		}
+		for _, column := range sh.columns[table] {
+			if !seen[column] {
+				seen[column] = true
+				names = append(names, column)
+			}
+		}
+	}
+	sort.Strings(names)
+	return start, matchPrefix(names, word)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func matchPrefix(words []string, prefix string) []string {
+	var matches []string
+	lower := strings.ToLower(prefix)
+	for _, w := range words {
+		if strings.HasPrefix(strings.ToLower(w), lower) {
+			matches = append(matches, w)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/spf13/cobra"
+)
+
+// cliClient identifies CLI commands in the daemon's client list.
+func cliClient() rpc.ClientInfo {
+	return rpc.ClientInfo{Name: "clankers-cli", Version: Version}
+}
+
+// statusCmd returns the status command
+func statusCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show what the daemon is doing",
+		Long: `Ask the running daemon for its uptime, database, write queue, the last
+write per session source, and which clients have talked to it.
+
+Plugins open a connection per call, so the client totals since startup are
+usually more telling than the open connections.
+
+Examples:
+  clankers status
+  clankers status --format json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unknown format: %s (supported: text, json)", format)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client, err := rpc.Dial(ctx, paths.GetSocketPath(), cliClient())
+			if err != nil {
+				if errors.Is(err, rpc.ErrNotRunning) {
+					return fmt.Errorf("%w; start it with 'clankers daemon start'", err)
+				}
+				return err
+			}
+			defer client.Close()
+
+			var status rpc.StatusResult
+			if err := client.Call(ctx, "status", client.Envelope(), &status); err != nil {
+				return fmt.Errorf("failed to get status: %w", err)
+			}
+
+			if format == "json" {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(status)
+			}
+			printStatus(os.Stdout, &status)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json")
+
+	return cmd
+}
+
+func printStatus(w io.Writer, s *rpc.StatusResult) {
+	uptime := time.Duration(s.UptimeSeconds) * time.Second
+	journal := "disabled"
+	if s.Journal {
+		journal = "enabled"
+	}
+
+	fmt.Fprintf(w, "%-10s running (pid %d, version %s, up %s)\n", "Daemon:", s.PID, s.Version, uptime)
+	fmt.Fprintf(w, "%-10s %s\n", "Socket:", s.SocketPath)
+	fmt.Fprintf(w, "%-10s %s (%s)\n", "Database:", s.DbPath, formatSize(s.DbSizeBytes))
+	fmt.Fprintf(w, "%-10s %s\n", "Journal:", journal)
+	q := s.WriteQueue
+	fmt.Fprintf(w, "%-10s depth %d, %d committed, %d failed, last commit %dus\n",
+		"Writes:", q.Depth, q.Committed, q.Failed, q.LastCommitUsec)
+
+	fmt.Fprintln(w, "\nSources")
+	if len(s.Sources) == 0 {
+		fmt.Fprintln(w, "  (no sessions recorded)")
+	}
+	for _, source := range s.Sources {
+		name := source.Source
+		if name == "" {
+			name = "(none)"
+		}
+		lastWrite := "none since start"
+		if source.LastWrite != 0 {
+			lastWrite = formatAgo(source.LastWrite)
+		}
+		fmt.Fprintf(w, "  %-14s %6d sessions  last write %s\n", name, source.Sessions, lastWrite)
+	}
+
+	fmt.Fprintln(w, "\nClients since start")
+	fmt.Fprintf(w, "  %-28s %6s %8s %6s  %-16s %s\n", "CLIENT", "CONNS", "REQUESTS", "ERRORS", "LAST ACTIVITY", "LAST WRITE")
+	for _, c := range s.Clients {
+		fmt.Fprintf(w, "  %-28s %6d %8d %6d  %-16s %s\n",
+			clientLabel(c.Client), c.Connections, c.Requests, c.Errors, formatAgo(c.LastActivity), formatAgo(c.LastWrite))
+	}
+
+	fmt.Fprintln(w, "\nOpen connections")
+	fmt.Fprintf(w, "  %-5s %-28s %-16s %8s %6s\n", "ID", "CLIENT", "CONNECTED", "REQUESTS", "ERRORS")
+	for _, c := range s.Connections {
+		fmt.Fprintf(w, "  %-5d %-28s %-16s %8d %6d\n",
+			c.ID, clientLabel(c.Client), formatAgo(c.ConnectedAt), c.Requests, c.Errors)
+	}
+}
+
+func clientLabel(c rpc.ClientInfo) string {
+	if c.Name == "" {
+		return "(unknown)"
+	}
+	if c.Version == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Version
+}
+
+// formatAgo renders a unix ms timestamp relative to now.
+func formatAgo(ms int64) string {
+	if ms == 0 {
+		return "never"
+	}
+	d := time.Since(time.UnixMilli(ms))
+	if d < time.Second {
+		return "just now"
+	}
+	if d < 24*time.Hour {
+		return d.Round(time.Second).String() + " ago"
+	}
+	return formatTimestamp(ms)
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/paths"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/spf13/cobra"
+)
+
+// ANSI colours used by tail.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// tailSessionWidth is how much of a session id tail prints.
+const tailSessionWidth = 12
+
+// tailCmd returns the tail command
+func tailCmd() *cobra.Command {
+	var (
+		filter  rpc.EventFilter
+		format  string
+		noColor bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Stream what every agent is doing as it happens",
+		Long: `Subscribe to the running daemon and print a line for every session,
+message, tool call, error and compaction it records, until interrupted.
+Writes that change nothing are not shown.
+
+--project matches a project name or path. Colour is used when stdout is a
+terminal and NO_COLOR is not set.
+
+Examples:
+  clankers tail
+  clankers tail --project clankers --source opencode
+  clankers tail --session ses_123 --format json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unknown format: %s (supported: text, json)", format)
+			}
+			color := !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			client, err := rpc.Dial(ctx, paths.GetSocketPath(), cliClient())
+			if err != nil {
+				if errors.Is(err, rpc.ErrNotRunning) {
+					return fmt.Errorf("%w; start it with 'clankers daemon start'", err)
+				}
+				return err
+			}
+			defer client.Close()
+
+			callCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			var result rpc.SubscribeResult
+			params := rpc.SubscribeParams{RequestEnvelope: client.Envelope(), Filter: filter}
+			if err := client.Call(callCtx, "subscribe", params, &result); err != nil {
+				return fmt.Errorf("failed to subscribe: %w", err)
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case req, ok := <-client.Notifications():
+					if !ok {
+						return errors.New("connection to the daemon closed")
+					}
+					switch req.Method {
+					case rpc.NotifyShutdown:
+						fmt.Fprintln(os.Stderr, "daemon is shutting down")
+						return nil
+					case rpc.NotifyEvent:
+						var ev rpc.Event
+						if req.Params == nil || json.Unmarshal(*req.Params, &ev) != nil {
+							continue
+						}
+						if format == "json" {
+							encoder.Encode(ev)
+							continue
+						}
+						printEvent(os.Stdout, &ev, color)
+					}
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&filter.SessionID, "session", "", "only show this session")
+	cmd.Flags().StringVar(&filter.Project, "project", "", "only show sessions in this project (name or path)")
+	cmd.Flags().StringVar(&filter.Source, "source", "", "only show sessions from this source (e.g. opencode, claude-code)")
+	cmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text, json")
+	cmd.Flags().BoolVar(&noColor, "no-color", false, "disable colour")
+
+	return cmd
+}
+
+// printEvent writes one line: time, source, project, session, kind and
+// summary.
+func printEvent(w io.Writer, ev *rpc.Event, color bool) {
+	paint := func(code, s string) string {
+		if !color || code == "" {
+			return s
+		}
+		return code + s + ansiReset
+	}
+
+	if ev.Dropped > 0 {
+		fmt.Fprintln(w, paint(ansiDim, fmt.Sprintf("... %d events dropped", ev.Dropped)))
+	}
+
+	session := ev.SessionID
+	if len(session) > tailSessionWidth {
+		session = session[:tailSessionWidth]
+	}
+	kind, code := eventLabel(ev)
+
+	line := fmt.Sprintf("%s %-11s %-16s %-*s %s %s",
+		paint(ansiDim, time.UnixMilli(ev.At).Format("15:04:05")),
+		orNone(ev.Source),
+		orNone(ev.Project),
+		tailSessionWidth, session,
+		paint(code, fmt.Sprintf("%-10s", kind)),
+		ev.Summary)
+	fmt.Fprintln(w, strings.TrimRight(line, " "))
+}
+
+// eventLabel returns the word printed for an event's kind and its colour.
+func eventLabel(ev *rpc.Event) (string, string) {
+	switch ev.Kind {
+	case rpc.KindSession:
+		return "session", ansiCyan
+	case rpc.KindMessage:
+		if ev.Role == "user" {
+			return ev.Role, ansiGreen
+		}
+		return orNone(ev.Role), ansiBlue
+	case rpc.KindTool:
+		if ev.Failed {
+			return "tool", ansiRed
+		}
+		return "tool", ansiYellow
+	case rpc.KindSessionError:
+		return "error", ansiRed
+	case rpc.KindCompactionEvent:
+		return "compaction", ansiMagenta
+	}
+	return ev.Kind, ""
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Discovery is what a daemon started with --listen or --http publishes
+// about its TCP listeners, for clients that cannot reach the Unix socket.
+// The file holds the bearer token, so it is only readable by its owner.
+type Discovery struct {
+	Address     string `json:"address,omitempty"`     // JSON-RPC over TCP; empty without --listen
+	HTTPAddress string `json:"httpAddress,omitempty"` // HTTP API; empty without --http
+	Token       string `json:"token"`
+	PID         int    `json:"pid"`
+}
+
+// WriteDiscovery replaces the discovery file at path.
+func WriteDiscovery(path string, d *Discovery) error {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// The temp file is created 0600 so the token is never readable by
+	// others, even briefly.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadDiscovery reads the discovery file at path.
+func ReadDiscovery(path string) (*Discovery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d Discovery
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,34 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDiscoveryRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.json")
+	want := Discovery{Address: "127.0.0.1:7878", Token: "secret", PID: 42}
+
+	if err := WriteDiscovery(path, &want); err != nil {
+		t.Fatalf("failed to write discovery file: %v", err)
+	}
+	got, err := ReadDiscovery(path)
+	if err != nil {
+		t.Fatalf("failed to read discovery file: %v", err)
+	}
+	if *got != want {
+		t.Errorf("expected %+v, got %+v", want, *got)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat discovery file: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("expected mode 0600, got %o", perm)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package daemon keeps one daemon per data directory. The running daemon
+// holds an exclusive lock on clankers.lock for its whole lifetime and
+// records its pid in clankers.pid. The lock, not the pidfile, is the source
+// of truth: it is released by the OS when the process dies, so a stale
+// pidfile left by a crash never blocks a restart.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	lockFileName = "clankers.lock"
+	pidFileName  = "clankers.pid"
+)
+
+// ErrAlreadyRunning is returned by Acquire when another process holds the
+// lock.
+var ErrAlreadyRunning = errors.New("another daemon is already running")
+
+type Lock struct {
+	file    *os.File
+	pidPath string
+}
+
+// Acquire takes the daemon lock in dir and writes the current pid to the
+// pidfile. It fails immediately with ErrAlreadyRunning if the lock is held.
+func Acquire(dir string) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if pid, _ := ReadPID(dir); pid != 0 {
+			return nil, fmt.Errorf("%w (pid %d)", ErrAlreadyRunning, pid)
+		}
+		return nil, ErrAlreadyRunning
+	}
+
+	pidPath := filepath.Join(dir, pidFileName)
+	if err := writePID(pidPath, os.Getpid()); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, fmt.Errorf("failed to write pidfile: %w", err)
+	}
+
+	return &Lock{file: file, pidPath: pidPath}, nil
+}
+
+// Release removes the pidfile and drops the lock.
+func (l *Lock) Release() error {
+	os.Remove(l.pidPath)
+	unlockFile(l.file)
+	return l.file.Close()
+}
+
+// Running returns the pid of the daemon holding the lock in dir, or 0 if
+// none does.
+func Running(dir string) (int, error) {
+	file, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if lockFile(file) == nil {
+		unlockFile(file)
+		return 0, nil
+	}
+	pid, err := ReadPID(dir)
+	if err != nil {
+		return 0, fmt.Errorf("daemon lock is held but the pidfile is unreadable: %w", err)
+	}
+	return pid, nil
+}
+
+// ReadPID returns the pid recorded in dir's pidfile.
+func ReadPID(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, pidFileName))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// writePID replaces the pidfile atomically so readers never see it empty.
+func writePID(path string, pid int) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestAcquireIsExclusive(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+
+	if _, err := Acquire(dir); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("expected ErrAlreadyRunning, got %v", err)
+	}
+	pid, err := Running(dir)
+	if err != nil {
+		t.Fatalf("failed to check lock: %v", err)
+	}
+	if pid != os.Getpid() {
+		t.Errorf("expected pid %d, got %d", os.Getpid(), pid)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("failed to release lock: %v", err)
+	}
+	if pid, _ := Running(dir); pid != 0 {
+		t.Errorf("expected no daemon after release, got pid %d", pid)
+	}
+
+	again, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("expected to reacquire released lock: %v", err)
+	}
+	again.Release()
+}
+
+func TestStalePidfileIsIgnored(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+	// Drop the lock but leave the pidfile behind, as a crash would.
+	unlockFile(lock.file)
+	lock.file.Close()
+
+	if pid, _ := Running(dir); pid != 0 {
+		t.Errorf("expected stale pidfile to be ignored, got pid %d", pid)
+	}
+	again, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("expected to acquire over a stale pidfile: %v", err)
+	}
+	again.Release()
+}
@@ -0,0 +1,246 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+// ArchiveKind identifies a full-database archive. Archives are JSON Lines:
+// one ArchiveHeader line followed by one ArchiveRecord per row, with each
+// session's row before its children.
+const ArchiveKind = "clankers.archive"
+
+// archivePageSize is how many sessions are loaded per ListSessions call.
+const archivePageSize = 200
+
+type ArchiveHeader struct {
+	Kind       string `json:"kind"`
+	Version    int    `json:"version"`
+	ExportedAt int64  `json:"exportedAt"`
+	Since      int64  `json:"since,omitempty"`
+}
+
+// ArchiveRecord is one row. Row holds the JSON form of the storage type
+// for Table.
+type ArchiveRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// TableCounts holds one count per table, keyed by storage table name.
+type TableCounts map[string]int
+
+// ImportStats reports what an import did to each table.
+type ImportStats map[string]map[storage.Change]int
+
+// WriteArchive writes every session created at or after since (unix ms; 0
+// for all) with its child rows, and returns the number of rows written per
+// table.
+func WriteArchive(w io.Writer, r Reader, since int64) (TableCounts, error) {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	counts := TableCounts{}
+
+	header := ArchiveHeader{Kind: ArchiveKind, Version: BundleVersion, ExportedAt: time.Now().UnixMilli(), Since: since}
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+
+	write := func(table string, row any) error {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		counts[table]++
+		return encoder.Encode(ArchiveRecord{Table: table, Row: data})
+	}
+
+	filter := storage.SessionFilter{Since: since, Sort: storage.SortCreated, Ascending: true, Limit: archivePageSize}
+	for {
+		page, err := r.ListSessions(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range page.Sessions {
+			bundle, err := NewSessionBundle(r, session.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read session %s: %w", session.ID, err)
+			}
+			if err := write(storage.TableSessions, bundle.Session); err != nil {
+				return nil, err
+			}
+			for i := range bundle.Messages {
+				if err := write(storage.TableMessages, &bundle.Messages[i]); err != nil {
+					return nil, err
+				}
+			}
+			for i := range bundle.Tools {
+				if err := write(storage.TableTools, &bundle.Tools[i]); err != nil {
+					return nil, err
+				}
+			}
+			for i := range bundle.SessionErrors {
+				if err := write(storage.TableSessionErrors, &bundle.SessionErrors[i]); err != nil {
+					return nil, err
+				}
+			}
+			for i := range bundle.CompactionEvents {
+				if err := write(storage.TableCompactionEvents, &bundle.CompactionEvents[i]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	return counts, bw.Flush()
+}
+
+// NewImportStats returns ImportStats with an empty count for every table.
+func NewImportStats() ImportStats {
+	stats := ImportStats{}
+	for _, table := range storage.Tables {
+		stats[table] = map[storage.Change]int{}
+	}
+	return stats
+}
+
+// ReadArchive decodes an archive and calls apply for each row in archive
+// order, with a pointer to the storage type for its table (e.g.
+// *storage.Session). Gzip-compressed archives are detected automatically.
+// Reading stops at the first error, which names its line.
+func ReadArchive(r io.Reader, apply func(table string, row any) error) error {
+	reader, err := decompress(r)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	// Tool output can be large; allow long lines.
+	scanner.Buffer(make([]byte, 0, 64*1024), 256*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("archive is empty")
+	}
+	var header ArchiveHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Kind != ArchiveKind {
+		return fmt.Errorf("not a clankers archive")
+	}
+	if header.Version > BundleVersion {
+		return fmt.Errorf("archive version %d is newer than supported version %d", header.Version, BundleVersion)
+	}
+
+	line := 1
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record ArchiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		row, err := decodeRow(&record)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := apply(record.Table, row); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// ImportArchive upserts every record of an archive in a single transaction.
+// Nothing is written unless the whole archive applies cleanly. Changes are
+// attributed to client in the change history.
+func ImportArchive(r io.Reader, store *storage.Store, client storage.Client) (ImportStats, error) {
+	batch, err := store.BeginBatch()
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Rollback()
+	batch.SetClient(client)
+
+	stats := NewImportStats()
+	err = ReadArchive(r, func(table string, row any) error {
+		change, err := importRow(batch, row)
+		if err != nil {
+			return err
+		}
+		stats[table][change]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func importRow(batch *storage.Batch, row any) (storage.Change, error) {
+	switch row := row.(type) {
+	case *storage.Session:
+		return batch.UpsertSession(row)
+	case *storage.Message:
+		return batch.UpsertMessage(row)
+	case *storage.Tool:
+		return batch.UpsertTool(row)
+	case *storage.SessionError:
+		return batch.UpsertSessionError(row)
+	case *storage.CompactionEvent:
+		return batch.UpsertCompactionEvent(row)
+	default:
+		return "", fmt.Errorf("unsupported row %T", row)
+	}
+}
+
+// decodeRow returns the record's row as a pointer to the storage type for
+// its table.
+func decodeRow(record *ArchiveRecord) (any, error) {
+	var row any
+	switch record.Table {
+	case storage.TableSessions:
+		row = &storage.Session{}
+	case storage.TableMessages:
+		row = &storage.Message{}
+	case storage.TableTools:
+		row = &storage.Tool{}
+	case storage.TableSessionErrors:
+		row = &storage.SessionError{}
+	case storage.TableCompactionEvents:
+		row = &storage.CompactionEvent{}
+	default:
+		return nil, fmt.Errorf("unknown table: %s", record.Table)
+	}
+	if err := json.Unmarshal(record.Row, row); err != nil {
+		return nil, fmt.Errorf("invalid %s row: %w", record.Table, err)
+	}
+	return row, nil
+}
+
+// decompress returns a gzip reader if r starts with the gzip magic bytes
+// and r itself otherwise.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
@@ -0,0 +1,324 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+func createStore(t *testing.T) *storage.Store {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "export_test.db")
+	if _, err := storage.EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func seedSession(t *testing.T, store *storage.Store) {
+	t.Helper()
+
+	steps := []error{
+		store.UpsertSession(&storage.Session{
+			ID:               "ses_1",
+			Title:            ptr("Fix <script> handling"),
+			ProjectName:      ptr("clankers"),
+			Model:            ptr("gpt-5"),
+			Provider:         ptr("openai"),
+			PromptTokens:     ptr(int64(1200)),
+			CompletionTokens: ptr(int64(300)),
+			Cost:             ptr(0.12),
+			CreatedAt:        ptr(int64(1000)),
+			EndedAt:          ptr(int64(91000)),
+		}),
+		store.UpsertMessage(&storage.Message{ID: "m1", SessionID: "ses_1", Role: "user", TextContent: "Why does it fail?", CreatedAt: ptr(int64(2000))}),
+		store.UpsertMessage(&storage.Message{ID: "m2", SessionID: "ses_1", Role: "assistant", TextContent: "Because of <b>escaping</b>.", CreatedAt: ptr(int64(3000))}),
+		store.UpsertTool(&storage.Tool{
+			ID:         "t1",
+			SessionID:  "ses_1",
+			MessageID:  ptr("m2"),
+			ToolName:   "Bash",
+			ToolInput:  ptr(`{"command":"go test"}`),
+			ToolOutput: ptr("```\nFAIL\n```"),
+			Success:    ptr(false),
+			CreatedAt:  3000,
+		}),
+		store.UpsertSessionError(&storage.SessionError{ID: "e1", SessionID: "ses_1", ErrorType: ptr("api"), ErrorMessage: ptr("overloaded"), CreatedAt: 2500}),
+		store.UpsertCompactionEvent(&storage.CompactionEvent{ID: "c1", SessionID: "ses_1", TokensBefore: ptr(int64(9000)), TokensAfter: ptr(int64(1000)), CreatedAt: 4000}),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("failed to seed session: %v", err)
+		}
+	}
+}
+
+func TestWriteSessionJSON(t *testing.T) {
+	store := createStore(t)
+	seedSession(t, store)
+
+	var buf bytes.Buffer
+	if err := WriteSession(&buf, store, "ses_1", FormatJSON); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var bundle SessionBundle
+	if err := json.Unmarshal(buf.Bytes(), &bundle); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if bundle.Kind != SessionBundleKind || bundle.Version != BundleVersion {
+		t.Errorf("unexpected header: kind=%q version=%d", bundle.Kind, bundle.Version)
+	}
+	if bundle.Session.ID != "ses_1" {
+		t.Errorf("expected session ses_1, got %q", bundle.Session.ID)
+	}
+	if len(bundle.Messages) != 2 || len(bundle.Tools) != 1 || len(bundle.SessionErrors) != 1 || len(bundle.CompactionEvents) != 1 {
+		t.Errorf("expected all child rows, got %d messages, %d tools, %d errors, %d compactions",
+			len(bundle.Messages), len(bundle.Tools), len(bundle.SessionErrors), len(bundle.CompactionEvents))
+	}
+}
+
+func TestWriteSessionJSONEmptyChildren(t *testing.T) {
+	store := createStore(t)
+	if err := store.UpsertSession(&storage.Session{ID: "ses_empty"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSession(&buf, store, "ses_empty", FormatJSON); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, key := range []string{`"messages": []`, `"tools": []`, `"sessionErrors": []`, `"compactionEvents": []`} {
+		if !strings.Contains(buf.String(), key) {
+			t.Errorf("expected %s in bundle, got:\n%s", key, buf.String())
+		}
+	}
+}
+
+func TestWriteSessionMarkdown(t *testing.T) {
+	store := createStore(t)
+	seedSession(t, store)
+
+	var buf bytes.Buffer
+	if err := WriteSession(&buf, store, "ses_1", FormatMarkdown); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`# Fix \<script\> handling`,
+		"| **Model** | gpt-5 |",
+		"| **Duration** | 1m30s |",
+		"| **Tokens** | 1200 in / 300 out |",
+		"### User",
+		"<details>\n<summary>Tool: Bash (failed)</summary>",
+		"```json\n{\n  \"command\": \"go test\"\n}\n```",
+		"````\n```\nFAIL\n```\n````",
+		"> **Error (api)",
+		"*Context compacted: 9000 → 1000 tokens",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected markdown to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	// Entries appear in time order.
+	order := []string{"Why does it fail?", "overloaded", "Because of", "Tool: Bash", "Context compacted"}
+	last := -1
+	for _, s := range order {
+		idx := strings.Index(out, s)
+		if idx < last {
+			t.Errorf("expected %q after the previous entry", s)
+		}
+		last = idx
+	}
+}
+
+func TestWriteSessionHTML(t *testing.T) {
+	store := createStore(t)
+	seedSession(t, store)
+
+	var buf bytes.Buffer
+	if err := WriteSession(&buf, store, "ses_1", FormatHTML); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") {
+		t.Error("expected a complete HTML document")
+	}
+	if strings.Contains(out, "<script>") || strings.Contains(out, "<b>escaping</b>") {
+		t.Error("expected session content to be escaped")
+	}
+	for _, want := range []string{
+		"<title>Fix &lt;script&gt; handling</title>",
+		`<details class="entry tool failed">`,
+		"Because of &lt;b&gt;escaping&lt;/b&gt;.",
+		"<th>Cost</th><td>$0.1200</td>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected HTML to contain %q", want)
+		}
+	}
+	if strings.Contains(out, "http://") || strings.Contains(out, "https://") {
+		t.Error("expected no external resources")
+	}
+}
+
+func TestWriteSessionErrors(t *testing.T) {
+	store := createStore(t)
+
+	if err := WriteSession(&bytes.Buffer{}, store, "missing", FormatJSON); err == nil {
+		t.Error("expected an error for a missing session")
+	}
+	if err := WriteSession(&bytes.Buffer{}, store, "missing", "pdf"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "```"},
+		{"has `code`", "```"},
+		{"has ``` fence", "````"},
+		{"has ````` long fence", "``````"},
+	}
+
+	for _, tt := range tests {
+		if got := codeFence(tt.input); got != tt.expected {
+			t.Errorf("codeFence(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := createStore(t)
+	seedSession(t, source)
+	if err := source.UpsertSession(&storage.Session{ID: "ses_old", CreatedAt: ptr(int64(10))}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	counts, err := WriteArchive(gz, source, 500)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	gz.Close()
+
+	expected := TableCounts{"sessions": 1, "messages": 2, "tools": 1, "session_errors": 1, "compaction_events": 1}
+	for table, n := range expected {
+		if counts[table] != n {
+			t.Errorf("expected %d %s rows exported, got %d", n, table, counts[table])
+		}
+	}
+
+	target := createStore(t)
+	archive := buf.Bytes()
+
+	stats, err := ImportArchive(bytes.NewReader(archive), target, storage.Client{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for table, n := range expected {
+		if got := stats[table][storage.ChangeInserted]; got != n {
+			t.Errorf("expected %d %s rows inserted, got %d", n, table, got)
+		}
+	}
+
+	bundle, err := NewSessionBundle(target, "ses_1")
+	if err != nil {
+		t.Fatalf("expected imported session, got %v", err)
+	}
+	if deref(bundle.Session.Title) != "Fix <script> handling" || len(bundle.Tools) != 1 || *bundle.Tools[0].Success {
+		t.Errorf("imported session does not match the source: %+v", bundle)
+	}
+
+	// Importing again changes nothing.
+	stats, err = ImportArchive(bytes.NewReader(archive), target, storage.Client{})
+	if err != nil {
+		t.Fatalf("expected no error on re-import, got %v", err)
+	}
+	for table, n := range expected {
+		if got := stats[table][storage.ChangeSkipped]; got != n {
+			t.Errorf("expected %d %s rows skipped on re-import, got %d (%v)", n, table, got, stats[table])
+		}
+	}
+}
+
+func TestImportArchiveIsAtomic(t *testing.T) {
+	store := createStore(t)
+
+	archive := `{"kind":"clankers.archive","version":1,"exportedAt":1}
+{"table":"sessions","row":{"id":"ses_1"}}
+{"table":"widgets","row":{"id":"w1"}}
+`
+	if _, err := ImportArchive(strings.NewReader(archive), store, storage.Client{}); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected an error on line 3, got %v", err)
+	}
+	if _, _, err := store.GetSessionByID("ses_1"); err == nil {
+		t.Error("expected nothing to be imported from a failed archive")
+	}
+
+	if _, err := ImportArchive(strings.NewReader(`{"kind":"clankers.session"}`), store, storage.Client{}); err == nil {
+		t.Error("expected an error for a non-archive document")
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	archive := `{"kind":"clankers.archive","version":1,"exportedAt":1}
+{"table":"sessions","row":{"id":"ses_1"}}
+
+{"table":"messages","row":{"id":"m1","sessionId":"ses_1","role":"user"}}
+{"table":"tools","row":{"id":"t1","sessionId":"ses_1","toolName":"Read"}}
+`
+	var got []string
+	err := ReadArchive(strings.NewReader(archive), func(table string, row any) error {
+		switch row := row.(type) {
+		case *storage.Session:
+			got = append(got, table+":"+row.ID)
+		case *storage.Message:
+			got = append(got, table+":"+row.ID)
+		case *storage.Tool:
+			got = append(got, table+":"+row.ID)
+		default:
+			t.Errorf("unexpected row %T", row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Join(got, " ") != "sessions:ses_1 messages:m1 tools:t1" {
+		t.Errorf("expected typed rows in archive order, got %v", got)
+	}
+
+	err = ReadArchive(strings.NewReader(archive), func(table string, row any) error {
+		if table == storage.TableTools {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "line 5: rejected" {
+		t.Errorf("expected the apply error with its line, got %v", err)
+	}
+}
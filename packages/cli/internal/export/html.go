@@ -0,0 +1,148 @@
+package export
+
+import (
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+// htmlEntry is a transcript entry prepared for the HTML template.
+type htmlEntry struct {
+	Kind    string
+	Time    string
+	Heading string
+	Role    string
+	Text    string
+	Blocks  []htmlBlock
+	Failed  bool
+}
+
+type htmlBlock struct {
+	Label   string
+	Content string
+}
+
+type htmlDocument struct {
+	Title    string
+	Metadata []metadataRow
+	Entries  []htmlEntry
+}
+
+// WriteHTML renders a transcript as a single HTML page with inline styles and
+// no external resources. Tool calls are collapsible <details> elements.
+func WriteHTML(w io.Writer, t *storage.Transcript) error {
+	doc := htmlDocument{
+		Title:    sessionTitle(t.Session),
+		Metadata: sessionMetadata(t.Session),
+	}
+
+	for _, entry := range t.Entries {
+		e := htmlEntry{Kind: entry.Kind, Time: entryTime(entry.CreatedAt)}
+
+		switch entry.Kind {
+		case storage.EntryMessage:
+			m := entry.Message
+			e.Role = m.Role
+			e.Heading = roleLabel(m.Role)
+			if m.Model != nil && *m.Model != "" && m.Role != "user" {
+				e.Heading += " · " + *m.Model
+			}
+			e.Text = strings.TrimSpace(m.TextContent)
+
+		case storage.EntryTool:
+			tool := entry.Tool
+			e.Heading = toolSummary(tool)
+			e.Failed = tool.Success != nil && !*tool.Success
+			if tool.ToolInput != nil && *tool.ToolInput != "" {
+				e.Blocks = append(e.Blocks, htmlBlock{"Input", blockContent(*tool.ToolInput)})
+			}
+			if tool.ToolOutput != nil && *tool.ToolOutput != "" {
+				e.Blocks = append(e.Blocks, htmlBlock{"Output", blockContent(*tool.ToolOutput)})
+			}
+			if tool.ErrorMessage != nil && *tool.ErrorMessage != "" {
+				e.Blocks = append(e.Blocks, htmlBlock{"Error", *tool.ErrorMessage})
+			}
+
+		case storage.EntryError:
+			e.Heading = "Error"
+			if kind := deref(entry.Error.ErrorType); kind != "" {
+				e.Heading += " (" + kind + ")"
+			}
+			e.Text = deref(entry.Error.ErrorMessage)
+
+		case storage.EntryCompaction:
+			e.Heading = compactionSummary(entry.Compaction)
+		}
+
+		doc.Entries = append(doc.Entries, e)
+	}
+
+	return htmlTemplate.Execute(w, doc)
+}
+
+func blockContent(s string) string {
+	if pretty, ok := prettyJSON(s); ok {
+		return pretty
+	}
+	return strings.TrimRight(s, "\n")
+}
+
+var htmlTemplate = template.Must(template.New("session").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; max-width: 960px; margin: 2rem auto; padding: 0 1rem; }
+h1 { font-size: 1.6rem; margin-bottom: 0.5rem; }
+table.meta { border-collapse: collapse; margin-bottom: 2rem; }
+table.meta th { text-align: left; padding: 2px 16px 2px 0; color: #59636e; font-weight: 600; }
+table.meta td { padding: 2px 0; }
+.entry { margin: 1rem 0; }
+.message { border: 1px solid #d1d9e0; border-radius: 6px; padding: 0.5rem 1rem; }
+.message.user { background: #f6f8fa; }
+.heading { font-weight: 600; }
+.time { color: #59636e; font-weight: normal; font-size: 0.85em; margin-left: 0.5rem; }
+.text { white-space: pre-wrap; word-wrap: break-word; margin: 0.5rem 0 0; font: inherit; }
+details.tool { border-left: 3px solid #8c959f; padding: 0.25rem 0.75rem; }
+details.tool.failed { border-left-color: #cf222e; }
+details.tool summary { cursor: pointer; font-family: ui-monospace, SFMono-Regular, Menlo, monospace; font-size: 0.9em; }
+.block-label { font-size: 0.8em; color: #59636e; text-transform: uppercase; margin-top: 0.5rem; }
+pre.block { background: #f6f8fa; border-radius: 6px; padding: 0.5rem; overflow-x: auto; font-size: 0.85em; white-space: pre-wrap; word-wrap: break-word; }
+.error { border-left: 3px solid #cf222e; background: #ffebe9; padding: 0.5rem 0.75rem; }
+.compaction { text-align: center; color: #59636e; font-style: italic; border-top: 1px dashed #d1d9e0; border-bottom: 1px dashed #d1d9e0; padding: 0.25rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table class="meta">
+{{- range .Metadata}}
+<tr><th>{{.Label}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{range .Entries}}
+{{- if eq .Kind "message"}}
+<div class="entry message {{.Role}}">
+<div class="heading">{{.Heading}}{{if .Time}}<span class="time">{{.Time}}</span>{{end}}</div>
+<pre class="text">{{.Text}}</pre>
+</div>
+{{- else if eq .Kind "tool"}}
+<details class="entry tool{{if .Failed}} failed{{end}}">
+<summary>{{.Heading}}{{if .Time}}<span class="time">{{.Time}}</span>{{end}}</summary>
+{{- range .Blocks}}
+<div class="block-label">{{.Label}}</div>
+<pre class="block">{{.Content}}</pre>
+{{- end}}
+</details>
+{{- else if eq .Kind "error"}}
+<div class="entry error"><span class="heading">{{.Heading}}</span>{{if .Time}}<span class="time">{{.Time}}</span>{{end}}<pre class="text">{{.Text}}</pre></div>
+{{- else if eq .Kind "compaction"}}
+<div class="entry compaction">{{.Heading}}{{if .Time}} · {{.Time}}{{end}}</div>
+{{- end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+// WriteMarkdown renders a transcript as GitHub-flavoured Markdown. Tool
+// calls are wrapped in <details> blocks so they render collapsed.
+func WriteMarkdown(w io.Writer, t *storage.Transcript) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# %s\n\n", markdownInline(sessionTitle(t.Session)))
+	bw.WriteString("| | |\n|---|---|\n")
+	for _, row := range sessionMetadata(t.Session) {
+		fmt.Fprintf(bw, "| **%s** | %s |\n", row.Label, markdownInline(row.Value))
+	}
+
+	for _, entry := range t.Entries {
+		bw.WriteString("\n")
+		stamp := entryTime(entry.CreatedAt)
+
+		switch entry.Kind {
+		case storage.EntryMessage:
+			m := entry.Message
+			heading := roleLabel(m.Role)
+			if m.Model != nil && *m.Model != "" && m.Role != "user" {
+				heading += " · " + *m.Model
+			}
+			if stamp != "" {
+				heading += " · " + stamp
+			}
+			fmt.Fprintf(bw, "### %s\n\n", markdownInline(heading))
+			if text := strings.TrimSpace(m.TextContent); text != "" {
+				bw.WriteString(text + "\n")
+			} else {
+				bw.WriteString("*(empty)*\n")
+			}
+
+		case storage.EntryTool:
+			tool := entry.Tool
+			fmt.Fprintf(bw, "<details>\n<summary>Tool: %s</summary>\n\n", htmlEscaper.Replace(toolSummary(tool)))
+			if tool.ToolInput != nil && *tool.ToolInput != "" {
+				writeMarkdownBlock(bw, "Input", *tool.ToolInput)
+			}
+			if tool.ToolOutput != nil && *tool.ToolOutput != "" {
+				writeMarkdownBlock(bw, "Output", *tool.ToolOutput)
+			}
+			if tool.ErrorMessage != nil && *tool.ErrorMessage != "" {
+				writeMarkdownBlock(bw, "Error", *tool.ErrorMessage)
+			}
+			bw.WriteString("</details>\n")
+
+		case storage.EntryError:
+			e := entry.Error
+			label := "Error"
+			if kind := deref(e.ErrorType); kind != "" {
+				label += " (" + kind + ")"
+			}
+			if stamp != "" {
+				label += " · " + stamp
+			}
+			fmt.Fprintf(bw, "> **%s:** %s\n", markdownInline(label), markdownInline(deref(e.ErrorMessage)))
+
+		case storage.EntryCompaction:
+			summary := compactionSummary(entry.Compaction)
+			if stamp != "" {
+				summary += " · " + stamp
+			}
+			fmt.Fprintf(bw, "---\n\n*%s*\n\n---\n", markdownInline(summary))
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeMarkdownBlock(w *bufio.Writer, label, content string) {
+	lang := ""
+	if pretty, ok := prettyJSON(content); ok {
+		content, lang = pretty, "json"
+	}
+	content = strings.TrimRight(content, "\n")
+	fence := codeFence(content)
+	fmt.Fprintf(w, "**%s**\n\n%s%s\n%s\n%s\n\n", label, fence, lang, content, fence)
+}
+
+// codeFence returns a backtick fence longer than any backtick run in s, so
+// content containing ``` cannot close the block early.
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+)
+
+// markdownInline escapes text for use inside a heading or paragraph.
+func markdownInline(s string) string {
+	return markdownEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
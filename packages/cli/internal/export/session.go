@@ -0,0 +1,250 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+// BundleVersion is the version of the session bundle document. Bump it when
+// a change would break existing readers.
+const BundleVersion = 1
+
+// SessionBundleKind identifies a session bundle document.
+const SessionBundleKind = "clankers.session"
+
+// SessionBundle is a self-contained JSON export of one session and all of
+// its child rows.
+type SessionBundle struct {
+	Kind             string                    `json:"kind"`
+	Version          int                       `json:"version"`
+	ExportedAt       int64                     `json:"exportedAt"`
+	Session          storage.Session           `json:"session"`
+	Messages         []storage.Message         `json:"messages"`
+	Tools            []storage.Tool            `json:"tools"`
+	SessionErrors    []storage.SessionError    `json:"sessionErrors"`
+	CompactionEvents []storage.CompactionEvent `json:"compactionEvents"`
+}
+
+// Format is a session export format.
+type Format string
+
+const (
+	FormatMarkdown Format = "md"
+	FormatHTML     Format = "html"
+	FormatJSON     Format = "json"
+)
+
+// Reader is what exports read sessions from. *storage.Store implements it,
+// and so does the CLI's daemon client.
+type Reader interface {
+	ListSessions(filter storage.SessionFilter) (*storage.SessionPage, error)
+	GetTranscript(id string) (*storage.Transcript, error)
+}
+
+// NewSessionBundle loads a session and its child rows from r. The
+// transcript lists each kind of row in its table's order, so splitting it
+// back up keeps that order.
+func NewSessionBundle(r Reader, sessionID string) (*SessionBundle, error) {
+	transcript, err := r.GetTranscript(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &SessionBundle{
+		Kind:             SessionBundleKind,
+		Version:          BundleVersion,
+		ExportedAt:       time.Now().UnixMilli(),
+		Session:          *transcript.Session,
+		Messages:         []storage.Message{},
+		Tools:            []storage.Tool{},
+		SessionErrors:    []storage.SessionError{},
+		CompactionEvents: []storage.CompactionEvent{},
+	}
+	for _, entry := range transcript.Entries {
+		switch entry.Kind {
+		case storage.EntryMessage:
+			bundle.Messages = append(bundle.Messages, *entry.Message)
+		case storage.EntryTool:
+			bundle.Tools = append(bundle.Tools, *entry.Tool)
+		case storage.EntryError:
+			bundle.SessionErrors = append(bundle.SessionErrors, *entry.Error)
+		case storage.EntryCompaction:
+			bundle.CompactionEvents = append(bundle.CompactionEvents, *entry.Compaction)
+		}
+	}
+	return bundle, nil
+}
+
+// WriteSession writes the session in the given format.
+func WriteSession(w io.Writer, r Reader, sessionID string, format Format) error {
+	switch format {
+	case FormatJSON:
+		bundle, err := NewSessionBundle(r, sessionID)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bundle)
+
+	case FormatMarkdown, FormatHTML:
+		transcript, err := r.GetTranscript(sessionID)
+		if err != nil {
+			return err
+		}
+		if format == FormatHTML {
+			return WriteHTML(w, transcript)
+		}
+		return WriteMarkdown(w, transcript)
+
+	default:
+		return fmt.Errorf("unknown format: %s (supported: md, html, json)", format)
+	}
+}
+
+// metadataRow is one line of the header shared by the Markdown and HTML
+// renderers.
+type metadataRow struct {
+	Label string
+	Value string
+}
+
+func sessionTitle(s *storage.Session) string {
+	if s.Title != nil && *s.Title != "" {
+		return *s.Title
+	}
+	return "Untitled Session"
+}
+
+func sessionMetadata(s *storage.Session) []metadataRow {
+	var rows []metadataRow
+	add := func(label, value string) {
+		if value != "" {
+			rows = append(rows, metadataRow{label, value})
+		}
+	}
+
+	add("Session", s.ID)
+	add("Project", deref(s.ProjectName))
+	add("Path", deref(s.ProjectPath))
+	add("Source", deref(s.Source))
+	add("Model", deref(s.Model))
+	add("Provider", deref(s.Provider))
+	add("Status", deref(s.Status))
+	if s.CreatedAt != nil {
+		add("Started", formatTime(*s.CreatedAt))
+		if s.EndedAt != nil && *s.EndedAt >= *s.CreatedAt {
+			add("Duration", formatDuration(*s.EndedAt-*s.CreatedAt))
+		}
+	}
+	if s.PromptTokens != nil || s.CompletionTokens != nil {
+		add("Tokens", fmt.Sprintf("%d in / %d out", valueOrZero(s.PromptTokens), valueOrZero(s.CompletionTokens)))
+	}
+	if s.Cost != nil {
+		add("Cost", fmt.Sprintf("$%.4f", *s.Cost))
+	}
+	if s.MessageCount != nil {
+		add("Messages", fmt.Sprintf("%d", *s.MessageCount))
+	}
+	if s.ToolCallCount != nil {
+		add("Tool calls", fmt.Sprintf("%d", *s.ToolCallCount))
+	}
+	return rows
+}
+
+// toolSummary is the one-line description shown on a collapsed tool call.
+func toolSummary(t *storage.Tool) string {
+	summary := t.ToolName
+	if t.FilePath != nil && *t.FilePath != "" {
+		summary += " " + *t.FilePath
+	}
+	if t.Success != nil && !*t.Success {
+		summary += " (failed)"
+	}
+	if t.DurationMs != nil {
+		summary += " · " + formatDuration(*t.DurationMs)
+	}
+	return summary
+}
+
+func compactionSummary(c *storage.CompactionEvent) string {
+	var parts []string
+	if c.TokensBefore != nil && c.TokensAfter != nil {
+		parts = append(parts, fmt.Sprintf("%d → %d tokens", *c.TokensBefore, *c.TokensAfter))
+	}
+	if c.MessagesBefore != nil && c.MessagesAfter != nil {
+		parts = append(parts, fmt.Sprintf("%d → %d messages", *c.MessagesBefore, *c.MessagesAfter))
+	}
+	if len(parts) == 0 {
+		return "Context compacted"
+	}
+	return "Context compacted: " + strings.Join(parts, ", ")
+}
+
+// prettyJSON indents s if it is a JSON document and returns it unchanged
+// otherwise. The second result reports whether s was JSON.
+func prettyJSON(s string) (string, bool) {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s, false
+	}
+	var v any
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		return s, false
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return s, false
+	}
+	return string(out), true
+}
+
+// roleLabel capitalises a message role for display ("assistant" -> "Assistant").
+func roleLabel(role string) string {
+	if role == "" {
+		return "Message"
+	}
+	return strings.ToUpper(role[:1]) + role[1:]
+}
+
+func entryTime(createdAt *int64) string {
+	if createdAt == nil {
+		return ""
+	}
+	return time.UnixMilli(*createdAt).Format("15:04:05")
+}
+
+func formatTime(ms int64) string {
+	return time.UnixMilli(ms).Format("2006-01-02 15:04:05 MST")
+}
+
+func formatDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	switch {
+	case d < time.Second:
+		return fmt.Sprintf("%dms", ms)
+	case d < time.Minute:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func valueOrZero(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
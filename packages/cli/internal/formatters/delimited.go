@@ -0,0 +1,92 @@
+package formatters
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// CSVFormatter writes RFC 4180 CSV. NULL values become empty fields.
+type CSVFormatter struct {
+	NoHeader bool
+}
+
+func (f *CSVFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if !f.NoHeader {
+		if err := writer.Write(result.ColumnNames()); err != nil {
+			return "", fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	record := make([]string, len(result.Columns))
+	for _, row := range result.Rows {
+		for j := range result.Columns {
+			var v any
+			if j < len(row) {
+				v = row[j]
+			}
+			record[j] = plainValue(v)
+		}
+		if err := writer.Write(record); err != nil {
+			return "", fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// TSVFormatter writes tab-separated values. Tabs, newlines and backslashes
+// inside values are escaped as \t, \n, \r and \\ so every row stays on one
+// line.
+type TSVFormatter struct {
+	NoHeader bool
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (f *TSVFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+
+	if !f.NoHeader {
+		for j, name := range result.ColumnNames() {
+			if j > 0 {
+				sb.WriteByte('\t')
+			}
+			sb.WriteString(tsvEscaper.Replace(name))
+		}
+		sb.WriteByte('\n')
+	}
+
+	for _, row := range result.Rows {
+		for j := range result.Columns {
+			if j > 0 {
+				sb.WriteByte('\t')
+			}
+			var v any
+			if j < len(row) {
+				v = row[j]
+			}
+			sb.WriteString(tsvEscaper.Replace(plainValue(v)))
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String(), nil
+}
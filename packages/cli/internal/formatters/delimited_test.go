@@ -0,0 +1,76 @@
+package formatters
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func delimitedFixture() *ResultSet {
+	return &ResultSet{
+		Columns: []Column{{Name: "id"}, {Name: "title"}, {Name: "cost", Type: "REAL"}},
+		Rows: [][]any{
+			{"s1", `He said "hi", then left`, 0.125},
+			{"s2", "line one\nline two", nil},
+		},
+	}
+}
+
+func TestCSVFormatter(t *testing.T) {
+	output, err := (&CSVFormatter{}).Format(delimitedFixture())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "id,title,cost\n" +
+		"s1,\"He said \"\"hi\"\", then left\",0.125\n" +
+		"s2,\"line one\nline two\",\n"
+	if output != want {
+		t.Fatalf("expected %q, got %q", want, output)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		t.Fatalf("expected output to round-trip through a CSV reader, got %v", err)
+	}
+	if !reflect.DeepEqual(records[1], []string{"s1", `He said "hi", then left`, "0.125"}) {
+		t.Fatalf("unexpected record: %q", records[1])
+	}
+}
+
+func TestCSVFormatterNoHeader(t *testing.T) {
+	output, err := (&CSVFormatter{NoHeader: true}).Format(delimitedFixture())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.HasPrefix(output, "id,") {
+		t.Fatalf("expected no header, got %q", output)
+	}
+}
+
+func TestTSVFormatter(t *testing.T) {
+	result := delimitedFixture()
+	result.Rows = append(result.Rows, []any{"s3", "tab\there", int64(3)})
+
+	output, err := (&TSVFormatter{}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "id\ttitle\tcost\n" +
+		"s1\tHe said \"hi\", then left\t0.125\n" +
+		"s2\tline one\\nline two\t\n" +
+		"s3\ttab\\there\t3\n"
+	if output != want {
+		t.Fatalf("expected %q, got %q", want, output)
+	}
+
+	output, err = (&TSVFormatter{NoHeader: true}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.HasPrefix(output, "id\t") {
+		t.Fatalf("expected no header, got %q", output)
+	}
+}
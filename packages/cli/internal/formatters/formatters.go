@@ -1,136 +1,266 @@
 package formatters
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
+// DefaultMaxWidth is the column width at which table cells are truncated.
+const DefaultMaxWidth = 50
+
+// Column describes one result column. Type is the declared SQLite type and
+// is empty for expressions.
+type Column struct {
+	Name string
+	Type string
+}
+
+// ResultSet is an ordered query result: rows hold values in column order.
+type ResultSet struct {
+	Columns []Column
+	Rows    [][]any
+}
+
+// ColumnNames returns the column names in order.
+func (r *ResultSet) ColumnNames() []string {
+	names := make([]string, len(r.Columns))
+	for i, col := range r.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
 type Formatter interface {
-	Format(rows []map[string]any) (string, error)
+	Format(result *ResultSet) (string, error)
 }
 
 type FormatType string
 
 const (
-	FormatTable FormatType = "table"
-	FormatJSON  FormatType = "json"
+	FormatTable    FormatType = "table"
+	FormatJSON     FormatType = "json"
+	FormatNDJSON   FormatType = "ndjson"
+	FormatCSV      FormatType = "csv"
+	FormatTSV      FormatType = "tsv"
+	FormatMarkdown FormatType = "markdown"
+	FormatYAML     FormatType = "yaml"
 )
 
-func NewFormatter(format FormatType) (Formatter, error) {
+// SupportedFormats lists every format NewFormatter accepts.
+var SupportedFormats = []FormatType{
+	FormatTable, FormatJSON, FormatNDJSON, FormatCSV, FormatTSV, FormatMarkdown, FormatYAML,
+}
+
+type Options struct {
+	MaxWidth int  // table cell width limit; 0 uses DefaultMaxWidth, negative disables truncation
+	NoHeader bool // omit the header row (table, csv, tsv)
+}
+
+func NewFormatter(format FormatType, opts Options) (Formatter, error) {
 	switch format {
 	case FormatTable:
-		return &TableFormatter{}, nil
+		return &TableFormatter{MaxWidth: opts.MaxWidth, NoHeader: opts.NoHeader}, nil
 	case FormatJSON:
 		return &JSONFormatter{}, nil
+	case FormatNDJSON:
+		return &NDJSONFormatter{}, nil
+	case FormatCSV:
+		return &CSVFormatter{NoHeader: opts.NoHeader}, nil
+	case FormatTSV:
+		return &TSVFormatter{NoHeader: opts.NoHeader}, nil
+	case FormatMarkdown, "md":
+		return &MarkdownFormatter{}, nil
+	case FormatYAML, "yml":
+		return &YAMLFormatter{}, nil
 	default:
-		return nil, fmt.Errorf("unknown format: %s (supported: table, json)", format)
+		return nil, fmt.Errorf("unknown format: %s (supported: %s)", format, SupportedFormatList())
+	}
+}
+
+// SupportedFormatList returns the supported formats as a comma-separated list.
+func SupportedFormatList() string {
+	names := make([]string, len(SupportedFormats))
+	for i, f := range SupportedFormats {
+		names[i] = string(f)
 	}
+	return strings.Join(names, ", ")
 }
 
-type TableFormatter struct{}
+type TableFormatter struct {
+	MaxWidth int
+	NoHeader bool
+}
 
-func (f *TableFormatter) Format(rows []map[string]any) (string, error) {
-	if len(rows) == 0 {
+func (f *TableFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil || len(result.Rows) == 0 {
 		return "(no results)\n", nil
 	}
 
-	var columns []string
-	for col := range rows[0] {
-		columns = append(columns, col)
+	maxWidth := f.MaxWidth
+	if maxWidth == 0 {
+		maxWidth = DefaultMaxWidth
 	}
 
-	widths := make(map[string]int)
-	for _, col := range columns {
-		widths[col] = len(col)
+	cells := make([][]string, len(result.Rows))
+	for i, row := range result.Rows {
+		cells[i] = make([]string, len(result.Columns))
+		for j := range result.Columns {
+			var v any
+			if j < len(row) {
+				v = row[j]
+			}
+			cells[i][j] = truncate(singleLine(formatValue(v)), maxWidth)
+		}
 	}
 
-	for _, row := range rows {
-		for _, col := range columns {
-			val := formatValue(row[col])
-			if len(val) > widths[col] {
-				if len(val) > 50 {
-					widths[col] = 50
-				} else {
-					widths[col] = len(val)
-				}
+	widths := make([]int, len(result.Columns))
+	if !f.NoHeader {
+		for j, col := range result.Columns {
+			widths[j] = displayWidth(col.Name)
+		}
+	}
+	for _, row := range cells {
+		for j, val := range row {
+			if w := displayWidth(val); w > widths[j] {
+				widths[j] = w
 			}
 		}
 	}
 
 	var sb strings.Builder
 
-	sb.WriteString("┌")
-	for i, col := range columns {
-		sb.WriteString(strings.Repeat("─", widths[col]+2))
-		if i < len(columns)-1 {
-			sb.WriteString("┬")
-		} else {
-			sb.WriteString("┐")
+	writeBorder := func(left, mid, right string) {
+		sb.WriteString(left)
+		for j, w := range widths {
+			sb.WriteString(strings.Repeat("─", w+2))
+			if j < len(widths)-1 {
+				sb.WriteString(mid)
+			} else {
+				sb.WriteString(right)
+			}
 		}
+		sb.WriteString("\n")
 	}
-	sb.WriteString("\n")
 
-	sb.WriteString("│")
-	for _, col := range columns {
-		sb.WriteString(" ")
-		sb.WriteString(padRight(col, widths[col]))
-		sb.WriteString(" │")
-	}
-	sb.WriteString("\n")
+	writeBorder("┌", "┬", "┐")
 
-	sb.WriteString("├")
-	for i, col := range columns {
-		sb.WriteString(strings.Repeat("─", widths[col]+2))
-		if i < len(columns)-1 {
-			sb.WriteString("┼")
-		} else {
-			sb.WriteString("┤")
+	if !f.NoHeader {
+		sb.WriteString("│")
+		for j, col := range result.Columns {
+			sb.WriteString(" ")
+			sb.WriteString(padRight(col.Name, widths[j]))
+			sb.WriteString(" │")
 		}
+		sb.WriteString("\n")
+
+		writeBorder("├", "┼", "┤")
 	}
-	sb.WriteString("\n")
 
-	for _, row := range rows {
+	for _, row := range cells {
 		sb.WriteString("│")
-		for _, col := range columns {
+		for j, val := range row {
 			sb.WriteString(" ")
-			val := formatValue(row[col])
-			if len(val) > 50 {
-				val = val[:47] + "..."
+			if isNumericType(result.Columns[j].Type) {
+				sb.WriteString(padLeft(val, widths[j]))
+			} else {
+				sb.WriteString(padRight(val, widths[j]))
 			}
-			sb.WriteString(padRight(val, widths[col]))
 			sb.WriteString(" │")
 		}
 		sb.WriteString("\n")
 	}
 
-	sb.WriteString("└")
-	for i, col := range columns {
-		sb.WriteString(strings.Repeat("─", widths[col]+2))
-		if i < len(columns)-1 {
-			sb.WriteString("┴")
-		} else {
-			sb.WriteString("┘")
-		}
-	}
-	sb.WriteString("\n")
+	writeBorder("└", "┴", "┘")
 
 	return sb.String(), nil
 }
 
 type JSONFormatter struct{}
 
-func (f *JSONFormatter) Format(rows []map[string]any) (string, error) {
-	if rows == nil {
-		rows = []map[string]any{}
+func (f *JSONFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil || len(result.Rows) == 0 {
+		return "[]\n", nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("[\n")
+	for i, row := range result.Rows {
+		obj, err := marshalRow(result.Columns, row)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, obj, "  ", "  "); err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+
+		buf.WriteString("  ")
+		buf.Write(indented.Bytes())
+		if i < len(result.Rows)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+
+	return buf.String(), nil
+}
+
+// NDJSONFormatter writes one compact JSON object per row, for streaming
+// consumers such as jq.
+type NDJSONFormatter struct{}
+
+func (f *NDJSONFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil {
+		return "", nil
 	}
 
-	data, err := json.MarshalIndent(rows, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	var buf bytes.Buffer
+	for _, row := range result.Rows {
+		obj, err := marshalRow(result.Columns, row)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		buf.Write(obj)
+		buf.WriteByte('\n')
 	}
 
-	return string(data) + "\n", nil
+	return buf.String(), nil
+}
+
+// marshalRow encodes one row as a JSON object whose keys follow column order.
+func marshalRow(columns []Column, row []any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for j, col := range columns {
+		if j > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if j < len(row) {
+			v = row[j]
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
 }
 
 func formatValue(v any) string {
@@ -157,9 +287,71 @@ func formatValue(v any) string {
 	}
 }
 
+// plainValue renders v for machine-readable formats: NULL becomes an empty
+// string and floats keep full precision.
+func plainValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return formatValue(v)
+	}
+}
+
+func isNumericType(declType string) bool {
+	switch strings.ToUpper(declType) {
+	case "INTEGER", "INT", "BIGINT", "REAL", "DOUBLE", "FLOAT", "NUMERIC":
+		return true
+	default:
+		return false
+	}
+}
+
+// singleLine keeps multi-line values from breaking table rows.
+func singleLine(s string) string {
+	if !strings.ContainsAny(s, "\r\n\t") {
+		return s
+	}
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(s)
+}
+
+// truncate shortens s to at most maxWidth display columns, ending in "...".
+func truncate(s string, maxWidth int) string {
+	if maxWidth < 0 || displayWidth(s) <= maxWidth {
+		return s
+	}
+	if maxWidth <= 3 {
+		return strings.Repeat(".", maxWidth)
+	}
+
+	var sb strings.Builder
+	width := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if width+w > maxWidth-3 {
+			break
+		}
+		sb.WriteRune(r)
+		width += w
+	}
+	sb.WriteString("...")
+	return sb.String()
+}
+
 func padRight(s string, width int) string {
-	if len(s) >= width {
+	w := displayWidth(s)
+	if w >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-w)
+}
+
+func padLeft(s string, width int) string {
+	w := displayWidth(s)
+	if w >= width {
 		return s
 	}
-	return s + strings.Repeat(" ", width-len(s))
+	return strings.Repeat(" ", width-w) + s
 }
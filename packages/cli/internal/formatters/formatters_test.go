@@ -9,11 +9,12 @@ import (
 func TestTableFormatter(t *testing.T) {
 	formatter := &TableFormatter{}
 	longValue := strings.Repeat("a", 60)
-	rows := []map[string]interface{}{
-		{"content": longValue},
+	result := &ResultSet{
+		Columns: []Column{{Name: "content", Type: "TEXT"}},
+		Rows:    [][]any{{longValue}},
 	}
 
-	output, err := formatter.Format(rows)
+	output, err := formatter.Format(result)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -29,7 +30,7 @@ func TestTableFormatter(t *testing.T) {
 
 func TestTableFormatterEmpty(t *testing.T) {
 	formatter := &TableFormatter{}
-	output, err := formatter.Format([]map[string]interface{}{})
+	output, err := formatter.Format(&ResultSet{Columns: []Column{{Name: "id"}}})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -38,13 +39,79 @@ func TestTableFormatterEmpty(t *testing.T) {
 	}
 }
 
+func TestTableFormatterColumnOrder(t *testing.T) {
+	formatter := &TableFormatter{}
+	result := &ResultSet{
+		Columns: []Column{{Name: "zeta"}, {Name: "alpha"}, {Name: "mid"}},
+		Rows:    [][]any{{"z", "a", "m"}},
+	}
+
+	for i := 0; i < 10; i++ {
+		output, err := formatter.Format(result)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		header := strings.Split(output, "\n")[1]
+		if !(strings.Index(header, "zeta") < strings.Index(header, "alpha") &&
+			strings.Index(header, "alpha") < strings.Index(header, "mid")) {
+			t.Fatalf("expected columns in declared order, got %q", header)
+		}
+	}
+}
+
+func TestTableFormatterUnicodeWidth(t *testing.T) {
+	formatter := &TableFormatter{}
+	result := &ResultSet{
+		Columns: []Column{{Name: "name"}},
+		Rows:    [][]any{{"café"}, {"日本語"}, {"ok"}},
+	}
+
+	output, err := formatter.Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	want := displayWidth(lines[0])
+	for _, line := range lines {
+		if got := displayWidth(line); got != want {
+			t.Fatalf("expected every line to be %d columns wide, got %d for %q", want, got, line)
+		}
+	}
+}
+
+func TestTableFormatterMaxWidth(t *testing.T) {
+	value := strings.Repeat("b", 30)
+	result := &ResultSet{
+		Columns: []Column{{Name: "v"}},
+		Rows:    [][]any{{value}},
+	}
+
+	output, err := (&TableFormatter{MaxWidth: 10}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(output, "bbbbbbb...") || strings.Contains(output, value) {
+		t.Fatalf("expected value truncated to 10 columns, got %q", output)
+	}
+
+	output, err = (&TableFormatter{MaxWidth: -1}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(output, value) {
+		t.Fatalf("expected untruncated value, got %q", output)
+	}
+}
+
 func TestJSONFormatter(t *testing.T) {
 	formatter := &JSONFormatter{}
-	rows := []map[string]interface{}{
-		{"id": "row-1", "count": int64(2)},
+	result := &ResultSet{
+		Columns: []Column{{Name: "id"}, {Name: "count"}},
+		Rows:    [][]any{{"row-1", int64(2)}},
 	}
 
-	output, err := formatter.Format(rows)
+	output, err := formatter.Format(result)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -64,14 +131,95 @@ func TestJSONFormatter(t *testing.T) {
 	}
 }
 
+func TestJSONFormatterColumnOrder(t *testing.T) {
+	formatter := &JSONFormatter{}
+	result := &ResultSet{
+		Columns: []Column{{Name: "zeta"}, {Name: "alpha"}},
+		Rows:    [][]any{{"z", nil}},
+	}
+
+	output, err := formatter.Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "[\n  {\n    \"zeta\": \"z\",\n    \"alpha\": null\n  }\n]\n"
+	if output != want {
+		t.Fatalf("expected %q, got %q", want, output)
+	}
+}
+
+func TestJSONFormatterEmpty(t *testing.T) {
+	output, err := (&JSONFormatter{}).Format(&ResultSet{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output != "[]\n" {
+		t.Fatalf("expected empty array, got %q", output)
+	}
+}
+
+func TestNDJSONFormatter(t *testing.T) {
+	result := &ResultSet{
+		Columns: []Column{{Name: "b"}, {Name: "a"}},
+		Rows:    [][]any{{"x", int64(1)}, {"y", nil}},
+	}
+
+	output, err := (&NDJSONFormatter{}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "{\"b\":\"x\",\"a\":1}\n{\"b\":\"y\",\"a\":null}\n"
+	if output != want {
+		t.Fatalf("expected %q, got %q", want, output)
+	}
+}
+
+func TestTableFormatterNoHeader(t *testing.T) {
+	result := &ResultSet{
+		Columns: []Column{{Name: "long_column_name"}},
+		Rows:    [][]any{{"v"}},
+	}
+
+	output, err := (&TableFormatter{NoHeader: true}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Contains(output, "long_column_name") || strings.Contains(output, "├") {
+		t.Fatalf("expected no header row, got %q", output)
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := map[string]int{
+		"abc":        3,
+		"café":       4,
+		"cafe\u0301": 4, // combining accent
+		"日本":         4,
+		"🚀":          2,
+		"":           0,
+	}
+	for input, want := range tests {
+		if got := displayWidth(input); got != want {
+			t.Errorf("displayWidth(%q) = %d, want %d", input, got, want)
+		}
+	}
+}
+
 func TestNewFormatter(t *testing.T) {
-	if _, err := NewFormatter(FormatTable); err != nil {
+	if _, err := NewFormatter(FormatTable, Options{}); err != nil {
 		t.Fatalf("expected no error for table, got %v", err)
 	}
-	if _, err := NewFormatter(FormatJSON); err != nil {
+	if _, err := NewFormatter(FormatJSON, Options{}); err != nil {
 		t.Fatalf("expected no error for json, got %v", err)
 	}
-	if _, err := NewFormatter(FormatType("csv")); err == nil {
+	for _, format := range SupportedFormats {
+		if _, err := NewFormatter(format, Options{}); err != nil {
+			t.Fatalf("expected no error for %s, got %v", format, err)
+		}
+	}
+	if _, err := NewFormatter(FormatType("xml"), Options{}); err == nil {
 		t.Fatalf("expected error for unknown format")
 	}
 }
@@ -0,0 +1,55 @@
+package formatters
+
+import "strings"
+
+// MarkdownFormatter writes a GitHub-flavoured Markdown table. GFM tables
+// require a header row, so there is no NoHeader option.
+type MarkdownFormatter struct{}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"|", `\|`,
+	"\r\n", "<br>",
+	"\n", "<br>",
+	"\r", "<br>",
+)
+
+func (f *MarkdownFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil || len(result.Columns) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("|")
+	for _, col := range result.Columns {
+		sb.WriteString(" ")
+		sb.WriteString(markdownEscaper.Replace(col.Name))
+		sb.WriteString(" |")
+	}
+	sb.WriteString("\n|")
+	for _, col := range result.Columns {
+		if isNumericType(col.Type) {
+			sb.WriteString(" ---: |")
+		} else {
+			sb.WriteString(" --- |")
+		}
+	}
+	sb.WriteString("\n")
+
+	for _, row := range result.Rows {
+		sb.WriteString("|")
+		for j := range result.Columns {
+			var v any
+			if j < len(row) {
+				v = row[j]
+			}
+			sb.WriteString(" ")
+			sb.WriteString(markdownEscaper.Replace(formatValue(v)))
+			sb.WriteString(" |")
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String(), nil
+}
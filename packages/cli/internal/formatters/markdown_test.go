@@ -0,0 +1,26 @@
+package formatters
+
+import "testing"
+
+func TestMarkdownFormatter(t *testing.T) {
+	result := &ResultSet{
+		Columns: []Column{{Name: "id"}, {Name: "note"}, {Name: "tokens", Type: "INTEGER"}},
+		Rows: [][]any{
+			{"s1", "a | b", int64(42)},
+			{"s2", "first\nsecond", nil},
+		},
+	}
+
+	output, err := (&MarkdownFormatter{}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "| id | note | tokens |\n" +
+		"| --- | --- | ---: |\n" +
+		"| s1 | a \\| b | 42 |\n" +
+		"| s2 | first<br>second | NULL |\n"
+	if output != want {
+		t.Fatalf("expected %q, got %q", want, output)
+	}
+}
@@ -0,0 +1,114 @@
+package formatters
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// YAMLFormatter writes rows as a YAML sequence of mappings. Keys keep column
+// order. Strings that YAML could read as another type are double-quoted.
+type YAMLFormatter struct{}
+
+func (f *YAMLFormatter) Format(result *ResultSet) (string, error) {
+	if result == nil || len(result.Rows) == 0 {
+		return "[]\n", nil
+	}
+
+	var sb strings.Builder
+	for _, row := range result.Rows {
+		for j, col := range result.Columns {
+			if j == 0 {
+				sb.WriteString("- ")
+			} else {
+				sb.WriteString("  ")
+			}
+			var v any
+			if j < len(row) {
+				v = row[j]
+			}
+			sb.WriteString(yamlString(col.Name))
+			sb.WriteString(": ")
+			sb.WriteString(yamlScalar(v))
+			sb.WriteString("\n")
+		}
+		if len(result.Columns) == 0 {
+			sb.WriteString("- {}\n")
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func yamlScalar(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			return ".nan"
+		case math.IsInf(val, 1):
+			return ".inf"
+		case math.IsInf(val, -1):
+			return "-.inf"
+		}
+		s := strconv.FormatFloat(val, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case string:
+		return yamlString(val)
+	case []byte:
+		return yamlString(string(val))
+	default:
+		return yamlString(fmt.Sprintf("%v", val))
+	}
+}
+
+// yamlReserved are plain scalars YAML 1.1 or 1.2 parsers resolve to
+// booleans or null.
+var yamlReserved = map[string]bool{
+	"": true, "~": true, "null": true, "true": true, "false": true,
+	"yes": true, "no": true, "on": true, "off": true, "y": true, "n": true,
+}
+
+// yamlString emits s as a plain scalar when that is unambiguous and as a
+// double-quoted scalar otherwise. JSON string syntax is valid YAML.
+func yamlString(s string) string {
+	if yamlPlainSafe(s) {
+		return s
+	}
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+func yamlPlainSafe(s string) bool {
+	if yamlReserved[strings.ToLower(s)] || strings.HasSuffix(s, " ") {
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == '/':
+		case r >= '0' && r <= '9', r == ' ', r == '.', r == '-', r == '(', r == ')', r == ',':
+			// Leading digits, dots and dashes can start numbers, dates or
+			// sequence entries.
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
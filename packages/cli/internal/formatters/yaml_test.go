@@ -0,0 +1,61 @@
+package formatters
+
+import "testing"
+
+func TestYAMLFormatter(t *testing.T) {
+	result := &ResultSet{
+		Columns: []Column{{Name: "id"}, {Name: "title"}, {Name: "cost"}, {Name: "ended_at"}, {Name: "flag"}},
+		Rows: [][]any{
+			{"s1", "Fix: the bug", 0.5, nil, "yes"},
+			{"s2", "plain title", float64(2), int64(7), "123"},
+		},
+	}
+
+	output, err := (&YAMLFormatter{}).Format(result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := "- id: s1\n" +
+		"  title: \"Fix: the bug\"\n" +
+		"  cost: 0.5\n" +
+		"  ended_at: null\n" +
+		"  flag: \"yes\"\n" +
+		"- id: s2\n" +
+		"  title: plain title\n" +
+		"  cost: 2.0\n" +
+		"  ended_at: 7\n" +
+		"  flag: \"123\"\n"
+	if output != want {
+		t.Fatalf("expected %q, got %q", want, output)
+	}
+}
+
+func TestYAMLFormatterEmpty(t *testing.T) {
+	output, err := (&YAMLFormatter{}).Format(&ResultSet{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output != "[]\n" {
+		t.Fatalf("expected empty sequence, got %q", output)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	tests := map[string]string{
+		"hello world": "hello world",
+		"":            `""`,
+		"null":        `"null"`,
+		"Off":         `"Off"`,
+		"-dash":       `"-dash"`,
+		"2026-01-02":  `"2026-01-02"`,
+		"a #comment":  `"a #comment"`,
+		"multi\nline": `"multi\nline"`,
+		"/tmp/x.db":   "/tmp/x.db",
+	}
+	for input, want := range tests {
+		if got := yamlString(input); got != want {
+			t.Errorf("yamlString(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Package httpapi serves the daemon's read and write methods as REST/JSON,
+// for clients that speak HTTP but not JSON-RPC. Every route calls the same
+// rpc.Handler as the socket, so validation, schema upgrades, journaling and
+// live events behave the same.
+package httpapi
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/logging"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Request headers that stand in for the JSON-RPC envelope.
+const (
+	ClientHeader = "X-Clankers-Client"         // name/version
+	SchemaHeader = "X-Clankers-Schema-Version" // defaulted as on the socket when absent
+)
+
+// defaultClientName identifies writes that carry no ClientHeader.
+const defaultClientName = "http-api"
+
+// defaultLimit is the page size of GET /v1/sessions without a limit.
+const defaultLimit = 100
+
+// maxBodyBytes bounds a request body, batches included.
+const maxBodyBytes = 16 << 20
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Error is the body of every non-2xx response. Code is the JSON-RPC error
+// code the method returned.
+type Error struct {
+	Code    int64            `json:"code"`
+	Message string           `json:"message"`
+	Data    *json.RawMessage `json:"data,omitempty"`
+}
+
+type server struct {
+	handler *rpc.Handler
+	token   string
+	logger  *logging.Logger
+}
+
+// New returns the API's routes. Every route except health and the OpenAPI
+// document needs "Authorization: Bearer <token>".
+func New(handler *rpc.Handler, token string, logger *logging.Logger) http.Handler {
+	s := &server{handler: handler, token: token, logger: logger}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", s.health)
+	mux.HandleFunc("GET /v1/openapi.json", serveOpenAPI)
+
+	mux.HandleFunc("GET /v1/sessions", s.authorized(s.listSessions))
+	mux.HandleFunc("GET /v1/sessions/{id}", s.authorized(s.getSession))
+	mux.HandleFunc("GET /v1/sessions/{id}/tools", s.authorized(s.getTools))
+	mux.HandleFunc("GET /v1/query", s.authorized(s.query))
+	mux.HandleFunc("POST /v1/query", s.authorized(s.query))
+	mux.HandleFunc("GET /v1/stats", s.authorized(s.stats))
+
+	mux.HandleFunc("POST /v1/sessions", s.authorized(s.upsert("upsertSession", "session")))
+	mux.HandleFunc("POST /v1/messages", s.authorized(s.upsert("upsertMessage", "message")))
+	mux.HandleFunc("POST /v1/tools", s.authorized(s.upsert("upsertTool", "tool")))
+	mux.HandleFunc("POST /v1/session-errors", s.authorized(s.upsert("upsertSessionError", "sessionError")))
+	mux.HandleFunc("POST /v1/compaction-events", s.authorized(s.upsert("upsertCompactionEvent", "compactionEvent")))
+	mux.HandleFunc("POST /v1/batch", s.authorized(s.batch))
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: "no route for " + r.Method + " " + r.URL.Path})
+	})
+	return mux
+}
+
+// authorized rejects requests without the daemon's bearer token.
+func (s *server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			s.logger.Warnf("http", "rejected %s %s from %s: missing or invalid token", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="clankers"`)
+			writeError(w, &jsonrpc2.Error{Code: rpc.CodeUnauthorized, Message: "missing or invalid token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// call runs method with params and writes its result or error.
+func (s *server) call(w http.ResponseWriter, r *http.Request, method string, params any) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	raw := json.RawMessage(data)
+
+	result, err := s.handler.Call(r.Context(), method, &raw)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	s.call(w, r, "health", struct{}{})
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+func (s *server) listSessions(w http.ResponseWriter, r *http.Request) {
+	filter, err := sessionFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	filter.Sort = storage.SessionSort(q.Get("sort"))
+	filter.Cursor = q.Get("cursor")
+	switch order := q.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		writeError(w, invalidParam("order", order, "asc or desc"))
+		return
+	}
+	filter.Limit = defaultLimit
+	if limit := q.Get("limit"); limit != "" {
+		// 0 returns every matching session.
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			writeError(w, invalidParam("limit", limit, "a non-negative integer"))
+			return
+		}
+	}
+
+	s.call(w, r, "listSessions", rpc.ListSessionsParams{RequestEnvelope: readEnvelope(r), Filter: filter})
+}
+
+// getSession returns the session with its messages, tool calls, errors and
+// compactions in time order.
+func (s *server) getSession(w http.ResponseWriter, r *http.Request) {
+	s.call(w, r, "getSession", rpc.GetSessionParams{RequestEnvelope: readEnvelope(r), ID: r.PathValue("id")})
+}
+
+func (s *server) getTools(w http.ResponseWriter, r *http.Request) {
+	s.call(w, r, "getTools", rpc.GetToolsParams{RequestEnvelope: readEnvelope(r), SessionID: r.PathValue("id")})
+}
+
+// query takes the statement as ?sql= on GET, or as {"sql": ...} on POST for
+// statements too long for a URL.
+func (s *server) query(w http.ResponseWriter, r *http.Request) {
+	params := rpc.QueryParams{SQL: r.URL.Query().Get("sql")}
+	if r.Method == http.MethodPost {
+		if err := decodeBody(w, r, &params); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	params.RequestEnvelope = readEnvelope(r)
+	s.call(w, r, "query", params)
+}
+
+func (s *server) stats(w http.ResponseWriter, r *http.Request) {
+	filter, err := sessionFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.call(w, r, "stats", rpc.StatsParams{RequestEnvelope: readEnvelope(r), Filter: filter})
+}
+
+// upsert returns a handler that sends the body, one record, to method as
+// params[field].
+func (s *server) upsert(method, field string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var record json.RawMessage
+		if err := decodeBody(w, r, &record); err != nil {
+			writeError(w, err)
+			return
+		}
+		params, err := envelope(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		params[field] = record
+		s.call(w, r, method, params)
+	}
+}
+
+// batch sends the body, {"items": [...]}, to ingestBatch. An envelope in the
+// body takes precedence over the headers.
+func (s *server) batch(w http.ResponseWriter, r *http.Request) {
+	var body map[string]json.RawMessage
+	if err := decodeBody(w, r, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	params, err := envelope(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for k, v := range body {
+		params[k] = v
+	}
+	s.call(w, r, "ingestBatch", params)
+}
+
+// clientInfo reads ClientHeader.
+func clientInfo(r *http.Request) rpc.ClientInfo {
+	client := rpc.ClientInfo{Name: defaultClientName}
+	if header := r.Header.Get(ClientHeader); header != "" {
+		client.Name, client.Version, _ = strings.Cut(header, "/")
+	}
+	return client
+}
+
+// readEnvelope is the envelope of a read. Only record writes have an older
+// shape (v0), so SchemaHeader is not consulted.
+func readEnvelope(r *http.Request) rpc.RequestEnvelope {
+	return rpc.RequestEnvelope{SchemaVersion: rpc.CurrentSchemaVersion, Client: clientInfo(r)}
+}
+
+// envelope builds a write's client and schemaVersion from the request
+// headers.
+func envelope(r *http.Request) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(clientInfo(r))
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]json.RawMessage{"client": data}
+
+	if version := r.Header.Get(SchemaHeader); version != "" {
+		if data, err = json.Marshal(version); err != nil {
+			return nil, err
+		}
+		params["schemaVersion"] = data
+	}
+	return params, nil
+}
+
+// decodeBody reads one JSON value of at most maxBodyBytes into v.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err := decoder.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return invalidParams("missing request body")
+		}
+		return invalidParams("invalid request body: " + err.Error())
+	}
+	if decoder.More() {
+		return invalidParams("invalid request body: more than one JSON value")
+	}
+	return nil
+}
+
+// sessionFilter reads the filter query parameters shared by sessions and
+// stats.
+func sessionFilter(r *http.Request) (storage.SessionFilter, error) {
+	q := r.URL.Query()
+	filter := storage.SessionFilter{
+		Project: q.Get("project"),
+		Source:  q.Get("source"),
+		Model:   q.Get("model"),
+		Status:  q.Get("status"),
+	}
+
+	var err error
+	if filter.Since, err = parseTime(q.Get("since")); err != nil {
+		return filter, invalidParam("since", q.Get("since"), "unix milliseconds or RFC 3339")
+	}
+	if filter.Until, err = parseTime(q.Get("until")); err != nil {
+		return filter, invalidParam("until", q.Get("until"), "unix milliseconds or RFC 3339")
+	}
+	return filter, nil
+}
+
+// parseTime accepts unix milliseconds, as Grafana sends them, or RFC 3339.
+// Empty is zero, i.e. unbounded.
+func parseTime(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+func invalidParams(message string) error {
+	return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: message}
+}
+
+func invalidParam(name, value, expected string) error {
+	return invalidParams(fmt.Sprintf("invalid %s %q: expected %s", name, value, expected))
+}
+
+// statusFor maps a method's error code to an HTTP status.
+func statusFor(code int64) int {
+	switch code {
+	case jsonrpc2.CodeParseError, jsonrpc2.CodeInvalidParams, rpc.CodeInvalidPayload, rpc.CodeIncompatibleSchema:
+		return http.StatusBadRequest
+	case rpc.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case rpc.CodeWriteNotAllowed:
+		return http.StatusForbidden
+	case rpc.CodeNotFound, jsonrpc2.CodeMethodNotFound:
+		return http.StatusNotFound
+	case rpc.CodeShuttingDown:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	body := Error{Code: jsonrpc2.CodeInternalError, Message: err.Error()}
+	var rpcErr *jsonrpc2.Error
+	if errors.As(err, &rpcErr) {
+		body = Error{Code: rpcErr.Code, Message: rpcErr.Message, Data: rpcErr.Data}
+	}
+	writeJSON(w, statusFor(body.Code), struct {
+		Error Error `json:"error"`
+	}{body})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
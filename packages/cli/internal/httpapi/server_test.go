@@ -0,0 +1,272 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dxta-dev/clankers/internal/ingest"
+	"github.com/dxta-dev/clankers/internal/logging"
+	"github.com/dxta-dev/clankers/internal/rpc"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+const testToken = "secret"
+
+func createServer(t *testing.T) (*httptest.Server, *rpc.Handler) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "http_test.db")
+	if _, err := storage.EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	logger, err := logging.New("error", filepath.Join(dir, "logs"))
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+
+	writes := ingest.NewQueue(store, logger, ingest.Options{})
+	t.Cleanup(writes.Close)
+
+	handler := rpc.NewHandler(store, writes, nil, logger)
+	server := httptest.NewServer(New(handler, testToken, logger))
+	t.Cleanup(server.Close)
+	return server, handler
+}
+
+// do sends an authorized request and decodes the response into v, which may
+// be nil. It returns the status code.
+func do(t *testing.T, server *httptest.Server, method, path, body string, v any) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set(ClientHeader, "test/1.0")
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: expected a JSON response, got %q", method, path, ct)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: failed to decode response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type errorBody struct {
+	Error Error `json:"error"`
+}
+
+func expectError(t *testing.T, server *httptest.Server, method, path, body string, status int, code int64) {
+	t.Helper()
+	var got errorBody
+	if s := do(t, server, method, path, body, &got); s != status || got.Error.Code != code {
+		t.Errorf("%s %s: expected %d with code %d, got %d with %+v", method, path, status, code, s, got.Error)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	server, _ := createServer(t)
+
+	for _, path := range []string{"/v1/health", "/v1/openapi.json"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200 without a token, got %d", path, resp.StatusCode)
+		}
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", testToken} {
+		req, _ := http.NewRequest("GET", server.URL+"/v1/sessions", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("GET /v1/sessions: %v", err)
+		}
+		var got errorBody
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || got.Error.Code != rpc.CodeUnauthorized {
+			t.Errorf("%q: expected 401 with code %d, got %d with %+v", auth, rpc.CodeUnauthorized, resp.StatusCode, got.Error)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+
+	routes := []string{
+		"GET /v1/health", "GET /v1/openapi.json",
+		"GET /v1/sessions", "POST /v1/sessions", "GET /v1/sessions/{id}", "GET /v1/sessions/{id}/tools",
+		"GET /v1/query", "POST /v1/query", "GET /v1/stats",
+		"POST /v1/messages", "POST /v1/tools", "POST /v1/session-errors", "POST /v1/compaction-events", "POST /v1/batch",
+	}
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("expected %s to be documented", route)
+		}
+	}
+}
+
+func TestWritesAndReads(t *testing.T) {
+	server, _ := createServer(t)
+
+	var ok rpc.OkResult
+	if s := do(t, server, "POST", "/v1/sessions", `{"id": "ses_1", "projectName": "alpha", "source": "opencode", "cost": 1.5, "createdAt": 1}`, &ok); s != http.StatusOK || !ok.OK {
+		t.Fatalf("expected the session to be written, got %d", s)
+	}
+	var batch rpc.IngestBatchResult
+	s := do(t, server, "POST", "/v1/batch", `{"items": [
+		{"kind": "session", "session": {"id": "ses_2", "projectName": "beta", "source": "claude-code", "createdAt": 2}},
+		{"kind": "message", "message": {"id": "m1", "sessionId": "ses_1", "role": "user", "textContent": "hi", "createdAt": 3}},
+		{"kind": "tool", "tool": {"id": "t1", "sessionId": "ses_1", "createdAt": 4}}
+	]}`, &batch)
+	if s != http.StatusOK || batch.Applied != 2 || batch.Failed != 1 {
+		t.Fatalf("expected 2 applied and the tool without a name rejected, got %d %+v", s, batch)
+	}
+	expectError(t, server, "POST", "/v1/tools", `{"id": "t1", "sessionId": "ses_1", "createdAt": 4}`, http.StatusBadRequest, rpc.CodeInvalidPayload)
+	if s := do(t, server, "POST", "/v1/tools", `{"id": "t1", "sessionId": "ses_1", "toolName": "Read", "createdAt": 4}`, nil); s != http.StatusOK {
+		t.Fatalf("expected the tool to be written, got %d", s)
+	}
+
+	t.Run("sessions", func(t *testing.T) {
+		var page storage.SessionPage
+		if s := do(t, server, "GET", "/v1/sessions?limit=1", "", &page); s != http.StatusOK {
+			t.Fatalf("expected 200, got %d", s)
+		}
+		if len(page.Sessions) != 1 || page.Sessions[0].ID != "ses_2" || page.NextCursor == "" {
+			t.Fatalf("expected the newest session and a cursor, got %+v", page)
+		}
+		var last storage.SessionPage
+		do(t, server, "GET", "/v1/sessions?limit=1&cursor="+url.QueryEscape(page.NextCursor), "", &last)
+		if len(last.Sessions) != 1 || last.Sessions[0].ID != "ses_1" || last.NextCursor != "" {
+			t.Errorf("expected the last page with ses_1, got %+v", last)
+		}
+
+		var filtered storage.SessionPage
+		do(t, server, "GET", "/v1/sessions?source=claude-code&order=asc", "", &filtered)
+		if len(filtered.Sessions) != 1 || filtered.Sessions[0].ID != "ses_2" {
+			t.Errorf("expected only ses_2, got %+v", filtered)
+		}
+
+		expectError(t, server, "GET", "/v1/sessions?limit=-1", "", http.StatusBadRequest, jsonrpc2.CodeInvalidParams)
+		expectError(t, server, "GET", "/v1/sessions?since=yesterday", "", http.StatusBadRequest, jsonrpc2.CodeInvalidParams)
+		expectError(t, server, "GET", "/v1/sessions?sort=title", "", http.StatusBadRequest, jsonrpc2.CodeInvalidParams)
+	})
+
+	t.Run("session detail", func(t *testing.T) {
+		var transcript storage.Transcript
+		if s := do(t, server, "GET", "/v1/sessions/ses_1", "", &transcript); s != http.StatusOK {
+			t.Fatalf("expected 200, got %d", s)
+		}
+		if transcript.Session.ID != "ses_1" || len(transcript.Entries) != 2 {
+			t.Errorf("expected ses_1 with a message and a tool, got %+v", transcript)
+		}
+		expectError(t, server, "GET", "/v1/sessions/missing", "", http.StatusNotFound, rpc.CodeNotFound)
+
+		var tools rpc.GetToolsResult
+		do(t, server, "GET", "/v1/sessions/ses_1/tools", "", &tools)
+		if len(tools.Tools) != 1 || tools.Tools[0].ToolName != "Read" {
+			t.Errorf("expected the Read tool, got %+v", tools)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		var result storage.QueryResult
+		if s := do(t, server, "GET", "/v1/query?sql="+url.QueryEscape("SELECT COUNT(*) AS n FROM sessions"), "", &result); s != http.StatusOK {
+			t.Fatalf("expected 200, got %d", s)
+		}
+		if len(result.Rows) != 1 || result.Rows[0][0] != int64(2) {
+			t.Errorf("expected 2 sessions, got %+v", result)
+		}
+		var posted storage.QueryResult
+		do(t, server, "POST", "/v1/query", `{"sql": "SELECT id FROM messages"}`, &posted)
+		if len(posted.Rows) != 1 || posted.Rows[0][0] != "m1" {
+			t.Errorf("expected m1, got %+v", posted)
+		}
+
+		expectError(t, server, "POST", "/v1/query", `{"sql": "DELETE FROM sessions"}`, http.StatusForbidden, rpc.CodeWriteNotAllowed)
+		expectError(t, server, "POST", "/v1/query", `{"sql": `, http.StatusBadRequest, jsonrpc2.CodeInvalidParams)
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		var stats storage.Stats
+		if s := do(t, server, "GET", "/v1/stats?project=alpha", "", &stats); s != http.StatusOK {
+			t.Fatalf("expected 200, got %d", s)
+		}
+		want := storage.StatsTotals{Sessions: 1, Messages: 1, ToolCalls: 1, Cost: 1.5}
+		if stats.Totals != want {
+			t.Errorf("expected %+v, got %+v", want, stats.Totals)
+		}
+	})
+
+	expectError(t, server, "DELETE", "/v1/sessions/ses_1", "", http.StatusNotFound, jsonrpc2.CodeMethodNotFound)
+}
+
+func TestStatusAndDrain(t *testing.T) {
+	server, handler := createServer(t)
+	ctx := context.Background()
+
+	if s := do(t, server, "POST", "/v1/sessions", `{"id": "ses_1", "createdAt": 1}`, nil); s != http.StatusOK {
+		t.Fatalf("expected the session to be written, got %d", s)
+	}
+	result, err := handler.Call(ctx, "status", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var found bool
+	for _, c := range result.(*rpc.StatusResult).Clients {
+		if c.Client == (rpc.ClientInfo{Name: "test", Version: "1.0"}) {
+			found = c.Requests == 1 && c.LastWrite != 0
+		}
+	}
+	if !found {
+		t.Errorf("expected the HTTP client with one write in status, got %+v", result.(*rpc.StatusResult).Clients)
+	}
+
+	if err := handler.Drain(ctx); err != nil {
+		t.Fatalf("failed to drain: %v", err)
+	}
+	expectError(t, server, "POST", "/v1/sessions", `{"id": "ses_2", "createdAt": 2}`, http.StatusServiceUnavailable, rpc.CodeShuttingDown)
+	expectError(t, server, "GET", "/v1/sessions", "", http.StatusServiceUnavailable, rpc.CodeShuttingDown)
+}
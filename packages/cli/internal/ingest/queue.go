@@ -0,0 +1,253 @@
+// Package ingest serialises daemon writes through a single group-commit
+// writer.
+//
+// RPC handlers submit ops and block until the transaction containing them
+// has committed. The writer collects submissions for up to MaxDelay or
+// MaxBatch ops, whichever comes first, and applies them in one transaction.
+// Submissions are applied in the order they were enqueued and are never
+// split across transactions, so writes for a session commit in the order
+// the daemon received them.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/logging"
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+const (
+	DefaultMaxBatch = 500
+	DefaultMaxDelay = 2 * time.Millisecond
+	DefaultCapacity = 1024
+)
+
+// ErrClosed is returned by Submit after Close.
+var ErrClosed = errors.New("write queue is closed")
+
+// Op is one write, run inside the group transaction. An error fails only
+// this op; the Batch upsert rolls back to a savepoint taken before it, so
+// none of its statements are kept, and the transaction continues.
+type Op func(*storage.Batch) (storage.Change, error)
+
+// Result is the outcome of one op.
+type Result struct {
+	Change storage.Change
+	Err    error
+}
+
+type Options struct {
+	MaxBatch int           // ops per transaction before committing early
+	MaxDelay time.Duration // how long to wait for more ops after the first
+	Capacity int           // queued submissions before Submit blocks
+}
+
+// Stats are point-in-time queue metrics.
+type Stats struct {
+	Depth          int64 `json:"depth"`          // ops waiting or in the open transaction
+	MaxDepth       int64 `json:"maxDepth"`       // highest depth since start
+	Enqueued       int64 `json:"enqueued"`       // ops accepted since start
+	Committed      int64 `json:"committed"`      // ops committed successfully
+	Failed         int64 `json:"failed"`         // ops that returned an error or lost their commit
+	Batches        int64 `json:"batches"`        // transactions committed or attempted
+	LastBatchSize  int64 `json:"lastBatchSize"`  // ops in the most recent transaction
+	LastCommitUsec int64 `json:"lastCommitUsec"` // duration of the most recent transaction
+}
+
+type submission struct {
+	client  storage.Client
+	ops     []Op
+	results []Result
+	done    chan error
+}
+
+type Queue struct {
+	store   *storage.Store
+	logger  *logging.Logger
+	opts    Options
+	pending chan *submission
+	stopped chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	depth          atomic.Int64
+	maxDepth       atomic.Int64
+	enqueued       atomic.Int64
+	committed      atomic.Int64
+	failed         atomic.Int64
+	batches        atomic.Int64
+	lastBatchSize  atomic.Int64
+	lastCommitUsec atomic.Int64
+}
+
+// NewQueue starts the writer goroutine. Zero options use the defaults.
+func NewQueue(store *storage.Store, logger *logging.Logger, opts Options) *Queue {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultMaxBatch
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultMaxDelay
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = DefaultCapacity
+	}
+
+	q := &Queue{
+		store:   store,
+		logger:  logger,
+		opts:    opts,
+		pending: make(chan *submission, opts.Capacity),
+		stopped: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Submit enqueues ops and waits until they are committed. Their changes
+// are attributed to client in the change history. The returned error
+// covers the whole submission (closed queue, cancelled context while
+// waiting for room, failed commit); per-op errors are in the results.
+func (q *Queue) Submit(ctx context.Context, client storage.Client, ops ...Op) ([]Result, error) {
+	s := &submission{
+		client:  client,
+		ops:     ops,
+		results: make([]Result, len(ops)),
+		done:    make(chan error, 1),
+	}
+
+	q.mu.RLock()
+	if q.closed {
+		q.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	// Count the ops before the writer can see them so depth never dips
+	// below zero.
+	q.trackDepth(int64(len(ops)))
+	select {
+	case q.pending <- s:
+	case <-ctx.Done():
+		q.mu.RUnlock()
+		q.depth.Add(-int64(len(ops)))
+		return nil, ctx.Err()
+	}
+	q.mu.RUnlock()
+	q.enqueued.Add(int64(len(ops)))
+
+	// Once enqueued the ops will be applied, so wait for the outcome even
+	// if the caller gives up.
+	if err := <-s.done; err != nil {
+		return nil, err
+	}
+	return s.results, nil
+}
+
+// Close stops accepting submissions, commits everything already queued and
+// waits for the writer to exit.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		<-q.stopped
+		return
+	}
+	q.closed = true
+	close(q.pending)
+	q.mu.Unlock()
+
+	<-q.stopped
+}
+
+func (q *Queue) trackDepth(n int64) {
+	depth := q.depth.Add(n)
+	for {
+		highest := q.maxDepth.Load()
+		if depth <= highest || q.maxDepth.CompareAndSwap(highest, depth) {
+			return
+		}
+	}
+}
+
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Depth:          q.depth.Load(),
+		MaxDepth:       q.maxDepth.Load(),
+		Enqueued:       q.enqueued.Load(),
+		Committed:      q.committed.Load(),
+		Failed:         q.failed.Load(),
+		Batches:        q.batches.Load(),
+		LastBatchSize:  q.lastBatchSize.Load(),
+		LastCommitUsec: q.lastCommitUsec.Load(),
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.stopped)
+
+	for first := range q.pending {
+		group := []*submission{first}
+		size := len(first.ops)
+
+		timer := time.NewTimer(q.opts.MaxDelay)
+	collect:
+		for size < q.opts.MaxBatch {
+			select {
+			case s, ok := <-q.pending:
+				if !ok {
+					break collect
+				}
+				group = append(group, s)
+				size += len(s.ops)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		q.commit(group, size)
+	}
+}
+
+func (q *Queue) commit(group []*submission, size int) {
+	start := time.Now()
+	failed := 0
+
+	batch, err := q.store.BeginBatch()
+	if err == nil {
+		for _, s := range group {
+			batch.SetClient(s.client)
+			for i, op := range s.ops {
+				change, opErr := op(batch)
+				s.results[i] = Result{Change: change, Err: opErr}
+				if opErr != nil {
+					failed++
+				}
+			}
+		}
+		if err = batch.Commit(); err != nil {
+			batch.Rollback()
+		}
+	}
+
+	if err != nil {
+		failed = size
+		if q.logger != nil {
+			q.logger.Errorf("ingest", "failed to commit %d ops: %v", size, err)
+		}
+	}
+
+	q.batches.Add(1)
+	q.lastBatchSize.Store(int64(size))
+	q.lastCommitUsec.Store(time.Since(start).Microseconds())
+	q.committed.Add(int64(size - failed))
+	q.failed.Add(int64(failed))
+	q.depth.Add(-int64(size))
+
+	for _, s := range group {
+		s.done <- err
+	}
+}
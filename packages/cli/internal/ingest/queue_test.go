@@ -0,0 +1,153 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+func createStore(t *testing.T) *storage.Store {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "ingest_test.db")
+	if _, err := storage.EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func upsertSession(id, title string) Op {
+	return func(b *storage.Batch) (storage.Change, error) {
+		return b.UpsertSession(&storage.Session{ID: id, Title: &title})
+	}
+}
+
+func TestSubmitCommits(t *testing.T) {
+	store := createStore(t)
+	queue := NewQueue(store, nil, Options{})
+	defer queue.Close()
+
+	results, err := queue.Submit(context.Background(), storage.Client{},
+		upsertSession("ses_1", "first"),
+		func(b *storage.Batch) (storage.Change, error) {
+			return b.UpsertMessage(&storage.Message{ID: "m1", SessionID: "missing", Role: "user"})
+		},
+		upsertSession("ses_1", "second"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if results[0].Change != storage.ChangeInserted || results[2].Change != storage.ChangeUpdated {
+		t.Errorf("unexpected changes: %+v", results)
+	}
+	if results[1].Err == nil {
+		t.Error("expected a constraint error for the orphan message")
+	}
+
+	session, _, err := store.GetSessionByID("ses_1")
+	if err != nil {
+		t.Fatalf("expected session to be committed, got %v", err)
+	}
+	if *session.Title != "second" {
+		t.Errorf("expected ops to apply in order, got title %q", *session.Title)
+	}
+
+	stats := queue.Stats()
+	if stats.Depth != 0 || stats.Enqueued != 3 || stats.Committed != 2 || stats.Failed != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestSubmitGroupsConcurrentWrites(t *testing.T) {
+	store := createStore(t)
+	queue := NewQueue(store, nil, Options{MaxDelay: 50 * time.Millisecond})
+	defer queue.Close()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("ses_%d", i)
+			if _, err := queue.Submit(context.Background(), storage.Client{}, upsertSession(id, id)); err != nil {
+				t.Errorf("submit %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := queue.Stats()
+	if stats.Committed != writers {
+		t.Errorf("expected %d committed ops, got %d", writers, stats.Committed)
+	}
+	if stats.Batches >= writers {
+		t.Errorf("expected concurrent writes to share transactions, got %d batches", stats.Batches)
+	}
+	if stats.MaxDepth < 2 {
+		t.Errorf("expected max depth to record queued writes, got %d", stats.MaxDepth)
+	}
+}
+
+func TestSubmitPreservesOrder(t *testing.T) {
+	store := createStore(t)
+	queue := NewQueue(store, nil, Options{MaxBatch: 3})
+	defer queue.Close()
+
+	// Sequential submissions for one session must land in order even when
+	// they span several transactions.
+	for i := 1; i <= 10; i++ {
+		if _, err := queue.Submit(context.Background(), storage.Client{}, upsertSession("ses_1", fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("submit failed: %v", err)
+		}
+	}
+
+	session, _, err := store.GetSessionByID("ses_1")
+	if err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	if *session.Title != "v10" {
+		t.Errorf("expected last write to win, got %q", *session.Title)
+	}
+}
+
+func TestClose(t *testing.T) {
+	store := createStore(t)
+	queue := NewQueue(store, nil, Options{MaxDelay: time.Second})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := queue.Submit(context.Background(), storage.Client{}, upsertSession("ses_1", "pending"))
+		done <- err
+	}()
+
+	// Wait until the submission is queued, then close: it must still be
+	// committed rather than waiting out MaxDelay or being dropped.
+	for queue.Stats().Enqueued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	queue.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected queued write to commit on close, got %v", err)
+	}
+	if _, _, err := store.GetSessionByID("ses_1"); err != nil {
+		t.Errorf("expected session after close, got %v", err)
+	}
+
+	if _, err := queue.Submit(context.Background(), storage.Client{}, upsertSession("ses_2", "late")); err != ErrClosed {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+	queue.Close()
+}
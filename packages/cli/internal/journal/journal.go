@@ -0,0 +1,258 @@
+// Package journal keeps an append-only record of the write requests the
+// daemon accepted, so a database can be rebuilt by replaying them.
+//
+// Events are stored as JSON lines in one segment file per day
+// (events-2006-01-02.jsonl). Each event carries a sequence number that
+// increases across segments.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+const (
+	segmentPrefix = "events-"
+	segmentSuffix = ".jsonl"
+	segmentDate   = "2006-01-02"
+)
+
+// Event is one accepted RPC request.
+type Event struct {
+	Seq        int64           `json:"seq"`
+	ReceivedAt int64           `json:"receivedAt"` // unix ms
+	Method     string          `json:"method"`
+	Client     storage.Client  `json:"client"`
+	Params     json.RawMessage `json:"params"`
+}
+
+type Journal struct {
+	mu          sync.Mutex
+	dir         string
+	file        *os.File
+	currentDate string
+	seq         int64
+	closed      bool
+}
+
+// ErrClosed is returned by Append after Close.
+var ErrClosed = errors.New("journal is closed")
+
+// Open prepares dir for appending, continuing the sequence from the newest
+// segment. A partial line left by a crash is cut off first.
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	segments, err := Segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{dir: dir}
+	if len(segments) > 0 {
+		last, err := repairTail(segments[len(segments)-1])
+		if err != nil {
+			return nil, err
+		}
+		j.seq = last
+	}
+	return j, nil
+}
+
+// Append assigns the next sequence number to e and writes it to today's
+// segment. Lines are written with a single write call; they are not
+// fsynced.
+func (j *Journal) Append(e *Event) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return ErrClosed
+	}
+	if err := j.rotateIfNeeded(); err != nil {
+		return err
+	}
+
+	e.Seq = j.seq + 1
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal event: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal event: %w", err)
+	}
+	j.seq = e.Seq
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	j.file = nil
+	return err
+}
+
+// rotateIfNeeded opens today's segment. The caller holds j.mu.
+func (j *Journal) rotateIfNeeded() error {
+	today := time.Now().Format(segmentDate)
+	if j.file != nil && today == j.currentDate {
+		return nil
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	path := filepath.Join(j.dir, segmentPrefix+today+segmentSuffix)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal segment: %w", err)
+	}
+	j.file = file
+	j.currentDate = today
+	return nil
+}
+
+// Segments lists the segment files in dir, oldest first.
+func Segments(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// repairTail truncates an unterminated last line and returns the sequence
+// number of the last complete event.
+func repairTail(path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var last int64
+	var complete int64 // bytes up to the end of the last full line
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		complete += int64(len(line))
+		var e Event
+		if json.Unmarshal(line, &e) == nil {
+			last = e.Seq
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() > complete {
+		if err := file.Truncate(complete); err != nil {
+			return 0, fmt.Errorf("failed to repair journal segment: %w", err)
+		}
+	}
+	return last, nil
+}
+
+// Range selects events by receive time. Zero bounds are open.
+type Range struct {
+	From int64 // unix ms, inclusive
+	To   int64 // unix ms, exclusive
+}
+
+func (r Range) contains(ms int64) bool {
+	return (r.From == 0 || ms >= r.From) && (r.To == 0 || ms < r.To)
+}
+
+// overlaps reports whether a segment for the given day can hold events in
+// the range.
+func (r Range) overlaps(day time.Time) bool {
+	start := day.UnixMilli()
+	end := day.AddDate(0, 0, 1).UnixMilli()
+	return (r.From == 0 || end > r.From) && (r.To == 0 || start < r.To)
+}
+
+// ErrStop can be returned by a Read callback to stop early without error.
+var ErrStop = errors.New("stop reading journal")
+
+// Read calls fn for every event in dir within r, in sequence order. An
+// unterminated last line, left by a crash, is skipped.
+func Read(dir string, r Range, fn func(*Event) error) error {
+	segments, err := Segments(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range segments {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), segmentPrefix), segmentSuffix)
+		if day, err := time.ParseInLocation(segmentDate, name, time.Local); err == nil && !r.overlaps(day) {
+			continue
+		}
+		if err := readSegment(path, r, fn); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func readSegment(path string, r Range, fn func(*Event) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("%s line %d: %w", filepath.Base(path), lineNo, err)
+		}
+		if !r.contains(e.ReceivedAt) {
+			continue
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package journal
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func appendEvents(t *testing.T, j *Journal, methods ...string) {
+	t.Helper()
+	for _, method := range methods {
+		e := &Event{ReceivedAt: time.Now().UnixMilli(), Method: method, Params: json.RawMessage(`{}`)}
+		if err := j.Append(e); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+}
+
+func readAll(t *testing.T, dir string, r Range) []Event {
+	t.Helper()
+	var events []Event
+	if err := Read(dir, r, func(e *Event) error {
+		events = append(events, *e)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return events
+}
+
+func TestAppendAndRead(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	appendEvents(t, j, "upsertSession", "upsertMessage")
+	j.Close()
+
+	if err := j.Append(&Event{Method: "late"}); err != ErrClosed {
+		t.Errorf("expected ErrClosed after close, got %v", err)
+	}
+
+	// Reopening continues the sequence.
+	j, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	appendEvents(t, j, "ingestBatch")
+	j.Close()
+
+	events := readAll(t, dir, Range{})
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, e := range events {
+		if e.Seq != int64(i+1) {
+			t.Errorf("expected seq %d, got %d", i+1, e.Seq)
+		}
+	}
+	if events[2].Method != "ingestBatch" || string(events[2].Params) != `{}` {
+		t.Errorf("unexpected event: %+v", events[2])
+	}
+
+	future := time.Now().Add(time.Hour).UnixMilli()
+	if got := readAll(t, dir, Range{From: future}); len(got) != 0 {
+		t.Errorf("expected no events after %d, got %d", future, len(got))
+	}
+	if got := readAll(t, dir, Range{To: future}); len(got) != 3 {
+		t.Errorf("expected all events before %d, got %d", future, len(got))
+	}
+}
+
+func TestOpenRepairsTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	appendEvents(t, j, "upsertSession")
+	j.Close()
+
+	segments, _ := Segments(dir)
+	f, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	f.WriteString(`{"seq":2,"method":"upsertMess`)
+	f.Close()
+
+	if got := readAll(t, dir, Range{}); len(got) != 1 {
+		t.Errorf("expected the torn line to be skipped, got %d events", len(got))
+	}
+
+	j, err = Open(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	appendEvents(t, j, "upsertMessage")
+	j.Close()
+
+	events := readAll(t, dir, Range{})
+	if len(events) != 2 || events[1].Seq != 2 || events[1].Method != "upsertMessage" {
+		t.Errorf("expected the torn line to be replaced, got %+v", events)
+	}
+}
@@ -0,0 +1,115 @@
+package lineedit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize is the number of entries kept in the history file.
+const DefaultHistorySize = 1000
+
+// History is a list of previously entered lines, optionally persisted to a
+// file. Each entry is written as it is added, so history survives crashes.
+type History struct {
+	entries []string
+	max     int
+	path    string
+}
+
+// LoadHistory reads the history file at path, keeping the last max entries.
+// A missing file is not an error; it is created on the first Add.
+func LoadHistory(path string, max int) (*History, error) {
+	if max <= 0 {
+		max = DefaultHistorySize
+	}
+	h := &History{max: max, path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	total := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+			total++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if len(h.entries) > max {
+		h.entries = h.entries[len(h.entries)-max:]
+	}
+	// Compact the file once it has grown well past the limit.
+	if total > 2*max {
+		if err := h.rewrite(); err != nil {
+			return h, err
+		}
+	}
+
+	return h, nil
+}
+
+// Entries returns the history, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add appends line to the history. Blank lines and repeats of the previous
+// entry are ignored.
+func (h *History) Add(line string) error {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+
+	h.entries = append(h.entries, line)
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+func (h *History) rewrite() error {
+	tmp := h.path + ".tmp"
+	content := strings.Join(h.entries, "\n") + "\n"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// CompleteFunc returns completion candidates for the word ending at pos in
+// line. start is the index (in runes) where the word begins; each candidate
+// replaces line[start:pos].
+type CompleteFunc func(line []rune, pos int) (start int, candidates []string)
+
+// Editor reads lines with Emacs-style editing, history and tab completion.
+// When the input is not a terminal it falls back to plain buffered reads, so
+// scripts can be piped in.
+type Editor struct {
+	History  *History
+	Complete CompleteFunc
+
+	in          *os.File
+	out         io.Writer
+	reader      *bufio.Reader
+	interactive bool
+}
+
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{
+		History:     &History{},
+		in:          in,
+		out:         out,
+		reader:      bufio.NewReader(in),
+		interactive: isTerminal(in),
+	}
+}
+
+// Interactive reports whether the editor is attached to a terminal.
+func (e *Editor) Interactive() bool {
+	return e.interactive
+}
+
+// ReadLine prints prompt and returns the next line without its trailing
+// newline. It returns io.EOF at end of input (Ctrl-D on an empty line) and
+// ErrInterrupted on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.interactive {
+		return e.readPlain()
+	}
+
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		// Not a usable terminal after all; degrade to plain input.
+		e.interactive = false
+		fmt.Fprint(e.out, prompt)
+		return e.readPlain()
+	}
+	defer restore()
+
+	return e.edit(prompt)
+}
+
+func (e *Editor) readPlain() (string, error) {
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// lineState is the buffer being edited and the cursor position within it.
+type lineState struct {
+	prompt  string
+	buf     []rune
+	pos     int
+	histIdx int    // index into history while browsing; len(entries) is the new line
+	draft   []rune // the unsent line, kept while browsing history
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// edit runs the editing loop. The terminal must already be in raw mode.
+func (e *Editor) edit(prompt string) (string, error) {
+	s := &lineState{prompt: prompt, histIdx: len(e.History.entries)}
+	e.refresh(s)
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(s.buf) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return string(s.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\r\n")
+			return string(s.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case keyBackspace, keyCtrlH:
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.buf)
+		case keyCtrlB:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case keyCtrlF:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+		case keyCtrlU:
+			s.buf = append([]rune{}, s.buf[s.pos:]...)
+			s.pos = 0
+		case keyCtrlW:
+			start := s.pos
+			for start > 0 && s.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && s.buf[start-1] != ' ' {
+				start--
+			}
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			e.historyMove(s, -1)
+		case keyCtrlN:
+			e.historyMove(s, 1)
+		case keyTab:
+			e.complete(s)
+		case keyEscape:
+			e.escape(s)
+		default:
+			if r >= ' ' {
+				s.insert(r)
+			}
+		}
+
+		e.refresh(s)
+	}
+}
+
+// escape handles ANSI escape sequences for the arrow, Home, End and Delete
+// keys. Unknown sequences are ignored.
+func (e *Editor) escape(s *lineState) {
+	b, err := e.reader.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return
+	}
+
+	var params []byte
+	for {
+		c, err := e.reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if c >= '0' && c <= '9' || c == ';' {
+			params = append(params, c)
+			continue
+		}
+
+		switch {
+		case c == 'A':
+			e.historyMove(s, -1)
+		case c == 'B':
+			e.historyMove(s, 1)
+		case c == 'C':
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case c == 'D':
+			if s.pos > 0 {
+				s.pos--
+			}
+		case c == 'H', c == '~' && (string(params) == "1" || string(params) == "7"):
+			s.pos = 0
+		case c == 'F', c == '~' && (string(params) == "4" || string(params) == "8"):
+			s.pos = len(s.buf)
+		case c == '~' && string(params) == "3":
+			s.deleteAt(s.pos)
+		}
+		return
+	}
+}
+
+func (e *Editor) historyMove(s *lineState, delta int) {
+	entries := e.History.entries
+	next := s.histIdx + delta
+	if next < 0 || next > len(entries) {
+		return
+	}
+
+	if s.histIdx == len(entries) {
+		s.draft = append([]rune{}, s.buf...)
+	}
+	s.histIdx = next
+
+	if next == len(entries) {
+		s.buf = append([]rune{}, s.draft...)
+	} else {
+		s.buf = []rune(entries[next])
+	}
+	s.pos = len(s.buf)
+}
+
+// complete inserts the longest common prefix of the candidates for the word
+// under the cursor. When that adds nothing and there are several candidates,
+// they are listed below the prompt.
+func (e *Editor) complete(s *lineState) {
+	if e.Complete == nil {
+		return
+	}
+
+	start, candidates := e.Complete(s.buf, s.pos)
+	if len(candidates) == 0 || start < 0 || start > s.pos {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+
+	word := string(s.buf[start:s.pos])
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 || len([]rune(prefix)) > len([]rune(word)) {
+		replacement := []rune(prefix)
+		rest := append([]rune{}, s.buf[s.pos:]...)
+		s.buf = append(append(s.buf[:start], replacement...), rest...)
+		s.pos = start + len(replacement)
+		return
+	}
+
+	sorted := append([]string{}, candidates...)
+	sort.Strings(sorted)
+	fmt.Fprint(e.out, "\r\n"+strings.Join(sorted, "  ")+"\r\n")
+}
+
+// refresh redraws the prompt and buffer and places the cursor.
+func (e *Editor) refresh(s *lineState) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *lineState) deleteAt(i int) {
+	if i < 0 || i >= len(s.buf) {
+		return
+	}
+	s.buf = append(s.buf[:i], s.buf[i+1:]...)
+}
+
+// commonPrefix returns the longest prefix shared by all candidates, compared
+// case-insensitively and spelled as in the first candidate.
+func commonPrefix(candidates []string) string {
+	prefix := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		cr := []rune(c)
+		n := 0
+		for n < len(prefix) && n < len(cr) && strings.EqualFold(string(prefix[n]), string(cr[n])) {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
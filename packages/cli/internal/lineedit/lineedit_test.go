@@ -0,0 +1,201 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(input string, history ...string) *Editor {
+	return &Editor{
+		History: &History{entries: history},
+		out:     io.Discard,
+		reader:  bufio.NewReader(strings.NewReader(input)),
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain text", "SELECT 1\r", "SELECT 1"},
+		{"backspace", "SELECTT\x7f 1\r", "SELECT 1"},
+		{"insert after moving left", "SELECT 2\x1b[D1\r", "SELECT 12"},
+		{"home and end", "ELECT\x1b[HS\x1b[F 1\r", "SELECT 1"},
+		{"ctrl-a and ctrl-e", "ELECT\x01S\x05 1\r", "SELECT 1"},
+		{"delete key", "SELECT 11\x1b[D\x1b[3~\r", "SELECT 1"},
+		{"kill to end", "SELECT 1 junk\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", "SELECT 1"},
+		{"kill to start", "junk SELECT 1\x01\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x15\r", "SELECT 1"},
+		{"kill word", "SELECT foo bar\x17\x171\r", "SELECT 1"},
+		{"utf-8", "SELECT 'café'\r", "SELECT 'café'"},
+		{"unknown escape ignored", "SELECT\x1b[5~ 1\r", "SELECT 1"},
+		{"line feed submits", "SELECT 1\n", "SELECT 1"},
+		{"eof with pending text", "SELECT 1", "SELECT 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := newTestEditor(tt.input).edit("> ")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if line != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, line)
+			}
+		})
+	}
+}
+
+func TestEditControl(t *testing.T) {
+	t.Run("ctrl-d on empty line is EOF", func(t *testing.T) {
+		_, err := newTestEditor("\x04").edit("> ")
+		if err != io.EOF {
+			t.Errorf("expected io.EOF, got %v", err)
+		}
+	})
+
+	t.Run("ctrl-d deletes under cursor", func(t *testing.T) {
+		line, err := newTestEditor("ab\x02\x04\r").edit("> ")
+		if err != nil || line != "a" {
+			t.Errorf("expected %q, got %q (%v)", "a", line, err)
+		}
+	})
+
+	t.Run("ctrl-c interrupts", func(t *testing.T) {
+		_, err := newTestEditor("SELECT\x03").edit("> ")
+		if !errors.Is(err, ErrInterrupted) {
+			t.Errorf("expected ErrInterrupted, got %v", err)
+		}
+	})
+}
+
+func TestEditHistory(t *testing.T) {
+	history := []string{"SELECT 1;", "SELECT 2;"}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"up recalls latest", "\x1b[A\r", "SELECT 2;"},
+		{"up twice recalls older", "\x1b[A\x1b[A\r", "SELECT 1;"},
+		{"up stops at oldest", "\x1b[A\x1b[A\x1b[A\r", "SELECT 1;"},
+		{"down restores draft", "draft\x1b[A\x1b[A\x1b[B\x1b[B\r", "draft"},
+		{"ctrl-p and ctrl-n", "\x10\x10\x0e\r", "SELECT 2;"},
+		{"recalled line is editable", "\x1b[A\x7f\x7f3;\r", "SELECT 3;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := newTestEditor(tt.input, history...).edit("> ")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if line != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, line)
+			}
+		})
+	}
+}
+
+func TestEditComplete(t *testing.T) {
+	words := []string{"sessions", "session_errors", "messages"}
+	complete := func(line []rune, pos int) (int, []string) {
+		start := pos
+		for start > 0 && line[start-1] != ' ' {
+			start--
+		}
+		prefix := strings.ToLower(string(line[start:pos]))
+		var out []string
+		for _, w := range words {
+			if strings.HasPrefix(w, prefix) {
+				out = append(out, w)
+			}
+		}
+		return start, out
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"single candidate", "FROM me\t\r", "FROM messages"},
+		{"common prefix", "FROM se\t\r", "FROM session"},
+		{"ambiguous leaves text", "FROM session\t\r", "FROM session"},
+		{"case-insensitive", "FROM ME\t\r", "FROM messages"},
+		{"mid-line", "FROM me WHERE\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\t\r", "FROM messages WHERE"},
+		{"no candidates", "FROM xyz\t\r", "FROM xyz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEditor(tt.input)
+			e.Complete = complete
+			line, err := e.edit("> ")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if line != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, line)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "history")
+
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory on missing file failed: %v", err)
+	}
+	if len(h.Entries()) != 0 {
+		t.Fatalf("expected empty history, got %v", h.Entries())
+	}
+
+	for _, line := range []string{"one", "two", "two", "  ", "three", "four"} {
+		if err := h.Add(line); err != nil {
+			t.Fatalf("Add(%q) failed: %v", line, err)
+		}
+	}
+
+	expected := []string{"two", "three", "four"}
+	if strings.Join(h.Entries(), ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, h.Entries())
+	}
+
+	reloaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if strings.Join(reloaded.Entries(), ",") != strings.Join(expected, ",") {
+		t.Errorf("expected reloaded %v, got %v", expected, reloaded.Entries())
+	}
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, _ := LoadHistory(path, 2)
+	for _, line := range []string{"a", "b", "c", "d", "e"} {
+		h.Add(line)
+	}
+
+	// Five lines on disk exceed twice the limit, so loading rewrites the file.
+	if _, err := LoadHistory(path, 2); err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	raw, err := LoadHistory(path, 100)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if strings.Join(raw.Entries(), ",") != "d,e" {
+		t.Errorf("expected compacted file to hold d,e, got %v", raw.Entries())
+	}
+}
@@ -13,7 +13,10 @@ const (
 	defaultDBFile     = "clankers.db"
 	defaultConfigFile = "clankers.json"
 	defaultSocketName = "dxta-clankers.sock"
+	historyFileName   = "query_history"
 	logDirName        = "logs"
+	journalDirName    = "journal"
+	discoveryFileName = "daemon.json"
 )
 
 // Linux: $XDG_DATA_HOME or ~/.local/share
@@ -56,6 +59,10 @@ func GetConfigPath() string {
 	return filepath.Join(GetDataDir(), defaultConfigFile)
 }
 
+func GetHistoryPath() string {
+	return filepath.Join(GetDataDir(), historyFileName)
+}
+
 func GetSocketPath() string {
 	if v := os.Getenv("CLANKERS_SOCKET_PATH"); v != "" {
 		return v
@@ -73,6 +80,23 @@ func GetLogDir() string {
 	return filepath.Join(GetDataDir(), logDirName)
 }
 
+// GetJournalDir returns where the daemon keeps its event journal.
+func GetJournalDir() string {
+	if v := os.Getenv("CLANKERS_JOURNAL_PATH"); v != "" {
+		return v
+	}
+	return filepath.Join(GetDataDir(), journalDirName)
+}
+
+// GetDiscoveryPath returns where the daemon publishes its TCP address and
+// token while --listen or --http is on.
+func GetDiscoveryPath() string {
+	if v := os.Getenv("CLANKERS_DISCOVERY_PATH"); v != "" {
+		return v
+	}
+	return filepath.Join(GetDataDir(), discoveryFileName)
+}
+
 func GetCurrentLogFile() string {
 	date := time.Now().Format("2006-01-02")
 	return filepath.Join(GetLogDir(), fmt.Sprintf("clankers-%s.jsonl", date))
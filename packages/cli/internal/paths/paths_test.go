@@ -149,6 +149,21 @@ func TestGetConfigPath(t *testing.T) {
 	})
 }
 
+func TestGetHistoryPath(t *testing.T) {
+	origDataPath := os.Getenv("CLANKERS_DATA_PATH")
+	defer os.Setenv("CLANKERS_DATA_PATH", origDataPath)
+
+	customPath := "/custom/history/root"
+	os.Setenv("CLANKERS_DATA_PATH", customPath)
+
+	result := GetHistoryPath()
+
+	expected := filepath.Join(customPath, "clankers", "query_history")
+	if result != expected {
+		t.Errorf("expected '%s', got '%s'", expected, result)
+	}
+}
+
 func TestGetSocketPath(t *testing.T) {
 	origSocketPath := os.Getenv("CLANKERS_SOCKET_PATH")
 	origDataPath := os.Getenv("CLANKERS_DATA_PATH")
@@ -0,0 +1,115 @@
+// Package peercred identifies the process on the other end of a Unix socket
+// connection and decides whether it may talk to the daemon.
+package peercred
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+)
+
+// ErrUnsupported is returned by Get where the platform offers no way to
+// read peer credentials.
+var ErrUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// Cred describes a connected peer. PID is 0 when the platform does not
+// report it.
+type Cred struct {
+	PID    int
+	UID    uint32
+	GID    uint32
+	Groups []uint32 // supplementary groups, when the socket reports them (macOS)
+}
+
+func (c *Cred) String() string {
+	s := fmt.Sprintf("pid %d uid %d gid %d", c.PID, c.UID, c.GID)
+	if exe := Exe(c.PID); exe != "" {
+		s += " exe " + exe
+	}
+	return s
+}
+
+// Owner reports whether c runs as the daemon's own user.
+func (c *Cred) Owner() bool {
+	return c.UID == uint32(os.Getuid())
+}
+
+// Policy decides which peers are accepted. The daemon's own user is always
+// allowed; UIDs and GIDs widen that.
+type Policy struct {
+	UIDs []uint32
+	GIDs []uint32
+}
+
+// Shared reports whether the policy admits anyone besides the daemon's own
+// user, in which case the socket file must be reachable by them too.
+func (p *Policy) Shared() bool {
+	return len(p.UIDs) > 0 || len(p.GIDs) > 0
+}
+
+// Allow reports whether c may use the daemon.
+func (p *Policy) Allow(c *Cred) bool {
+	if c.Owner() || slices.Contains(p.UIDs, c.UID) {
+		return true
+	}
+	if slices.Contains(p.GIDs, c.GID) {
+		return true
+	}
+	for _, g := range c.Groups {
+		if slices.Contains(p.GIDs, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePolicy builds a policy from user and group names or numeric ids.
+func ParsePolicy(users, groups []string) (*Policy, error) {
+	p := &Policy{}
+	for _, name := range users {
+		uid, err := lookupID(name, func(n string) (string, error) {
+			u, err := user.Lookup(n)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unknown user %q: %w", name, err)
+		}
+		p.UIDs = append(p.UIDs, uid)
+	}
+	for _, name := range groups {
+		gid, err := lookupID(name, func(n string) (string, error) {
+			g, err := user.LookupGroup(n)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unknown group %q: %w", name, err)
+		}
+		p.GIDs = append(p.GIDs, gid)
+	}
+	return p, nil
+}
+
+// lookupID accepts a numeric id as is and resolves anything else by name.
+func lookupID(name string, lookup func(string) (string, error)) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(n), nil
+}
@@ -0,0 +1,47 @@
+package peercred
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// Get reads LOCAL_PEERCRED and LOCAL_PEERPID from conn.
+func Get(conn net.Conn) (*Cred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var xucred *unix.Xucred
+	var pid int
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		xucred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+		if credErr == nil {
+			pid, _ = unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	cred := &Cred{PID: pid, UID: xucred.Uid}
+	if n := int(xucred.Ngroups); n > 0 {
+		cred.GID = xucred.Groups[0]
+		cred.Groups = append([]uint32(nil), xucred.Groups[1:n]...)
+	}
+	return cred, nil
+}
+
+// Exe is not available without cgo on macOS.
+func Exe(pid int) string {
+	return ""
+}
@@ -0,0 +1,53 @@
+package peercred
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Get reads SO_PEERCRED from conn. It carries only the primary group, so
+// Groups is left empty: reading them from /proc/<pid>/status would trust
+// whatever process holds that pid by then, not the peer.
+func Get(conn net.Conn) (*Cred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &Cred{
+		PID: int(ucred.Pid),
+		UID: ucred.Uid,
+		GID: ucred.Gid,
+	}, nil
+}
+
+// Exe returns the peer's executable, or "" if it is gone or unreadable.
+func Exe(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return ""
+	}
+	return exe
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package peercred
+
+import "net"
+
+func Get(conn net.Conn) (*Cred, error) {
+	return nil, ErrUnsupported
+}
+
+func Exe(pid int) string {
+	return ""
+}
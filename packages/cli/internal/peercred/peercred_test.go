@@ -0,0 +1,84 @@
+package peercred
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyAllow(t *testing.T) {
+	self := uint32(os.Getuid())
+	other := self + 1000
+
+	cases := []struct {
+		name   string
+		policy Policy
+		cred   Cred
+		want   bool
+	}{
+		{"same user", Policy{}, Cred{UID: self}, true},
+		{"other user", Policy{}, Cred{UID: other, GID: other}, false},
+		{"allowed uid", Policy{UIDs: []uint32{other}}, Cred{UID: other}, true},
+		{"allowed primary group", Policy{GIDs: []uint32{50}}, Cred{UID: other, GID: 50}, true},
+		{"allowed supplementary group", Policy{GIDs: []uint32{50}}, Cred{UID: other, GID: 1, Groups: []uint32{7, 50}}, true},
+		{"unlisted group", Policy{GIDs: []uint32{50}}, Cred{UID: other, GID: 1, Groups: []uint32{7}}, false},
+	}
+	for _, c := range cases {
+		if got := c.policy.Allow(&c.cred); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestParsePolicyNumericIDs(t *testing.T) {
+	p, err := ParsePolicy([]string{"1001"}, []string{"20"})
+	if err != nil {
+		t.Fatalf("failed to parse policy: %v", err)
+	}
+	if len(p.UIDs) != 1 || p.UIDs[0] != 1001 || len(p.GIDs) != 1 || p.GIDs[0] != 20 {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if !p.Shared() {
+		t.Error("expected an allowlist to share the socket")
+	}
+
+	if _, err := ParsePolicy([]string{"no-such-user-clankers"}, nil); err == nil {
+		t.Error("expected an unknown user to be rejected")
+	}
+}
+
+func TestGetReportsOwnProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peer.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer server.Close()
+
+	cred, err := Get(server)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("failed to get peer credentials: %v", err)
+	}
+	if cred.UID != uint32(os.Getuid()) {
+		t.Errorf("expected uid %d, got %d", os.Getuid(), cred.UID)
+	}
+	if cred.PID != 0 && cred.PID != os.Getpid() {
+		t.Errorf("expected pid %d, got %d", os.Getpid(), cred.PID)
+	}
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// CodeUnauthorized is returned on the TCP listener for requests whose
+// envelope does not carry the daemon's token.
+const CodeUnauthorized = 4004
+
+var errUnauthorized = &jsonrpc2.Error{
+	Code:    CodeUnauthorized,
+	Message: "missing or invalid token",
+}
+
+// CodeNotPermitted is returned on the Unix socket when a peer admitted by
+// --allow-user or --allow-group calls a method reserved for the daemon's
+// own user.
+const CodeNotPermitted = 4007
+
+// peerMethods are the methods other admitted users may call: enough to
+// report their own sessions. Reads, status, subscribe and shutdown would
+// expose everyone's history or stop the daemon.
+var peerMethods = map[string]bool{
+	"handshake":             true,
+	"health":                true,
+	"ensureDb":              true,
+	"getDbPath":             true,
+	"upsertSession":         true,
+	"upsertMessage":         true,
+	"upsertTool":            true,
+	"upsertSessionError":    true,
+	"upsertCompactionEvent": true,
+	"ingestBatch":           true,
+	"log.write":             true,
+}
+
+// GenerateToken returns a random bearer token for the TCP listener.
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// RequireToken returns a handler for one connection from the TCP listener.
+// Requests must carry token in their envelope; remote is logged when they
+// do not.
+func (h *Handler) RequireToken(token, remote string) jsonrpc2.Handler {
+	return &tokenHandler{handler: h, token: token, remote: remote}
+}
+
+type tokenHandler struct {
+	handler *Handler
+	token   string
+	remote  string
+}
+
+func (t *tokenHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	params, ok := stripToken(req.Params, t.token)
+	if !ok {
+		t.handler.logger.Warnf("rpc", "rejected %s from %s: missing or invalid token", req.Method, t.remote)
+		t.handler.clients.request(conn, false, true)
+		conn.ReplyWithError(ctx, req.ID, errUnauthorized)
+		return
+	}
+
+	authorized := *req
+	authorized.Params = params
+	t.handler.Handle(ctx, conn, &authorized)
+}
+
+// stripToken checks the envelope's token and returns params without it.
+func stripToken(params *json.RawMessage, token string) (*json.RawMessage, bool) {
+	if params == nil {
+		return nil, false
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(*params, &fields) != nil {
+		return nil, false
+	}
+	var got string
+	if raw, ok := fields["token"]; !ok || json.Unmarshal(raw, &got) != nil {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		return nil, false
+	}
+
+	delete(fields, "token")
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	stripped := json.RawMessage(data)
+	return &stripped, true
+}
+
+// RestrictPeer returns a handler for one socket connection from a user
+// other than the daemon's own. Only peerMethods are served; peer is logged
+// when anything else is called.
+func (h *Handler) RestrictPeer(peer string) jsonrpc2.Handler {
+	return &peerHandler{handler: h, peer: peer}
+}
+
+type peerHandler struct {
+	handler *Handler
+	peer    string
+}
+
+func (p *peerHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if !peerMethods[req.Method] {
+		p.handler.logger.Warnf("rpc", "rejected %s from %s: reserved for the daemon's user", req.Method, p.peer)
+		p.handler.clients.request(conn, false, true)
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+			Code:    CodeNotPermitted,
+			Message: req.Method + " is only available to the daemon's own user",
+		})
+		return
+	}
+	p.handler.Handle(ctx, conn, req)
+}
@@ -0,0 +1,82 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestStripToken(t *testing.T) {
+	cases := []struct {
+		name   string
+		params string
+		ok     bool
+	}{
+		{"valid", `{"schemaVersion": "v1", "token": "secret", "session": {"id": "s1"}}`, true},
+		{"wrong", `{"token": "guess"}`, false},
+		{"missing", `{"schemaVersion": "v1"}`, false},
+		{"not a string", `{"token": 1}`, false},
+		{"not an object", `[]`, false},
+	}
+
+	for _, c := range cases {
+		raw := json.RawMessage(c.params)
+		stripped, ok := stripToken(&raw, "secret")
+		if ok != c.ok {
+			t.Errorf("%s: expected ok=%v, got %v", c.name, c.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(*stripped, &fields); err != nil {
+			t.Fatalf("%s: stripped params are not an object: %v", c.name, err)
+		}
+		if _, found := fields["token"]; found {
+			t.Errorf("%s: expected the token to be removed, got %s", c.name, *stripped)
+		}
+		if _, found := fields["session"]; !found {
+			t.Errorf("%s: expected other fields to be kept, got %s", c.name, *stripped)
+		}
+	}
+
+	if _, ok := stripToken(nil, "secret"); ok {
+		t.Error("expected requests without params to be rejected")
+	}
+}
+
+func TestRestrictPeer(t *testing.T) {
+	handler, store := createHandler(t)
+	conn, _ := connectVia(t, handler, handler.RestrictPeer("uid 1001"))
+	ctx := context.Background()
+
+	var ok OkResult
+	if err := conn.Call(ctx, "upsertSession", json.RawMessage(`{"session": {"id": "ses_1"}}`), &ok); err != nil {
+		t.Fatalf("expected another user to report a session, got %v", err)
+	}
+	if _, _, err := store.GetSessionByID("ses_1"); err != nil {
+		t.Errorf("expected the session to be written, got %v", err)
+	}
+
+	for _, method := range []string{"query", "listSessions", "getSession", "search", "getHistory", "status", "subscribe", "shutdown"} {
+		err := conn.Call(ctx, method, json.RawMessage(`{}`), nil)
+		expectCode(t, err, CodeNotPermitted)
+	}
+	select {
+	case <-handler.ShutdownRequested():
+		t.Error("expected shutdown to be refused")
+	default:
+	}
+
+	for method := range peerMethods {
+		var rpcErr *jsonrpc2.Error
+		if err := conn.Call(ctx, method, nil, nil); errors.As(err, &rpcErr) && rpcErr.Code == CodeNotPermitted {
+			t.Errorf("expected %s to be allowed", method)
+		}
+	}
+}
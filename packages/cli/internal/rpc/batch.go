@@ -0,0 +1,191 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dxta-dev/clankers/internal/ingest"
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// MaxIngestBatchItems caps one ingestBatch call so a single transaction
+// cannot hold the write lock for long.
+const MaxIngestBatchItems = 1000
+
+// Ingest item kinds. Each item carries the payload under the field of the
+// same name, e.g. {"kind": "tool", "tool": {...}}.
+const (
+	KindSession         = "session"
+	KindMessage         = "message"
+	KindTool            = "tool"
+	KindSessionError    = "sessionError"
+	KindCompactionEvent = "compactionEvent"
+)
+
+type IngestItem struct {
+	Kind            string                   `json:"kind"`
+	Session         *storage.Session         `json:"session,omitempty"`
+	Message         *storage.Message         `json:"message,omitempty"`
+	Tool            *storage.Tool            `json:"tool,omitempty"`
+	SessionError    *storage.SessionError    `json:"sessionError,omitempty"`
+	CompactionEvent *storage.CompactionEvent `json:"compactionEvent,omitempty"`
+}
+
+// id returns the id of the item's payload.
+func (item *IngestItem) id() string {
+	switch {
+	case item.Session != nil:
+		return item.Session.ID
+	case item.Message != nil:
+		return item.Message.ID
+	case item.Tool != nil:
+		return item.Tool.ID
+	case item.SessionError != nil:
+		return item.SessionError.ID
+	case item.CompactionEvent != nil:
+		return item.CompactionEvent.ID
+	}
+	return ""
+}
+
+type IngestBatchParams struct {
+	RequestEnvelope
+	Items []IngestItem `json:"items"`
+}
+
+// IngestItemResult is the outcome of one item, at the same index as the
+// item in the request. Error uses the same codes as the single-record
+// methods.
+type IngestItemResult struct {
+	OK     bool            `json:"ok"`
+	Change storage.Change  `json:"change,omitempty"`
+	Error  *jsonrpc2.Error `json:"error,omitempty"`
+}
+
+type IngestBatchResult struct {
+	Applied int                `json:"applied"`
+	Failed  int                `json:"failed"`
+	Results []IngestItemResult `json:"results"`
+}
+
+// ingestBatch applies items in order inside one transaction. Items that
+// fail validation or violate a constraint are reported and skipped; the
+// rest are committed together.
+func (h *Handler) ingestBatch(ctx context.Context, params *json.RawMessage) (*IngestBatchResult, error) {
+	if params == nil {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "missing params",
+		}
+	}
+
+	var p IngestBatchParams
+	if err := json.Unmarshal(*params, &p); err != nil {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "invalid params: " + err.Error(),
+		}
+	}
+
+	if len(p.Items) > MaxIngestBatchItems {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("too many items: %d (max %d)", len(p.Items), MaxIngestBatchItems),
+		}
+	}
+
+	result := &IngestBatchResult{Results: make([]IngestItemResult, len(p.Items))}
+
+	// Valid items go to the write queue as one submission, which is never
+	// split across transactions. indexes maps each op back to its item.
+	var ops []ingest.Op
+	var indexes []int
+	for i := range p.Items {
+		op, rpcErr := ingestOp(&p.Items[i])
+		if rpcErr != nil {
+			result.Results[i] = IngestItemResult{Error: rpcErr}
+			result.Failed++
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	if len(ops) > 0 {
+		results, err := h.writes.Submit(ctx, storage.Client(p.Client), ops...)
+		if err != nil {
+			return nil, err
+		}
+		for j, r := range results {
+			i := indexes[j]
+			if r.Err != nil {
+				result.Results[i] = IngestItemResult{Error: &jsonrpc2.Error{
+					Code:    jsonrpc2.CodeInternalError,
+					Message: r.Err.Error(),
+				}}
+				result.Failed++
+				continue
+			}
+			result.Results[i] = IngestItemResult{OK: true, Change: r.Change}
+			result.Applied++
+			h.logStale(r.Change, p.Items[i].Kind, p.Items[i].id(), p.Client)
+			h.committed(p.Client, r.Change, &p.Items[i])
+		}
+	}
+
+	if result.Failed > 0 {
+		h.logger.Warnf("rpc", "ingestBatch from %s: %d applied, %d failed", p.Client.Name, result.Applied, result.Failed)
+	}
+	return result, nil
+}
+
+// ingestOp validates an item like its single-record method and returns the
+// write for it.
+func ingestOp(item *IngestItem) (ingest.Op, *jsonrpc2.Error) {
+	switch item.Kind {
+	case KindSession:
+		if item.Session == nil {
+			return nil, invalidPayload("session", "session")
+		}
+		if rpcErr := validateSession(item.Session); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return func(b *storage.Batch) (storage.Change, error) { return b.UpsertSession(item.Session) }, nil
+	case KindMessage:
+		if item.Message == nil {
+			return nil, invalidPayload("message", "message")
+		}
+		if rpcErr := validateMessage(item.Message); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return func(b *storage.Batch) (storage.Change, error) { return b.UpsertMessage(item.Message) }, nil
+	case KindTool:
+		if item.Tool == nil {
+			return nil, invalidPayload("tool", "tool")
+		}
+		if rpcErr := validateTool(item.Tool); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return func(b *storage.Batch) (storage.Change, error) { return b.UpsertTool(item.Tool) }, nil
+	case KindSessionError:
+		if item.SessionError == nil {
+			return nil, invalidPayload("session error", "sessionError")
+		}
+		if rpcErr := validateSessionError(item.SessionError); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return func(b *storage.Batch) (storage.Change, error) { return b.UpsertSessionError(item.SessionError) }, nil
+	case KindCompactionEvent:
+		if item.CompactionEvent == nil {
+			return nil, invalidPayload("compaction event", "compactionEvent")
+		}
+		if rpcErr := validateCompactionEvent(item.CompactionEvent); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return func(b *storage.Batch) (storage.Change, error) { return b.UpsertCompactionEvent(item.CompactionEvent) }, nil
+	default:
+		return nil, invalidPayload("batch item", "kind")
+	}
+}
@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/dxta-dev/clankers/internal/ingest"
+	"github.com/dxta-dev/clankers/internal/logging"
+	"github.com/dxta-dev/clankers/internal/storage"
+)
+
+func createHandler(t *testing.T) (*Handler, *storage.Store) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "rpc_test.db")
+	if _, err := storage.EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	store, err := storage.Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	logger, err := logging.New("error", filepath.Join(dir, "logs"))
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+
+	writes := ingest.NewQueue(store, logger, ingest.Options{})
+	t.Cleanup(writes.Close)
+
+	return NewHandler(store, writes, nil, logger), store
+}
+
+func rawParams(t *testing.T, s string) *json.RawMessage {
+	t.Helper()
+	raw := json.RawMessage(s)
+	return &raw
+}
+
+func TestIngestBatch(t *testing.T) {
+	handler, store := createHandler(t)
+
+	result, err := handler.ingestBatch(context.Background(), rawParams(t, `{
+		"schemaVersion": "v1",
+		"client": {"name": "test", "version": "1"},
+		"items": [
+			{"kind": "session", "session": {"id": "ses_1", "title": "Batch"}},
+			{"kind": "message", "message": {"id": "m1", "sessionId": "ses_1", "role": "user", "textContent": "hi"}},
+			{"kind": "tool", "tool": {"id": "t1", "sessionId": "ses_1", "createdAt": 1}},
+			{"kind": "message", "message": {"id": "m2", "sessionId": "missing", "role": "user"}},
+			{"kind": "widget"},
+			{"kind": "compactionEvent", "compactionEvent": {"id": "c1", "sessionId": "ses_1", "createdAt": 2}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.Applied != 3 || result.Failed != 3 {
+		t.Errorf("expected 3 applied and 3 failed, got %d and %d", result.Applied, result.Failed)
+	}
+
+	expectOK := []bool{true, true, false, false, false, true}
+	for i, want := range expectOK {
+		if result.Results[i].OK != want {
+			t.Errorf("item %d: expected ok=%v, got %+v", i, want, result.Results[i])
+		}
+	}
+
+	toolErr := result.Results[2].Error
+	if toolErr == nil || toolErr.Code != CodeInvalidPayload || string(*toolErr.Data) != `{"field": "toolName"}` {
+		t.Errorf("expected a 4001 toolName error, got %+v", toolErr)
+	}
+	if result.Results[3].Error == nil {
+		t.Error("expected a constraint error for a message without a session")
+	}
+	if kindErr := result.Results[4].Error; kindErr == nil || kindErr.Code != CodeInvalidPayload {
+		t.Errorf("expected a 4001 error for an unknown kind, got %+v", kindErr)
+	}
+	if result.Results[0].Change != storage.ChangeInserted {
+		t.Errorf("expected session to be inserted, got %q", result.Results[0].Change)
+	}
+
+	_, messages, err := store.GetSessionByID("ses_1")
+	if err != nil {
+		t.Fatalf("expected committed session, got %v", err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("expected 1 committed message, got %d", len(messages))
+	}
+	events, _ := store.GetCompactionEvents("ses_1")
+	if len(events) != 1 {
+		t.Errorf("expected the item after the failures to be committed, got %d events", len(events))
+	}
+}
+
+func TestIngestBatchLimits(t *testing.T) {
+	handler, _ := createHandler(t)
+
+	if _, err := handler.ingestBatch(context.Background(), nil); err == nil {
+		t.Error("expected an error for missing params")
+	}
+
+	items := make([]IngestItem, MaxIngestBatchItems+1)
+	params, _ := json.Marshal(IngestBatchParams{Items: items})
+	if _, err := handler.ingestBatch(context.Background(), rawParams(t, string(params))); err == nil {
+		t.Error("expected an error for an oversized batch")
+	}
+
+	result, err := handler.ingestBatch(context.Background(), rawParams(t, `{"items": []}`))
+	if err != nil || len(result.Results) != 0 {
+		t.Errorf("expected an empty result, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// ErrNotRunning is returned by Dial when nothing is listening on the socket.
+var ErrNotRunning = errors.New("daemon is not running")
+
+// notificationBuffer is how many notifications a Client holds before it
+// drops new ones.
+const notificationBuffer = 256
+
+// Client calls the daemon from CLI commands over the same JSON-RPC framing
+// the plugins use.
+type Client struct {
+	conn          *jsonrpc2.Conn
+	envelope      RequestEnvelope
+	notifications *notifications
+}
+
+// Dial connects to the daemon socket. client identifies the caller in the
+// daemon's status.
+func Dial(ctx context.Context, socketPath string, client ClientInfo) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w (nothing listening on %s)", ErrNotRunning, socketPath)
+	}
+
+	stream := jsonrpc2.NewBufferedStream(conn, jsonrpc2.VSCodeObjectCodec{})
+	n := &notifications{ch: make(chan *jsonrpc2.Request, notificationBuffer)}
+	c := &Client{
+		conn:          jsonrpc2.NewConn(ctx, stream, n),
+		envelope:      RequestEnvelope{SchemaVersion: CurrentSchemaVersion, Client: client},
+		notifications: n,
+	}
+	go func() {
+		<-c.conn.DisconnectNotify()
+		n.close()
+	}()
+	return c, nil
+}
+
+// Envelope returns the request envelope to embed in params.
+func (c *Client) Envelope() RequestEnvelope {
+	return c.envelope
+}
+
+// Call invokes method and decodes the result into result.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	return c.conn.Call(ctx, method, params, result)
+}
+
+// Notifications delivers what the daemon pushes, such as NotifyEvent after
+// subscribe and NotifyShutdown. It is closed when the connection closes.
+// Notifications that arrive while it is full are dropped.
+func (c *Client) Notifications() <-chan *jsonrpc2.Request {
+	return c.notifications.ch
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// notifications queues notifications from the daemon and drops requests,
+// which the daemon never sends.
+type notifications struct {
+	mu     sync.Mutex
+	closed bool
+	ch     chan *jsonrpc2.Request
+}
+
+func (n *notifications) Handle(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if !req.Notif {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.ch <- req:
+	default:
+	}
+}
+
+// close is called once the connection is gone. Handle may still be running
+// if the connection was closed locally, hence the lock.
+func (n *notifications) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.closed {
+		n.closed = true
+		close(n.ch)
+	}
+}
@@ -0,0 +1,215 @@
+package rpc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// ConnectionStatus describes one open connection.
+type ConnectionStatus struct {
+	ID           int64      `json:"id"`
+	Client       ClientInfo `json:"client"` // empty until a request carries an envelope
+	ConnectedAt  int64      `json:"connectedAt"`
+	LastActivity int64      `json:"lastActivity"`
+	Requests     int64      `json:"requests"`
+	Errors       int64      `json:"errors"`
+}
+
+// ClientStatus totals every connection a client has made since the daemon
+// started. Plugins open a connection per call, so this is usually more
+// telling than the live list.
+type ClientStatus struct {
+	Client       ClientInfo `json:"client"`
+	Connections  int64      `json:"connections"`
+	FirstSeen    int64      `json:"firstSeen"`
+	LastActivity int64      `json:"lastActivity"`
+	LastWrite    int64      `json:"lastWrite,omitempty"`
+	Requests     int64      `json:"requests"`
+	Errors       int64      `json:"errors"`
+}
+
+// SourceStatus describes the sessions recorded from one source.
+type SourceStatus struct {
+	Source    string `json:"source"` // empty when sessions have no source
+	Sessions  int64  `json:"sessions"`
+	LastWrite int64  `json:"lastWrite,omitempty"` // last committed write since the daemon started
+}
+
+// registry tracks live connections, per-client totals and the last write
+// committed for each source. Timestamps are unix ms.
+type registry struct {
+	mu      sync.Mutex
+	nextID  int64
+	conns   map[*jsonrpc2.Conn]*ConnectionStatus
+	clients map[ClientInfo]*ClientStatus
+	sources map[string]int64
+}
+
+func newRegistry() *registry {
+	return &registry{
+		conns:   map[*jsonrpc2.Conn]*ConnectionStatus{},
+		clients: map[ClientInfo]*ClientStatus{},
+		sources: map[string]int64{},
+	}
+}
+
+// lookup returns the connection's entry, creating it if needed. The caller
+// holds r.mu.
+func (r *registry) lookup(conn *jsonrpc2.Conn, now int64) *ConnectionStatus {
+	c, ok := r.conns[conn]
+	if !ok {
+		r.nextID++
+		c = &ConnectionStatus{ID: r.nextID, ConnectedAt: now, LastActivity: now}
+		r.conns[conn] = c
+	}
+	return c
+}
+
+func (r *registry) connect(conn *jsonrpc2.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookup(conn, time.Now().UnixMilli())
+}
+
+// live returns the open connections.
+func (r *registry) live() []*jsonrpc2.Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conns := make([]*jsonrpc2.Conn, 0, len(r.conns))
+	for conn := range r.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func (r *registry) disconnect(conn *jsonrpc2.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, conn)
+}
+
+// identify attributes conn to client the first time a request names one.
+func (r *registry) identify(conn *jsonrpc2.Conn, client ClientInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.lookup(conn, time.Now().UnixMilli())
+	if c.Client == (ClientInfo{}) {
+		c.Client = client
+	}
+}
+
+// request counts one finished request on conn towards the connection and
+// its client's totals.
+func (r *registry) request(conn *jsonrpc2.Conn, wrote, failed bool) {
+	now := time.Now().UnixMilli()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.lookup(conn, now)
+	total := r.total(c.Client, c.ConnectedAt)
+	if c.Requests == 0 {
+		total.Connections++
+	}
+
+	c.Requests++
+	c.LastActivity = now
+	if failed {
+		c.Errors++
+	}
+	total.count(now, wrote, failed)
+}
+
+// call counts one finished request made without a connection, such as an
+// HTTP request, towards client's totals. Each one counts as a connection,
+// like a plugin that connects per call.
+func (r *registry) call(client ClientInfo, wrote, failed bool) {
+	now := time.Now().UnixMilli()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := r.total(client, now)
+	total.Connections++
+	total.count(now, wrote, failed)
+}
+
+// total returns client's totals, creating them if needed. The caller holds
+// r.mu.
+func (r *registry) total(client ClientInfo, firstSeen int64) *ClientStatus {
+	total, ok := r.clients[client]
+	if !ok {
+		total = &ClientStatus{Client: client, FirstSeen: firstSeen}
+		r.clients[client] = total
+	}
+	return total
+}
+
+func (c *ClientStatus) count(now int64, wrote, failed bool) {
+	c.Requests++
+	c.LastActivity = now
+	if wrote {
+		c.LastWrite = now
+	}
+	if failed {
+		c.Errors++
+	}
+}
+
+// wrote records a committed write for source, which is empty when the
+// write's session has none.
+func (r *registry) wrote(source string) {
+	now := time.Now().UnixMilli()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[source] = now
+}
+
+// sourceStatus joins the per-source session counts with the recorded write
+// times, most recent write first.
+func (r *registry) sourceStatus(counts []storage.SourceCount) []SourceStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sources := make([]SourceStatus, 0, len(counts)+len(r.sources))
+	seen := map[string]bool{}
+	for _, c := range counts {
+		sources = append(sources, SourceStatus{Source: c.Source, Sessions: c.Sessions, LastWrite: r.sources[c.Source]})
+		seen[c.Source] = true
+	}
+	for source, at := range r.sources {
+		if !seen[source] {
+			sources = append(sources, SourceStatus{Source: source, LastWrite: at})
+		}
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].LastWrite > sources[j].LastWrite })
+	return sources
+}
+
+// snapshot returns copies of the live connections, oldest first, and the
+// client totals, most recently active first.
+func (r *registry) snapshot() ([]ConnectionStatus, []ClientStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conns := make([]ConnectionStatus, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, *c)
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+
+	clients := make([]ClientStatus, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, *c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].LastActivity > clients[j].LastActivity })
+
+	return conns, clients
+}
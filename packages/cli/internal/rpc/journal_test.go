@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dxta-dev/clankers/internal/journal"
+)
+
+func TestCallJournalsAcceptedWrites(t *testing.T) {
+	handler, _ := createHandler(t)
+	dir := filepath.Join(t.TempDir(), "journal")
+	events, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	handler.journal = events
+
+	ctx := context.Background()
+	calls := []struct {
+		method string
+		params string
+	}{
+		{"upsertSession", `{"client": {"name": "opencode", "version": "1"}, "session": {"id": "ses_1", "title": "First"}}`},
+		{"upsertTool", `{"tool": {"id": "t1", "sessionId": "ses_1"}}`}, // rejected: no toolName
+		{"health", `{}`},
+		{"upsertSession", `{"client": {"name": "claude", "version": "2"}, "session": {"id": "ses_1", "title": "Second"}}`},
+	}
+	for _, c := range calls {
+		handler.Call(ctx, c.method, rawParams(t, c.params))
+	}
+	events.Close()
+
+	var recorded []journal.Event
+	journal.Read(dir, journal.Range{}, func(e *journal.Event) error {
+		recorded = append(recorded, *e)
+		return nil
+	})
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 journaled writes, got %d", len(recorded))
+	}
+	if recorded[0].Client.Name != "opencode" || recorded[1].Client.Name != "claude" {
+		t.Errorf("expected client info on events, got %+v", recorded)
+	}
+
+	// Replaying into a fresh database reproduces the final state.
+	replay, store := createHandler(t)
+	for i := range recorded {
+		if _, err := replay.Call(ctx, recorded[i].Method, &recorded[i].Params); err != nil {
+			t.Fatalf("failed to replay event %d: %v", recorded[i].Seq, err)
+		}
+	}
+	session, _, err := store.GetSessionByID("ses_1")
+	if err != nil {
+		t.Fatalf("expected replayed session, got %v", err)
+	}
+	if *session.Title != "Second" {
+		t.Errorf("expected title Second, got %q", *session.Title)
+	}
+}
@@ -0,0 +1,241 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Version is the daemon version reported by health and handshake. The
+// daemon command sets it to the CLI build version.
+var Version = "dev"
+
+// CurrentSchemaVersion is the params shape the handlers decode. Bump it
+// when a payload changes incompatibly and add an upgrade from the previous
+// version.
+const CurrentSchemaVersion = "v1"
+
+// defaultSchemaVersion is assumed when a request has no schemaVersion.
+// Every client released before the handshake sent v1, except record writes
+// from before the envelope, which preEnvelope recognises as v0.
+const defaultSchemaVersion = "v1"
+
+// CodeIncompatibleSchema is returned when a request's schemaVersion is not
+// supported. Data lists what is:
+// {"schemaVersion": "v0", "supported": ["v1"], "daemonVersion": "0.2.0"}.
+const CodeIncompatibleSchema = 4002
+
+// upgrade rewrites the top-level params of a request from schema version
+// From to To. params holds every field of the request, envelope included.
+type upgrade struct {
+	From  string
+	To    string
+	Apply func(method string, params map[string]json.RawMessage) error
+}
+
+// upgrades chain older schema versions up to CurrentSchemaVersion, oldest
+// first.
+var upgrades = []upgrade{
+	{From: "v0", To: "v1", Apply: nestRecord},
+}
+
+// recordFields maps each single-record write to the params field that holds
+// its record in v1.
+var recordFields = map[string]string{
+	"upsertSession":         "session",
+	"upsertMessage":         "message",
+	"upsertTool":            "tool",
+	"upsertSessionError":    "sessionError",
+	"upsertCompactionEvent": "compactionEvent",
+}
+
+// nestRecord upgrades a v0 record write. Before the envelope, plugins sent
+// the record itself as params, e.g. upsertMessage {"id": "m1", "sessionId":
+// ...}; v1 expects it under its field, {"message": {"id": "m1", ...}}.
+// Params that already nest the record are left alone.
+func nestRecord(method string, params map[string]json.RawMessage) error {
+	field, ok := recordFields[method]
+	if !ok {
+		return nil
+	}
+	if _, nested := params[field]; nested {
+		return nil
+	}
+	record := map[string]json.RawMessage{}
+	for key, value := range params {
+		if key == "schemaVersion" || key == "client" {
+			continue
+		}
+		record[key] = value
+		delete(params, key)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	params[field] = data
+	return nil
+}
+
+// preEnvelope reports whether an unversioned request is a v0 record write:
+// the record's fields, starting with its id, at the top level instead of
+// under its field.
+func preEnvelope(method string, fields map[string]json.RawMessage) bool {
+	field, ok := recordFields[method]
+	if !ok {
+		return false
+	}
+	_, nested := fields[field]
+	_, hasID := fields["id"]
+	return !nested && hasID
+}
+
+// methods lists every method Call dispatches, for handshake.
+var methods = []string{
+	"handshake",
+	"health",
+	"status",
+	"ensureDb",
+	"getDbPath",
+	"upsertSession",
+	"upsertMessage",
+	"upsertTool",
+	"upsertSessionError",
+	"upsertCompactionEvent",
+	"ingestBatch",
+	"metrics",
+	"log.write",
+	"shutdown",
+	"subscribe",
+	"query",
+	"listSessions",
+	"getSession",
+	"getTools",
+	"stats",
+	"getHistory",
+	"search",
+}
+
+// Capabilities advertised by handshake, beyond the method list.
+const (
+	CapabilityRevisions     = "revisions"     // session and message writes honour revision
+	CapabilityChangeHistory = "changeHistory" // changed rows are recorded with the client
+	CapabilityJournal       = "journal"       // accepted writes are journaled for replay
+)
+
+type HandshakeParams struct {
+	RequestEnvelope
+}
+
+type HandshakeResult struct {
+	DaemonVersion           string   `json:"daemonVersion"`
+	SchemaVersion           string   `json:"schemaVersion"` // the version requests are decoded as
+	SupportedSchemaVersions []string `json:"supportedSchemaVersions"`
+	Methods                 []string `json:"methods"`
+	Capabilities            []string `json:"capabilities"`
+}
+
+// SupportedSchemaVersions lists the schema versions the daemon accepts,
+// oldest first.
+func SupportedSchemaVersions() []string {
+	var versions []string
+	for _, u := range upgrades {
+		versions = append(versions, u.From)
+	}
+	return append(versions, CurrentSchemaVersion)
+}
+
+func incompatibleSchema(schemaVersion string) *jsonrpc2.Error {
+	data, _ := json.Marshal(map[string]any{
+		"schemaVersion": schemaVersion,
+		"supported":     SupportedSchemaVersions(),
+		"daemonVersion": Version,
+	})
+	raw := json.RawMessage(data)
+	return &jsonrpc2.Error{
+		Code:    CodeIncompatibleSchema,
+		Message: "unsupported schema version " + schemaVersion,
+		Data:    &raw,
+	}
+}
+
+// negotiate checks the request's schemaVersion and upgrades older params to
+// CurrentSchemaVersion. It also returns the envelope's client, if any.
+// Params that are missing or not an object are returned unchanged for the
+// method to reject.
+func negotiate(method string, params *json.RawMessage) (*json.RawMessage, ClientInfo, error) {
+	var client ClientInfo
+	if params == nil {
+		return nil, client, nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(*params, &fields) != nil {
+		return params, client, nil
+	}
+	if raw, ok := fields["client"]; ok {
+		json.Unmarshal(raw, &client)
+	}
+
+	schemaVersion := defaultSchemaVersion
+	if raw, ok := fields["schemaVersion"]; ok {
+		if err := json.Unmarshal(raw, &schemaVersion); err != nil {
+			return nil, client, &jsonrpc2.Error{
+				Code:    jsonrpc2.CodeInvalidParams,
+				Message: "invalid params: schemaVersion must be a string",
+			}
+		}
+	} else if preEnvelope(method, fields) {
+		schemaVersion = "v0"
+	}
+	if schemaVersion == CurrentSchemaVersion {
+		return params, client, nil
+	}
+
+	start := -1
+	for i, u := range upgrades {
+		if u.From == schemaVersion {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, client, incompatibleSchema(schemaVersion)
+	}
+
+	for _, u := range upgrades[start:] {
+		if err := u.Apply(method, fields); err != nil {
+			return nil, client, &jsonrpc2.Error{
+				Code:    jsonrpc2.CodeInvalidParams,
+				Message: "failed to upgrade params from " + u.From + " to " + u.To + ": " + err.Error(),
+			}
+		}
+	}
+	fields["schemaVersion"] = json.RawMessage(`"` + CurrentSchemaVersion + `"`)
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, client, err
+	}
+	upgraded := json.RawMessage(data)
+	return &upgraded, client, nil
+}
+
+func (h *Handler) handshake(params *json.RawMessage) *HandshakeResult {
+	var p HandshakeParams
+	if params != nil {
+		json.Unmarshal(*params, &p)
+	}
+	h.logger.Infof("rpc", "handshake from %s %s (schema %s)", p.Client.Name, p.Client.Version, p.SchemaVersion)
+
+	capabilities := []string{CapabilityRevisions, CapabilityChangeHistory}
+	if h.journal != nil {
+		capabilities = append(capabilities, CapabilityJournal)
+	}
+	return &HandshakeResult{
+		DaemonVersion:           Version,
+		SchemaVersion:           CurrentSchemaVersion,
+		SupportedSchemaVersions: SupportedSchemaVersions(),
+		Methods:                 methods,
+		Capabilities:            capabilities,
+	}
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestHandshake(t *testing.T) {
+	t.Setenv("CLANKERS_DATA_PATH", t.TempDir())
+	handler, _ := createHandler(t)
+	ctx := context.Background()
+
+	result, err := handler.Call(ctx, "handshake", rawParams(t, `{"schemaVersion": "v1", "client": {"name": "test", "version": "1"}}`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	handshake := result.(*HandshakeResult)
+	if handshake.SchemaVersion != CurrentSchemaVersion || handshake.DaemonVersion != Version {
+		t.Errorf("unexpected handshake: %+v", handshake)
+	}
+
+	for _, method := range handshake.Methods {
+		_, err := handler.Call(ctx, method, nil)
+		var rpcErr *jsonrpc2.Error
+		if errors.As(err, &rpcErr) && rpcErr.Code == jsonrpc2.CodeMethodNotFound {
+			t.Errorf("handshake advertises %s but Call does not dispatch it", method)
+		}
+	}
+}
+
+func TestCallRejectsUnsupportedSchema(t *testing.T) {
+	handler, _ := createHandler(t)
+	ctx := context.Background()
+
+	_, err := handler.Call(ctx, "upsertSession", rawParams(t, `{"schemaVersion": "v9", "session": {"id": "ses_1"}}`))
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeIncompatibleSchema {
+		t.Fatalf("expected a %d error, got %v", CodeIncompatibleSchema, err)
+	}
+	var data struct {
+		Supported []string `json:"supported"`
+	}
+	if err := json.Unmarshal(*rpcErr.Data, &data); err != nil || len(data.Supported) == 0 {
+		t.Errorf("expected supported versions in error data, got %s", *rpcErr.Data)
+	}
+
+	if _, err := handler.Call(ctx, "upsertSession", rawParams(t, `{"session": {"id": "ses_1"}}`)); err != nil {
+		t.Errorf("expected a request without schemaVersion to be accepted, got %v", err)
+	}
+}
+
+func TestCallUpgradesOlderSchema(t *testing.T) {
+	handler, store := createHandler(t)
+	ctx := context.Background()
+
+	if got := SupportedSchemaVersions(); len(got) != 2 || got[0] != "v0" {
+		t.Errorf("expected v0 to be supported, got %v", got)
+	}
+
+	// A pre-envelope client sends the record itself as params, with or
+	// without a schemaVersion.
+	requests := []string{
+		`{"id": "ses_1", "title": "Old shape"}`,
+		`{"schemaVersion": "v0", "id": "m1", "sessionId": "ses_1", "role": "user", "textContent": "hi"}`,
+		`{"id": "m2", "sessionId": "ses_1", "role": "assistant", "textContent": "hello"}`,
+	}
+	methods := []string{"upsertSession", "upsertMessage", "upsertMessage"}
+	for i, params := range requests {
+		if _, err := handler.Call(ctx, methods[i], rawParams(t, params)); err != nil {
+			t.Fatalf("%s %s: expected the old shape to be upgraded, got %v", methods[i], params, err)
+		}
+	}
+
+	session, _, err := store.GetSessionByID("ses_1")
+	if err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	if session.Title == nil || *session.Title != "Old shape" {
+		t.Errorf("expected upgraded title, got %v", session.Title)
+	}
+	messages, err := store.GetMessages("ses_1")
+	if err != nil || len(messages) != 2 || messages[0].TextContent != "hi" || messages[1].Role != "assistant" {
+		t.Errorf("expected both upgraded messages, got %+v, %v", messages, err)
+	}
+
+	// v0 params that already nest the record are passed through.
+	if _, err := handler.Call(ctx, "upsertSession", rawParams(t, `{"schemaVersion": "v0", "session": {"id": "ses_2"}}`)); err != nil {
+		t.Errorf("expected nested v0 params to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// CodeWriteNotAllowed is returned by query for a statement that would
+// write. Nothing was run.
+const CodeWriteNotAllowed = 4005
+
+// CodeNotFound is returned by getSession for an unknown session id.
+const CodeNotFound = 4006
+
+// Limits for query. The daemon also ingests, so one statement may neither
+// run nor buffer rows without bound. Tests lower them.
+var (
+	queryTimeout = 30 * time.Second
+	maxQueryRows = 10000 // more are dropped and the result marked truncated
+)
+
+type QueryParams struct {
+	RequestEnvelope
+	SQL string `json:"sql"`
+}
+
+type ListSessionsParams struct {
+	RequestEnvelope
+	Filter storage.SessionFilter `json:"filter"`
+}
+
+type GetSessionParams struct {
+	RequestEnvelope
+	ID string `json:"id"`
+}
+
+type GetToolsParams struct {
+	RequestEnvelope
+	SessionID string `json:"sessionId"`
+}
+
+type GetToolsResult struct {
+	Tools []storage.Tool `json:"tools"`
+}
+
+type StatsParams struct {
+	RequestEnvelope
+	Filter storage.SessionFilter `json:"filter"`
+}
+
+type GetHistoryParams struct {
+	RequestEnvelope
+	SessionID string `json:"sessionId"`
+}
+
+type GetHistoryResult struct {
+	History []storage.HistoryEntry `json:"history"`
+}
+
+type SearchParams struct {
+	RequestEnvelope
+	Terms   string                `json:"terms"`
+	Options storage.SearchOptions `json:"options"`
+}
+
+type SearchResult struct {
+	Hits []storage.SearchHit `json:"hits"`
+}
+
+// decodeParams unmarshals required params into v.
+func decodeParams(params *json.RawMessage, v any) error {
+	if params == nil {
+		return &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "missing params",
+		}
+	}
+	if err := json.Unmarshal(*params, v); err != nil {
+		return &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "invalid params: " + err.Error(),
+		}
+	}
+	return nil
+}
+
+// readError gives storage errors a code clients can act on. Any other
+// error is the daemon's and is reported as CodeInternalError.
+func readError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrWriteNotAllowed):
+		return &jsonrpc2.Error{Code: CodeWriteNotAllowed, Message: err.Error()}
+	case errors.Is(err, storage.ErrSessionNotFound):
+		return &jsonrpc2.Error{Code: CodeNotFound, Message: err.Error()}
+	case errors.Is(err, storage.ErrInvalidFilter):
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+	default:
+		return &jsonrpc2.Error{Code: jsonrpc2.CodeInternalError, Message: err.Error()}
+	}
+}
+
+// statementError is readError for methods that run SQL or a search
+// expression sent by the client, where an error compiling or running it is
+// most likely in the input and is reported as CodeInvalidParams.
+func statementError(err error) error {
+	if errors.Is(err, storage.ErrWriteNotAllowed) {
+		return readError(err)
+	}
+	return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: err.Error()}
+}
+
+// query runs one read-only statement on the daemon's read pool, for at most
+// queryTimeout and maxQueryRows. Drain interrupts it.
+func (h *Handler) query(ctx context.Context, params *json.RawMessage) (*storage.QueryResult, error) {
+	var p QueryParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	stop := context.AfterFunc(h.stopping, cancel)
+	defer stop()
+
+	result, err := h.store.ExecuteQuery(ctx, p.SQL, maxQueryRows)
+	switch {
+	case err == nil:
+		return result, nil
+	case h.stopping.Err() != nil:
+		return nil, errShuttingDown
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: fmt.Sprintf("query ran longer than %s and was stopped", queryTimeout),
+		}
+	default:
+		return nil, statementError(err)
+	}
+}
+
+func (h *Handler) listSessions(params *json.RawMessage) (*storage.SessionPage, error) {
+	var p ListSessionsParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	page, err := h.store.ListSessions(p.Filter)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return page, nil
+}
+
+// getSession returns a session with its messages, tools, errors and
+// compactions in time order.
+func (h *Handler) getSession(params *json.RawMessage) (*storage.Transcript, error) {
+	var p GetSessionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.ID == "" {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "invalid params: id is required",
+		}
+	}
+
+	transcript, err := h.store.GetTranscript(p.ID)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return transcript, nil
+}
+
+func (h *Handler) getTools(params *json.RawMessage) (*GetToolsResult, error) {
+	var p GetToolsParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.SessionID == "" {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "invalid params: sessionId is required",
+		}
+	}
+
+	tools, err := h.store.GetTools(p.SessionID)
+	if err != nil {
+		return nil, readError(err)
+	}
+	if tools == nil {
+		tools = []storage.Tool{}
+	}
+	return &GetToolsResult{Tools: tools}, nil
+}
+
+// stats aggregates the sessions matching the filter.
+func (h *Handler) stats(params *json.RawMessage) (*storage.Stats, error) {
+	var p StatsParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	stats, err := h.store.GetStats(p.Filter)
+	if err != nil {
+		return nil, readError(err)
+	}
+	return stats, nil
+}
+
+// getHistory returns the recorded writes to a session, oldest first.
+func (h *Handler) getHistory(params *json.RawMessage) (*GetHistoryResult, error) {
+	var p GetHistoryParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.SessionID == "" {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidParams,
+			Message: "invalid params: sessionId is required",
+		}
+	}
+
+	history, err := h.store.GetHistory(p.SessionID)
+	if err != nil {
+		return nil, readError(err)
+	}
+	if history == nil {
+		history = []storage.HistoryEntry{}
+	}
+	return &GetHistoryResult{History: history}, nil
+}
+
+// search runs a full-text search over messages and tool calls.
+func (h *Handler) search(params *json.RawMessage) (*SearchResult, error) {
+	var p SearchParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	hits, err := h.store.Search(p.Terms, p.Options)
+	if err != nil {
+		return nil, statementError(err)
+	}
+	if hits == nil {
+		hits = []storage.SearchHit{}
+	}
+	return &SearchResult{Hits: hits}, nil
+}
@@ -0,0 +1,219 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func expectCode(t *testing.T, err error, code int64) {
+	t.Helper()
+	var rpcErr *jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != code {
+		t.Errorf("expected error code %d, got %v", code, err)
+	}
+}
+
+func TestReadMethods(t *testing.T) {
+	handler, _ := createHandler(t)
+	ctx := context.Background()
+
+	if _, err := handler.Call(ctx, "ingestBatch", rawParams(t, `{
+		"items": [
+			{"kind": "session", "session": {"id": "ses_1", "projectName": "alpha", "createdAt": 1}},
+			{"kind": "session", "session": {"id": "ses_2", "projectName": "beta", "createdAt": 2}},
+			{"kind": "message", "message": {"id": "m1", "sessionId": "ses_1", "role": "user", "textContent": "hi", "createdAt": 3}},
+			{"kind": "tool", "tool": {"id": "t1", "sessionId": "ses_1", "toolName": "Read", "createdAt": 4}}
+		]
+	}`)); err != nil {
+		t.Fatalf("failed to seed: %v", err)
+	}
+
+	t.Run("query", func(t *testing.T) {
+		result, err := handler.Call(ctx, "query", rawParams(t, `{"sql": "SELECT id FROM sessions ORDER BY id"}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		rows := result.(*storage.QueryResult).Rows
+		if len(rows) != 2 || rows[0][0] != "ses_1" {
+			t.Errorf("expected both sessions, got %v", rows)
+		}
+
+		_, err = handler.Call(ctx, "query", rawParams(t, `{"sql": "DELETE FROM sessions"}`))
+		expectCode(t, err, CodeWriteNotAllowed)
+		_, err = handler.Call(ctx, "query", rawParams(t, `{"sql": "SELECT nope FROM sessions"}`))
+		expectCode(t, err, jsonrpc2.CodeInvalidParams)
+	})
+
+	t.Run("listSessions", func(t *testing.T) {
+		result, err := handler.Call(ctx, "listSessions", rawParams(t, `{"filter": {"project": "beta"}}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		page := result.(*storage.SessionPage)
+		if len(page.Sessions) != 1 || page.Sessions[0].ID != "ses_2" {
+			t.Errorf("expected only ses_2, got %+v", page.Sessions)
+		}
+
+		_, err = handler.Call(ctx, "listSessions", rawParams(t, `{"filter": {"sort": "title"}}`))
+		expectCode(t, err, jsonrpc2.CodeInvalidParams)
+		_, err = handler.Call(ctx, "listSessions", rawParams(t, `{"filter": {"cursor": "nope"}}`))
+		expectCode(t, err, jsonrpc2.CodeInvalidParams)
+	})
+
+	t.Run("getSession", func(t *testing.T) {
+		result, err := handler.Call(ctx, "getSession", rawParams(t, `{"id": "ses_1"}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		transcript := result.(*storage.Transcript)
+		if transcript.Session.ID != "ses_1" || len(transcript.Entries) != 2 {
+			t.Errorf("expected ses_1 with a message and a tool, got %+v", transcript)
+		}
+
+		_, err = handler.Call(ctx, "getSession", rawParams(t, `{"id": "missing"}`))
+		expectCode(t, err, CodeNotFound)
+		_, err = handler.Call(ctx, "getSession", rawParams(t, `{}`))
+		expectCode(t, err, jsonrpc2.CodeInvalidParams)
+	})
+
+	t.Run("getTools", func(t *testing.T) {
+		result, err := handler.Call(ctx, "getTools", rawParams(t, `{"sessionId": "ses_1"}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		tools := result.(*GetToolsResult).Tools
+		if len(tools) != 1 || tools[0].ToolName != "Read" {
+			t.Errorf("expected the Read tool, got %+v", tools)
+		}
+
+		result, err = handler.Call(ctx, "getTools", rawParams(t, `{"sessionId": "ses_2"}`))
+		if err != nil || result.(*GetToolsResult).Tools == nil {
+			t.Errorf("expected an empty list, got %v, %v", result, err)
+		}
+	})
+	t.Run("stats", func(t *testing.T) {
+		result, err := handler.Call(ctx, "stats", rawParams(t, `{"filter": {"project": "alpha"}}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		totals := result.(*storage.Stats).Totals
+		if totals.Sessions != 1 || totals.Messages != 1 || totals.ToolCalls != 1 {
+			t.Errorf("expected ses_1's counts, got %+v", totals)
+		}
+	})
+
+	t.Run("getHistory", func(t *testing.T) {
+		result, err := handler.Call(ctx, "getHistory", rawParams(t, `{"sessionId": "ses_1"}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		history := result.(*GetHistoryResult).History
+		if len(history) != 3 || history[0].RowID != "ses_1" {
+			t.Errorf("expected the session, message and tool inserts, got %+v", history)
+		}
+
+		_, err = handler.Call(ctx, "getHistory", rawParams(t, `{}`))
+		expectCode(t, err, jsonrpc2.CodeInvalidParams)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		result, err := handler.Call(ctx, "search", rawParams(t, `{"terms": "hi", "options": {"project": "alpha"}}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		hits := result.(*SearchResult).Hits
+		if len(hits) != 1 || hits[0].ID != "m1" {
+			t.Errorf("expected m1, got %+v", hits)
+		}
+
+		_, err = handler.Call(ctx, "search", rawParams(t, `{"terms": "\"unterminated", "options": {"raw": true}}`))
+		expectCode(t, err, jsonrpc2.CodeInvalidParams)
+	})
+}
+
+func TestQueryLimits(t *testing.T) {
+	handler, _ := createHandler(t)
+	ctx := context.Background()
+	endless := `{"sql": "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT x FROM c"}`
+	counting := `{"sql": "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c"}`
+
+	savedTimeout, savedRows := queryTimeout, maxQueryRows
+	t.Cleanup(func() { queryTimeout, maxQueryRows = savedTimeout, savedRows })
+	queryTimeout, maxQueryRows = 100*time.Millisecond, 3
+
+	result, err := handler.Call(ctx, "query", rawParams(t, endless))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r := result.(*storage.QueryResult); len(r.Rows) != 3 || !r.Truncated {
+		t.Errorf("expected 3 rows marked truncated, got %d rows, truncated %v", len(r.Rows), r.Truncated)
+	}
+
+	_, err = handler.Call(ctx, "query", rawParams(t, counting))
+	expectCode(t, err, jsonrpc2.CodeInvalidParams)
+
+	// Drain interrupts a running query instead of waiting for its timeout.
+	queryTimeout = time.Minute
+	done := make(chan error, 1)
+	go func() {
+		_, err := handler.Call(ctx, "query", rawParams(t, counting))
+		done <- err
+	}()
+	for running := 0; running == 0; time.Sleep(time.Millisecond) {
+		handler.drainMu.Lock()
+		running = handler.active
+		handler.drainMu.Unlock()
+	}
+	drainCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := handler.Drain(drainCtx); err != nil {
+		t.Fatalf("expected drain to interrupt the query, got %v", err)
+	}
+	expectCode(t, <-done, CodeShuttingDown)
+}
+
+// TestQueryOverTheWire checks that a query read through the daemon returns
+// the same values as a direct one, REAL columns included.
+func TestQueryOverTheWire(t *testing.T) {
+	handler, store := createHandler(t)
+	ctx := context.Background()
+
+	if _, err := handler.Call(ctx, "ingestBatch", rawParams(t, `{
+		"items": [
+			{"kind": "session", "session": {"id": "ses_1", "cost": 2.0, "createdAt": 1}},
+			{"kind": "session", "session": {"id": "ses_2", "cost": 0.25, "createdAt": 2}}
+		]
+	}`)); err != nil {
+		t.Fatalf("failed to seed: %v", err)
+	}
+
+	sql := "SELECT id, cost, created_at, cost * 4 AS scaled FROM sessions ORDER BY id"
+	direct, err := store.ExecuteQuery(ctx, sql, 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	conn, _ := connect(t, handler)
+	var wire storage.QueryResult
+	if err := conn.Call(ctx, "query", QueryParams{RequestEnvelope: RequestEnvelope{SchemaVersion: CurrentSchemaVersion}, SQL: sql}, &wire); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(wire.Rows, direct.Rows) {
+		t.Errorf("expected %#v over the wire, got %#v", direct.Rows, wire.Rows)
+	}
+	if cost := wire.Rows[0][1]; cost != 2.0 {
+		t.Errorf("expected REAL cost 2.0, got %#v", cost)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	expectCode(t, readError(storage.ErrSessionNotFound), CodeNotFound)
+	expectCode(t, readError(storage.ErrInvalidFilter), jsonrpc2.CodeInvalidParams)
+	expectCode(t, readError(errors.New("disk I/O error")), jsonrpc2.CodeInternalError)
+}
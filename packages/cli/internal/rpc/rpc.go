@@ -4,15 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sync"
+	"time"
 
+	"github.com/dxta-dev/clankers/internal/ingest"
+	"github.com/dxta-dev/clankers/internal/journal"
 	"github.com/dxta-dev/clankers/internal/logging"
 	"github.com/dxta-dev/clankers/internal/paths"
 	"github.com/dxta-dev/clankers/internal/storage"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
-const version = "0.1.0"
-
 type ClientInfo struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
@@ -21,6 +23,9 @@ type ClientInfo struct {
 type RequestEnvelope struct {
 	SchemaVersion string     `json:"schemaVersion"`
 	Client        ClientInfo `json:"client"`
+	// Token is required on the TCP listener and removed before the request
+	// is handled, so it never reaches the journal.
+	Token string `json:"token,omitempty"`
 }
 
 type HealthResult struct {
@@ -71,63 +76,207 @@ type LogWriteParams struct {
 	Entry logging.LogEntry `json:"entry"`
 }
 
+type MetricsResult struct {
+	WriteQueue ingest.Stats `json:"writeQueue"`
+}
+
+// journaledMethods are the write methods recorded in the event journal.
+// Replaying them in order rebuilds the database.
+var journaledMethods = map[string]bool{
+	"upsertSession":         true,
+	"upsertMessage":         true,
+	"upsertTool":            true,
+	"upsertSessionError":    true,
+	"upsertCompactionEvent": true,
+	"ingestBatch":           true,
+}
+
 type Handler struct {
-	store  *storage.Store
-	logger *logging.Logger
+	store     *storage.Store
+	writes    *ingest.Queue
+	journal   *journal.Journal
+	logger    *logging.Logger
+	clients   *registry
+	events    *hub
+	startedAt time.Time
+
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
+
+	drainMu  sync.Mutex
+	active   int
+	draining bool
+	drained  chan struct{}
+
+	// stopping is cancelled when Drain starts, to interrupt queries.
+	stopping context.Context
+	stop     context.CancelFunc
 }
 
-func NewHandler(store *storage.Store, logger *logging.Logger) *Handler {
-	return &Handler{store: store, logger: logger}
+// NewHandler returns a handler that sends every write through writes and,
+// when journal is not nil, records each accepted write request in it.
+func NewHandler(store *storage.Store, writes *ingest.Queue, journal *journal.Journal, logger *logging.Logger) *Handler {
+	stopping, stop := context.WithCancel(context.Background())
+	return &Handler{
+		store:     store,
+		writes:    writes,
+		journal:   journal,
+		logger:    logger,
+		clients:   newRegistry(),
+		events:    newHub(),
+		startedAt: time.Now(),
+		shutdown:  make(chan struct{}),
+		drained:   make(chan struct{}),
+		stopping:  stopping,
+		stop:      stop,
+	}
+}
+
+// Connect registers a new connection for status. Requests on a connection
+// that was not registered register it themselves.
+func (h *Handler) Connect(conn *jsonrpc2.Conn) {
+	h.clients.connect(conn)
+}
+
+// Disconnect removes a connection from the live list and ends its
+// subscriptions. Its counts stay in the per-client totals.
+func (h *Handler) Disconnect(conn *jsonrpc2.Conn) {
+	h.clients.disconnect(conn)
+	h.events.remove(conn)
 }
 
 func (h *Handler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if !h.begin() {
+		conn.ReplyWithError(ctx, req.ID, errShuttingDown)
+		return
+	}
+	defer h.end()
+
+	params, client, err := negotiate(req.Method, req.Params)
+	h.clients.identify(conn, client)
+	var result any
+	if err == nil {
+		result, err = h.dispatch(ctx, conn, req.Method, params, client)
+	}
+	h.clients.request(conn, err == nil && journaledMethods[req.Method], err != nil)
+
+	if err != nil {
+		var rpcErr *jsonrpc2.Error
+		if errors.As(err, &rpcErr) {
+			conn.ReplyWithError(ctx, req.ID, rpcErr)
+		} else {
+			conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
+				Code:    jsonrpc2.CodeInternalError,
+				Message: err.Error(),
+			})
+		}
+		return
+	}
+
+	conn.Reply(ctx, req.ID, result)
+}
+
+// Call runs one method without a connection, for the HTTP API and replay.
+// Like Handle, it is rejected with CodeShuttingDown once Drain has started
+// and is counted towards its client in status. Params in an older schema
+// version are upgraded first. Write requests that succeed are appended to
+// the journal, in their upgraded form, before Call returns.
+func (h *Handler) Call(ctx context.Context, method string, params *json.RawMessage) (any, error) {
+	if !h.begin() {
+		return nil, errShuttingDown
+	}
+	defer h.end()
+
+	params, client, err := negotiate(method, params)
+	var result any
+	if err == nil {
+		result, err = h.dispatch(ctx, nil, method, params, client)
+	}
+	h.clients.call(client, err == nil && journaledMethods[method], err != nil)
+	return result, err
+}
+
+// dispatch runs a method on negotiated params. conn is nil for Call.
+func (h *Handler) dispatch(ctx context.Context, conn *jsonrpc2.Conn, method string, params *json.RawMessage, client ClientInfo) (any, error) {
+	receivedAt := time.Now()
+
 	var result any
 	var err error
 
-	switch req.Method {
+	switch method {
+	case "handshake":
+		result = h.handshake(params)
 	case "health":
 		result = h.health()
+	case "status":
+		result, err = h.status()
 	case "ensureDb":
 		result, err = h.ensureDb()
 	case "getDbPath":
 		result = h.getDbPath()
 	case "upsertSession":
-		result, err = h.upsertSession(req.Params)
+		result, err = h.upsertSession(ctx, params)
 	case "upsertMessage":
-		result, err = h.upsertMessage(req.Params)
+		result, err = h.upsertMessage(ctx, params)
 	case "upsertTool":
-		result, err = h.upsertTool(req.Params)
+		result, err = h.upsertTool(ctx, params)
 	case "upsertSessionError":
-		result, err = h.upsertSessionError(req.Params)
+		result, err = h.upsertSessionError(ctx, params)
 	case "upsertCompactionEvent":
-		result, err = h.upsertCompactionEvent(req.Params)
+		result, err = h.upsertCompactionEvent(ctx, params)
+	case "ingestBatch":
+		result, err = h.ingestBatch(ctx, params)
+	case "metrics":
+		result = h.metrics()
+	case "shutdown":
+		result = h.requestShutdown(client)
+	case "subscribe":
+		result, err = h.subscribe(conn, params, client)
+	case "query":
+		result, err = h.query(ctx, params)
+	case "listSessions":
+		result, err = h.listSessions(params)
+	case "getSession":
+		result, err = h.getSession(params)
+	case "getTools":
+		result, err = h.getTools(params)
+	case "stats":
+		result, err = h.stats(params)
+	case "getHistory":
+		result, err = h.getHistory(params)
+	case "search":
+		result, err = h.search(params)
 	case "log.write":
-		result, err = h.logWrite(req.Params)
+		result, err = h.logWrite(params)
 	default:
 		err = &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeMethodNotFound,
-			Message: "method not found: " + req.Method,
+			Message: "method not found: " + method,
 		}
 	}
 
-	if err != nil {
-		var rpcErr *jsonrpc2.Error
-		if errors.As(err, &rpcErr) {
-			conn.ReplyWithError(ctx, req.ID, rpcErr)
-		} else {
-			conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: err.Error(),
-			})
-		}
-		return
+	if err == nil && h.journal != nil && journaledMethods[method] {
+		h.record(method, params, client, receivedAt)
 	}
+	return result, err
+}
 
-	conn.Reply(ctx, req.ID, result)
+// record appends an accepted write to the journal. The write is already
+// committed, so a journal failure is logged rather than returned.
+func (h *Handler) record(method string, params *json.RawMessage, client ClientInfo, receivedAt time.Time) {
+	err := h.journal.Append(&journal.Event{
+		ReceivedAt: receivedAt.UnixMilli(),
+		Method:     method,
+		Client:     storage.Client(client),
+		Params:     *params,
+	})
+	if err != nil {
+		h.logger.Errorf("rpc", "failed to journal %s from %s: %v", method, client.Name, err)
+	}
 }
 
 func (h *Handler) health() *HealthResult {
-	return &HealthResult{OK: true, Version: version}
+	return &HealthResult{OK: true, Version: Version}
 }
 
 func (h *Handler) ensureDb() (*EnsureDbResult, error) {
@@ -143,7 +292,28 @@ func (h *Handler) getDbPath() *GetDbPathResult {
 	return &GetDbPathResult{DbPath: paths.GetDbPath()}
 }
 
-func (h *Handler) upsertSession(params *json.RawMessage) (*OkResult, error) {
+func (h *Handler) metrics() *MetricsResult {
+	return &MetricsResult{WriteQueue: h.writes.Stats()}
+}
+
+// write submits one op to the write queue and waits until it is committed.
+func (h *Handler) write(ctx context.Context, client ClientInfo, op ingest.Op) (storage.Change, error) {
+	results, err := h.writes.Submit(ctx, storage.Client(client), op)
+	if err != nil {
+		return "", err
+	}
+	return results[0].Change, results[0].Err
+}
+
+// logStale records a write that arrived after a newer one for the same row.
+// Its version-gated fields were not applied.
+func (h *Handler) logStale(change storage.Change, kind, id string, client ClientInfo) {
+	if change == storage.ChangeStale {
+		h.logger.Debugf("rpc", "ignored stale %s write for %s from %s %s", kind, id, client.Name, client.Version)
+	}
+}
+
+func (h *Handler) upsertSession(ctx context.Context, params *json.RawMessage) (*OkResult, error) {
 	if params == nil {
 		return nil, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeInvalidParams,
@@ -159,23 +329,23 @@ func (h *Handler) upsertSession(params *json.RawMessage) (*OkResult, error) {
 		}
 	}
 
-	if p.Session.ID == "" {
-		data := json.RawMessage(`{"field": "id"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid session payload",
-			Data:    &data,
-		}
+	if err := validateSession(&p.Session); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.UpsertSession(&p.Session); err != nil {
+	change, err := h.write(ctx, p.Client, func(b *storage.Batch) (storage.Change, error) {
+		return b.UpsertSession(&p.Session)
+	})
+	if err != nil {
 		return nil, err
 	}
+	h.logStale(change, "session", p.Session.ID, p.Client)
+	h.committed(p.Client, change, &IngestItem{Kind: KindSession, Session: &p.Session})
 
 	return &OkResult{OK: true}, nil
 }
 
-func (h *Handler) upsertMessage(params *json.RawMessage) (*OkResult, error) {
+func (h *Handler) upsertMessage(ctx context.Context, params *json.RawMessage) (*OkResult, error) {
 	if params == nil {
 		return nil, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeInvalidParams,
@@ -191,31 +361,23 @@ func (h *Handler) upsertMessage(params *json.RawMessage) (*OkResult, error) {
 		}
 	}
 
-	if p.Message.ID == "" {
-		data := json.RawMessage(`{"field": "id"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid message payload",
-			Data:    &data,
-		}
-	}
-	if p.Message.SessionID == "" {
-		data := json.RawMessage(`{"field": "sessionId"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid message payload",
-			Data:    &data,
-		}
+	if err := validateMessage(&p.Message); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.UpsertMessage(&p.Message); err != nil {
+	change, err := h.write(ctx, p.Client, func(b *storage.Batch) (storage.Change, error) {
+		return b.UpsertMessage(&p.Message)
+	})
+	if err != nil {
 		return nil, err
 	}
+	h.logStale(change, "message", p.Message.ID, p.Client)
+	h.committed(p.Client, change, &IngestItem{Kind: KindMessage, Message: &p.Message})
 
 	return &OkResult{OK: true}, nil
 }
 
-func (h *Handler) upsertTool(params *json.RawMessage) (*OkResult, error) {
+func (h *Handler) upsertTool(ctx context.Context, params *json.RawMessage) (*OkResult, error) {
 	if params == nil {
 		return nil, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeInvalidParams,
@@ -231,39 +393,22 @@ func (h *Handler) upsertTool(params *json.RawMessage) (*OkResult, error) {
 		}
 	}
 
-	if p.Tool.ID == "" {
-		data := json.RawMessage(`{"field": "id"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid tool payload",
-			Data:    &data,
-		}
-	}
-	if p.Tool.SessionID == "" {
-		data := json.RawMessage(`{"field": "sessionId"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid tool payload",
-			Data:    &data,
-		}
-	}
-	if p.Tool.ToolName == "" {
-		data := json.RawMessage(`{"field": "toolName"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid tool payload",
-			Data:    &data,
-		}
+	if err := validateTool(&p.Tool); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.UpsertTool(&p.Tool); err != nil {
+	change, err := h.write(ctx, p.Client, func(b *storage.Batch) (storage.Change, error) {
+		return b.UpsertTool(&p.Tool)
+	})
+	if err != nil {
 		return nil, err
 	}
+	h.committed(p.Client, change, &IngestItem{Kind: KindTool, Tool: &p.Tool})
 
 	return &OkResult{OK: true}, nil
 }
 
-func (h *Handler) upsertSessionError(params *json.RawMessage) (*OkResult, error) {
+func (h *Handler) upsertSessionError(ctx context.Context, params *json.RawMessage) (*OkResult, error) {
 	if params == nil {
 		return nil, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeInvalidParams,
@@ -279,31 +424,22 @@ func (h *Handler) upsertSessionError(params *json.RawMessage) (*OkResult, error)
 		}
 	}
 
-	if p.SessionError.ID == "" {
-		data := json.RawMessage(`{"field": "id"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid session error payload",
-			Data:    &data,
-		}
-	}
-	if p.SessionError.SessionID == "" {
-		data := json.RawMessage(`{"field": "sessionId"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid session error payload",
-			Data:    &data,
-		}
+	if err := validateSessionError(&p.SessionError); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.UpsertSessionError(&p.SessionError); err != nil {
+	change, err := h.write(ctx, p.Client, func(b *storage.Batch) (storage.Change, error) {
+		return b.UpsertSessionError(&p.SessionError)
+	})
+	if err != nil {
 		return nil, err
 	}
+	h.committed(p.Client, change, &IngestItem{Kind: KindSessionError, SessionError: &p.SessionError})
 
 	return &OkResult{OK: true}, nil
 }
 
-func (h *Handler) upsertCompactionEvent(params *json.RawMessage) (*OkResult, error) {
+func (h *Handler) upsertCompactionEvent(ctx context.Context, params *json.RawMessage) (*OkResult, error) {
 	if params == nil {
 		return nil, &jsonrpc2.Error{
 			Code:    jsonrpc2.CodeInvalidParams,
@@ -319,26 +455,17 @@ func (h *Handler) upsertCompactionEvent(params *json.RawMessage) (*OkResult, err
 		}
 	}
 
-	if p.CompactionEvent.ID == "" {
-		data := json.RawMessage(`{"field": "id"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid compaction event payload",
-			Data:    &data,
-		}
-	}
-	if p.CompactionEvent.SessionID == "" {
-		data := json.RawMessage(`{"field": "sessionId"}`)
-		return nil, &jsonrpc2.Error{
-			Code:    4001,
-			Message: "invalid compaction event payload",
-			Data:    &data,
-		}
+	if err := validateCompactionEvent(&p.CompactionEvent); err != nil {
+		return nil, err
 	}
 
-	if err := h.store.UpsertCompactionEvent(&p.CompactionEvent); err != nil {
+	change, err := h.write(ctx, p.Client, func(b *storage.Batch) (storage.Change, error) {
+		return b.UpsertCompactionEvent(&p.CompactionEvent)
+	})
+	if err != nil {
 		return nil, err
 	}
+	h.committed(p.Client, change, &IngestItem{Kind: KindCompactionEvent, CompactionEvent: &p.CompactionEvent})
 
 	return &OkResult{OK: true}, nil
 }
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// CodeShuttingDown is returned for requests that arrive while the daemon is
+// draining. Nothing was written; clients may retry once a daemon is back.
+const CodeShuttingDown = 4003
+
+// NotifyShutdown is the notification sent to every open connection when
+// the daemon starts shutting down.
+const NotifyShutdown = "daemon.shutdown"
+
+var errShuttingDown = &jsonrpc2.Error{
+	Code:    CodeShuttingDown,
+	Message: "daemon is shutting down",
+}
+
+// ShutdownRequested is closed once a client calls shutdown. The daemon
+// stops accepting connections when it fires, as it does on SIGTERM.
+func (h *Handler) ShutdownRequested() <-chan struct{} {
+	return h.shutdown
+}
+
+// requestShutdown replies before the daemon goes away, so the caller can
+// tell an accepted request from a dropped connection.
+func (h *Handler) requestShutdown(client ClientInfo) *OkResult {
+	h.shutdownOnce.Do(func() {
+		h.logger.Infof("rpc", "shutdown requested by %s %s", client.Name, client.Version)
+		close(h.shutdown)
+	})
+	return &OkResult{OK: true}
+}
+
+// begin registers an in-flight request. It returns false once Drain has
+// started.
+func (h *Handler) begin() bool {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+
+	if h.draining {
+		return false
+	}
+	h.active++
+	return true
+}
+
+func (h *Handler) end() {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+
+	h.active--
+	if h.draining && h.active == 0 {
+		close(h.drained)
+	}
+}
+
+// Drain rejects new requests with CodeShuttingDown, interrupts running
+// queries, notifies open connections with NotifyShutdown and waits until
+// in-flight requests have replied or ctx is done. Every connection is closed before it returns.
+// Writes of requests that replied are committed; the caller still closes
+// the write queue to commit anything submitted without a reply.
+func (h *Handler) Drain(ctx context.Context) error {
+	h.drainMu.Lock()
+	if !h.draining {
+		h.draining = true
+		if h.active == 0 {
+			close(h.drained)
+		}
+	}
+	active := h.active
+	h.drainMu.Unlock()
+	h.stop()
+
+	conns := h.clients.live()
+	h.logger.Infof("rpc", "draining %d in-flight requests on %d connections", active, len(conns))
+	for _, conn := range conns {
+		conn.Notify(ctx, NotifyShutdown, nil)
+	}
+
+	var err error
+	select {
+	case <-h.drained:
+	case <-ctx.Done():
+		h.drainMu.Lock()
+		err = fmt.Errorf("%d requests still running: %w", h.active, ctx.Err())
+		h.drainMu.Unlock()
+	}
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return err
+}
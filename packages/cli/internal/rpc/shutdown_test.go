@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	handler, _ := createHandler(t)
+	ctx := context.Background()
+
+	select {
+	case <-handler.ShutdownRequested():
+		t.Fatal("expected no shutdown before the request")
+	default:
+	}
+
+	// A second call, e.g. from a retrying client, must not panic.
+	for i := 0; i < 2; i++ {
+		if _, err := handler.Call(ctx, "shutdown", nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	select {
+	case <-handler.ShutdownRequested():
+	default:
+		t.Error("expected shutdown to be requested")
+	}
+}
+
+func TestDrainWaitsForInflightRequests(t *testing.T) {
+	handler, _ := createHandler(t)
+
+	if !handler.begin() {
+		t.Fatal("expected a request to start before draining")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- handler.Drain(context.Background()) }()
+
+	// Drain marks the handler before it waits, so new requests are
+	// rejected while the first one is still running.
+	deadline := time.Now().Add(time.Second)
+	for handler.begin() {
+		handler.end()
+		if time.Now().After(deadline) {
+			t.Fatal("expected requests to be rejected while draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("expected drain to wait for the running request, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	handler.end()
+	if err := <-drained; err != nil {
+		t.Errorf("expected drain to finish cleanly, got %v", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	handler, _ := createHandler(t)
+
+	if !handler.begin() {
+		t.Fatal("expected a request to start before draining")
+	}
+	defer handler.end()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := handler.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+}
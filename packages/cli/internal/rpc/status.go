@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"os"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/ingest"
+	"github.com/dxta-dev/clankers/internal/paths"
+)
+
+type StatusResult struct {
+	Version       string             `json:"version"`
+	PID           int                `json:"pid"`
+	StartedAt     int64              `json:"startedAt"`
+	UptimeSeconds int64              `json:"uptimeSeconds"`
+	SocketPath    string             `json:"socketPath"`
+	DbPath        string             `json:"dbPath"`
+	DbSizeBytes   int64              `json:"dbSizeBytes"` // database plus WAL
+	Journal       bool               `json:"journal"`
+	WriteQueue    ingest.Stats       `json:"writeQueue"`
+	Sources       []SourceStatus     `json:"sources"`
+	Clients       []ClientStatus     `json:"clients"`
+	Connections   []ConnectionStatus `json:"connections"`
+}
+
+func (h *Handler) status() (*StatusResult, error) {
+	counts, err := h.store.CountSessionsBySource()
+	if err != nil {
+		return nil, err
+	}
+	conns, clients := h.clients.snapshot()
+
+	dbPath := paths.GetDbPath()
+	var size int64
+	for _, path := range []string{dbPath, dbPath + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+
+	return &StatusResult{
+		Version:       Version,
+		PID:           os.Getpid(),
+		StartedAt:     h.startedAt.UnixMilli(),
+		UptimeSeconds: int64(time.Since(h.startedAt).Seconds()),
+		SocketPath:    paths.GetSocketPath(),
+		DbPath:        dbPath,
+		DbSizeBytes:   size,
+		Journal:       h.journal != nil,
+		WriteQueue:    h.writes.Stats(),
+		Sources:       h.clients.sourceStatus(counts),
+		Clients:       clients,
+		Connections:   conns,
+	}, nil
+}
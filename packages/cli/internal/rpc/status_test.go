@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestRegistry(t *testing.T) {
+	r := newRegistry()
+	plugin := ClientInfo{Name: "opencode-plugin", Version: "1.0"}
+
+	// Plugins open a connection per call.
+	first, second := &jsonrpc2.Conn{}, &jsonrpc2.Conn{}
+	r.connect(first)
+	r.identify(first, plugin)
+	r.request(first, true, false)
+	r.disconnect(first)
+
+	r.connect(second)
+	r.identify(second, plugin)
+	r.request(second, false, true)
+	r.identify(second, ClientInfo{Name: "other"}) // a later envelope does not re-attribute
+	r.request(second, false, false)
+
+	conns, clients := r.snapshot()
+	if len(conns) != 1 || conns[0].Client != plugin || conns[0].Requests != 2 || conns[0].Errors != 1 {
+		t.Errorf("expected one live plugin connection, got %+v", conns)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("expected one client, got %+v", clients)
+	}
+	total := clients[0]
+	if total.Connections != 2 || total.Requests != 3 || total.Errors != 1 || total.LastWrite == 0 {
+		t.Errorf("unexpected totals: %+v", total)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	handler, _ := createHandler(t)
+	ctx := context.Background()
+
+	if _, err := handler.Call(ctx, "upsertSession", rawParams(t, `{"session": {"id": "ses_1", "source": "opencode", "createdAt": 5}}`)); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+
+	status := func() *StatusResult {
+		t.Helper()
+		result, err := handler.Call(ctx, "status", nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return result.(*StatusResult)
+	}
+
+	first := status()
+	if first.Version != Version || first.PID == 0 {
+		t.Errorf("unexpected daemon info: %+v", first)
+	}
+	// The write time is the daemon's commit time, not the session's createdAt.
+	if len(first.Sources) != 1 || first.Sources[0].Source != "opencode" || first.Sources[0].Sessions != 1 || first.Sources[0].LastWrite <= 5 {
+		t.Fatalf("unexpected sources: %+v", first.Sources)
+	}
+	if first.WriteQueue.Committed != 1 {
+		t.Errorf("expected 1 committed write, got %+v", first.WriteQueue)
+	}
+
+	// Writes that do not touch the session row still count for its source.
+	time.Sleep(2 * time.Millisecond)
+	if _, err := handler.Call(ctx, "upsertTool", rawParams(t, `{"tool": {"id": "t1", "sessionId": "ses_1", "toolName": "Read", "createdAt": 6}}`)); err != nil {
+		t.Fatalf("failed to upsert tool: %v", err)
+	}
+	if second := status(); second.Sources[0].LastWrite <= first.Sources[0].LastWrite {
+		t.Errorf("expected the tool write to advance the last write, got %+v", second.Sources)
+	}
+}
@@ -0,0 +1,355 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// NotifyEvent is the notification a subscribed connection receives for each
+// accepted write. Its params are an Event.
+const NotifyEvent = "event"
+
+// subscriberBuffer is how many events may wait for one subscriber. Events
+// beyond it are dropped and counted, so a slow reader never holds up
+// ingestion.
+const subscriberBuffer = 256
+
+// maxCachedSessions bounds the session scopes kept for filtering. The cache
+// is cleared when it fills up.
+const maxCachedSessions = 1024
+
+// previewLength caps the text quoted in an event summary, in runes.
+const previewLength = 120
+
+// EventFilter narrows a subscription. Empty fields match everything.
+// Project matches a session's project name or path.
+type EventFilter struct {
+	SessionID string `json:"sessionId,omitempty"`
+	Project   string `json:"project,omitempty"`
+	Source    string `json:"source,omitempty"`
+}
+
+type SubscribeParams struct {
+	RequestEnvelope
+	Filter EventFilter `json:"filter"`
+}
+
+type SubscribeResult struct {
+	SubscriptionID int64 `json:"subscriptionId"`
+}
+
+// Event is a compact record of one committed write. Writes that changed
+// nothing (storage.ChangeSkipped) are not published.
+type Event struct {
+	Kind      string         `json:"kind"` // an ingest item kind, e.g. "tool"
+	ID        string         `json:"id"`
+	SessionID string         `json:"sessionId"`
+	Project   string         `json:"project,omitempty"`
+	Source    string         `json:"source,omitempty"`
+	Change    storage.Change `json:"change"`
+	Client    ClientInfo     `json:"client"`
+	At        int64          `json:"at"` // unix ms when the write was committed
+	Role      string         `json:"role,omitempty"`
+	Summary   string         `json:"summary,omitempty"`
+	Failed    bool           `json:"failed,omitempty"` // a failed tool call or a session error
+	// Dropped counts events this subscriber lost since the previous one it
+	// received because it fell behind.
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+// sessionScope is what filters need to know about an event's session.
+type sessionScope struct {
+	projectName string
+	projectPath string
+	source      string
+}
+
+// project returns the name shown for the scope.
+func (s sessionScope) project() string {
+	if s.projectName != "" {
+		return s.projectName
+	}
+	if s.projectPath != "" {
+		return filepath.Base(s.projectPath)
+	}
+	return ""
+}
+
+type subscriber struct {
+	id      int64
+	conn    *jsonrpc2.Conn
+	filter  EventFilter
+	events  chan *Event
+	dropped atomic.Int64
+}
+
+// run sends queued events to the connection until the subscription is
+// removed or the connection fails.
+func (s *subscriber) run() {
+	for ev := range s.events {
+		sent := *ev
+		sent.Dropped = s.dropped.Swap(0)
+		if err := s.conn.Notify(context.Background(), NotifyEvent, &sent); err != nil {
+			return
+		}
+	}
+}
+
+func (s *subscriber) matches(ev *Event, scope sessionScope) bool {
+	f := s.filter
+	if f.SessionID != "" && f.SessionID != ev.SessionID {
+		return false
+	}
+	if f.Project != "" && f.Project != scope.projectName && f.Project != scope.projectPath {
+		return false
+	}
+	if f.Source != "" && f.Source != ev.Source {
+		return false
+	}
+	return true
+}
+
+// hub fans committed writes out to subscribed connections.
+type hub struct {
+	mu       sync.Mutex
+	nextID   int64
+	subs     map[int64]*subscriber
+	sessions map[string]sessionScope
+}
+
+func newHub() *hub {
+	return &hub{
+		subs:     map[int64]*subscriber{},
+		sessions: map[string]sessionScope{},
+	}
+}
+
+func (h *hub) subscribe(conn *jsonrpc2.Conn, filter EventFilter) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	s := &subscriber{
+		id:     h.nextID,
+		conn:   conn,
+		filter: filter,
+		events: make(chan *Event, subscriberBuffer),
+	}
+	h.subs[s.id] = s
+	go s.run()
+	return s.id
+}
+
+// remove drops every subscription on conn.
+func (h *hub) remove(conn *jsonrpc2.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, s := range h.subs {
+		if s.conn == conn {
+			delete(h.subs, id)
+			close(s.events)
+		}
+	}
+}
+
+func (h *hub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+// scope returns the cached scope of a session, and whether it was cached.
+func (h *hub) scope(sessionID string) (sessionScope, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	scope, ok := h.sessions[sessionID]
+	return scope, ok
+}
+
+func (h *hub) remember(sessionID string, scope sessionScope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.sessions) >= maxCachedSessions {
+		h.sessions = map[string]sessionScope{}
+	}
+	h.sessions[sessionID] = scope
+}
+
+// publish queues ev for every matching subscriber without blocking.
+func (h *hub) publish(ev *Event, scope sessionScope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, s := range h.subs {
+		if !s.matches(ev, scope) {
+			continue
+		}
+		select {
+		case s.events <- ev:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// subscribe registers conn for NotifyEvent notifications. It needs a
+// connection, so Call rejects it.
+func (h *Handler) subscribe(conn *jsonrpc2.Conn, params *json.RawMessage, client ClientInfo) (*SubscribeResult, error) {
+	if conn == nil {
+		return nil, &jsonrpc2.Error{
+			Code:    jsonrpc2.CodeInvalidRequest,
+			Message: "subscribe needs a connection",
+		}
+	}
+
+	var p SubscribeParams
+	if params != nil {
+		if err := json.Unmarshal(*params, &p); err != nil {
+			return nil, &jsonrpc2.Error{
+				Code:    jsonrpc2.CodeInvalidParams,
+				Message: "invalid params: " + err.Error(),
+			}
+		}
+	}
+
+	id := h.events.subscribe(conn, p.Filter)
+	h.logger.Infof("rpc", "subscription %d from %s %s", id, client.Name, client.Version)
+	return &SubscribeResult{SubscriptionID: id}, nil
+}
+
+// committed records a committed write's source for status and sends the
+// write to subscribers. The item's session is looked up unless it is cached.
+func (h *Handler) committed(client ClientInfo, change storage.Change, item *IngestItem) {
+	ev := newEvent(item)
+	scope := h.sessionScope(ev.SessionID, item.Session)
+	if ev.Source == "" {
+		ev.Source = scope.source
+	}
+	h.clients.wrote(ev.Source)
+
+	if change == storage.ChangeSkipped || !h.events.active() {
+		return
+	}
+	ev.Change = change
+	ev.Client = client
+	ev.At = time.Now().UnixMilli()
+	ev.Project = scope.project()
+	h.events.publish(ev, scope)
+}
+
+// sessionScope returns the project and source of a session. session is the
+// payload of a session write, whose non-empty fields replace cached ones.
+// The write is committed, so a lookup already sees it.
+func (h *Handler) sessionScope(sessionID string, session *storage.Session) sessionScope {
+	scope, ok := h.events.scope(sessionID)
+	if ok && session != nil {
+		scope.projectName = valueOr(session.ProjectName, scope.projectName)
+		scope.projectPath = valueOr(session.ProjectPath, scope.projectPath)
+		scope.source = valueOr(session.Source, scope.source)
+	}
+	if !ok {
+		stored, err := h.store.GetSession(sessionID)
+		if err != nil {
+			h.logger.Debugf("rpc", "no session for event: %v", err)
+			return scope
+		}
+		scope = sessionScope{
+			projectName: valueOr(stored.ProjectName, ""),
+			projectPath: valueOr(stored.ProjectPath, ""),
+			source:      valueOr(stored.Source, ""),
+		}
+	}
+	h.events.remember(sessionID, scope)
+	return scope
+}
+
+// newEvent fills the kind-specific fields of an event.
+func newEvent(item *IngestItem) *Event {
+	ev := &Event{Kind: item.Kind, ID: item.id()}
+	switch {
+	case item.Session != nil:
+		s := item.Session
+		ev.SessionID = s.ID
+		ev.Source = valueOr(s.Source, "")
+		var parts []string
+		if title := valueOr(s.Title, ""); title != "" {
+			parts = append(parts, fmt.Sprintf("%q", preview(title)))
+		}
+		for _, v := range []*string{s.Model, s.Status} {
+			if v != nil && *v != "" {
+				parts = append(parts, *v)
+			}
+		}
+		ev.Summary = strings.Join(parts, " ")
+	case item.Message != nil:
+		m := item.Message
+		ev.SessionID = m.SessionID
+		ev.Source = valueOr(m.Source, "")
+		ev.Role = m.Role
+		ev.Summary = preview(m.TextContent)
+	case item.Tool != nil:
+		t := item.Tool
+		ev.SessionID = t.SessionID
+		ev.Summary = t.ToolName
+		if path := valueOr(t.FilePath, ""); path != "" {
+			ev.Summary += " " + path
+		}
+		if t.Success != nil && !*t.Success {
+			ev.Failed = true
+			if msg := valueOr(t.ErrorMessage, ""); msg != "" {
+				ev.Summary += ": " + preview(msg)
+			}
+		}
+	case item.SessionError != nil:
+		e := item.SessionError
+		ev.SessionID = e.SessionID
+		ev.Failed = true
+		ev.Summary = valueOr(e.ErrorType, "")
+		if msg := preview(valueOr(e.ErrorMessage, "")); msg != "" {
+			if ev.Summary != "" {
+				ev.Summary += ": "
+			}
+			ev.Summary += msg
+		}
+	case item.CompactionEvent != nil:
+		c := item.CompactionEvent
+		ev.SessionID = c.SessionID
+		var parts []string
+		if c.TokensBefore != nil && c.TokensAfter != nil {
+			parts = append(parts, fmt.Sprintf("tokens %d -> %d", *c.TokensBefore, *c.TokensAfter))
+		}
+		if c.MessagesBefore != nil && c.MessagesAfter != nil {
+			parts = append(parts, fmt.Sprintf("messages %d -> %d", *c.MessagesBefore, *c.MessagesAfter))
+		}
+		ev.Summary = strings.Join(parts, ", ")
+	}
+	return ev
+}
+
+// preview flattens s to one line of at most previewLength runes.
+func preview(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= previewLength {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:previewLength-1]) + "…"
+}
+
+func valueOr(v *string, fallback string) string {
+	if v == nil || *v == "" {
+		return fallback
+	}
+	return *v
+}
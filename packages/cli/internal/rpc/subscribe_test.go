@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// eventSink collects NotifyEvent notifications on the client side.
+type eventSink chan Event
+
+func (s eventSink) Handle(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	if req.Method != NotifyEvent || req.Params == nil {
+		return
+	}
+	var ev Event
+	if err := json.Unmarshal(*req.Params, &ev); err == nil {
+		s <- ev
+	}
+}
+
+// connect serves handler on one end of a pipe and returns a client conn on
+// the other, with events delivered to the returned sink.
+func connect(t *testing.T, handler *Handler) (*jsonrpc2.Conn, eventSink) {
+	t.Helper()
+	return connectVia(t, handler, handler)
+}
+
+// connectVia is connect with requests going through connHandler, such as
+// one from RestrictPeer.
+func connectVia(t *testing.T, handler *Handler, connHandler jsonrpc2.Handler) (*jsonrpc2.Conn, eventSink) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	ctx := context.Background()
+
+	serverConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(server, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.AsyncHandler(connHandler))
+	handler.Connect(serverConn)
+	go func() {
+		<-serverConn.DisconnectNotify()
+		handler.Disconnect(serverConn)
+	}()
+
+	sink := make(eventSink, 16)
+	clientConn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(client, jsonrpc2.VSCodeObjectCodec{}), sink)
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	return clientConn, sink
+}
+
+func nextEvent(t *testing.T, sink eventSink) Event {
+	t.Helper()
+	select {
+	case ev := <-sink:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an event")
+		return Event{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	handler, _ := createHandler(t)
+	conn, sink := connect(t, handler)
+	ctx := context.Background()
+
+	var result SubscribeResult
+	err := conn.Call(ctx, "subscribe", json.RawMessage(`{
+		"client": {"name": "tail", "version": "1"},
+		"filter": {"project": "/work/alpha"}
+	}`), &result)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.SubscriptionID == 0 {
+		t.Error("expected a subscription id")
+	}
+
+	calls := []struct{ method, params string }{
+		{"upsertSession", `{"client": {"name": "opencode-plugin", "version": "1"}, "session": {"id": "ses_a", "title": "Alpha", "projectPath": "/work/alpha", "projectName": "alpha", "source": "opencode"}}`},
+		{"upsertSession", `{"session": {"id": "ses_b", "projectPath": "/work/beta", "source": "claude-code"}}`},
+		// Unchanged, so not published.
+		{"upsertSession", `{"session": {"id": "ses_a", "title": "Alpha"}}`},
+		{"upsertMessage", `{"message": {"id": "m1", "sessionId": "ses_b", "role": "user", "textContent": "beta"}}`},
+		{"upsertMessage", `{"message": {"id": "m2", "sessionId": "ses_a", "role": "user", "textContent": "fix\n  the   build"}}`},
+		{"upsertTool", `{"tool": {"id": "t1", "sessionId": "ses_a", "toolName": "Edit", "filePath": "main.go", "success": false, "errorMessage": "no match", "createdAt": 1}}`},
+	}
+	for _, c := range calls {
+		if _, err := handler.Call(ctx, c.method, rawParams(t, c.params)); err != nil {
+			t.Fatalf("%s: expected no error, got %v", c.method, err)
+		}
+	}
+
+	session := nextEvent(t, sink)
+	if session.Kind != KindSession || session.ID != "ses_a" || session.Change != storage.ChangeInserted {
+		t.Errorf("expected the inserted session, got %+v", session)
+	}
+	if session.Project != "alpha" || session.Source != "opencode" || session.Client.Name != "opencode-plugin" {
+		t.Errorf("expected project, source and client on the event, got %+v", session)
+	}
+	if session.Summary != `"Alpha"` {
+		t.Errorf("expected the title as summary, got %q", session.Summary)
+	}
+
+	message := nextEvent(t, sink)
+	if message.Kind != KindMessage || message.SessionID != "ses_a" || message.Role != "user" {
+		t.Errorf("expected the alpha message, got %+v", message)
+	}
+	if message.Source != "opencode" || message.Summary != "fix the build" {
+		t.Errorf("expected the session's source and a one-line preview, got %+v", message)
+	}
+
+	tool := nextEvent(t, sink)
+	if tool.Kind != KindTool || !tool.Failed || tool.Summary != "Edit main.go: no match" {
+		t.Errorf("expected the failed tool, got %+v", tool)
+	}
+
+	select {
+	case ev := <-sink:
+		t.Errorf("expected no more events, got %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscribeNeedsConnection(t *testing.T) {
+	handler, _ := createHandler(t)
+
+	if _, err := handler.Call(context.Background(), "subscribe", nil); err == nil {
+		t.Error("expected subscribe without a connection to fail")
+	}
+}
+
+func TestSubscriberDropsWhenBehind(t *testing.T) {
+	h := newHub()
+	s := &subscriber{events: make(chan *Event, 1)}
+	h.subs[1] = s
+
+	for i := 0; i < 3; i++ {
+		h.publish(&Event{Kind: KindTool}, sessionScope{})
+	}
+	if len(s.events) != 1 || s.dropped.Load() != 2 {
+		t.Errorf("expected 1 queued and 2 dropped, got %d and %d", len(s.events), s.dropped.Load())
+	}
+}
+
+func TestPreview(t *testing.T) {
+	long := strings.Repeat("é", previewLength+10)
+	got := preview(long)
+	if n := len([]rune(got)); n != previewLength || !strings.HasSuffix(got, "…") {
+		t.Errorf("expected %d runes ending in an ellipsis, got %d: %q", previewLength, n, got)
+	}
+	if got := preview(" a\tb\n"); got != "a b" {
+		t.Errorf("expected whitespace to collapse, got %q", got)
+	}
+}
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/dxta-dev/clankers/internal/storage"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// CodeInvalidPayload is returned when a record is missing a required field.
+// Data names the field: {"field": "sessionId"}.
+const CodeInvalidPayload = 4001
+
+func invalidPayload(kind, field string) *jsonrpc2.Error {
+	data := json.RawMessage(`{"field": "` + field + `"}`)
+	return &jsonrpc2.Error{
+		Code:    CodeInvalidPayload,
+		Message: "invalid " + kind + " payload",
+		Data:    &data,
+	}
+}
+
+func validateSession(s *storage.Session) *jsonrpc2.Error {
+	if s.ID == "" {
+		return invalidPayload("session", "id")
+	}
+	return nil
+}
+
+func validateMessage(m *storage.Message) *jsonrpc2.Error {
+	if m.ID == "" {
+		return invalidPayload("message", "id")
+	}
+	if m.SessionID == "" {
+		return invalidPayload("message", "sessionId")
+	}
+	return nil
+}
+
+func validateTool(t *storage.Tool) *jsonrpc2.Error {
+	if t.ID == "" {
+		return invalidPayload("tool", "id")
+	}
+	if t.SessionID == "" {
+		return invalidPayload("tool", "sessionId")
+	}
+	if t.ToolName == "" {
+		return invalidPayload("tool", "toolName")
+	}
+	return nil
+}
+
+func validateSessionError(e *storage.SessionError) *jsonrpc2.Error {
+	if e.ID == "" {
+		return invalidPayload("session error", "id")
+	}
+	if e.SessionID == "" {
+		return invalidPayload("session error", "sessionId")
+	}
+	return nil
+}
+
+func validateCompactionEvent(e *storage.CompactionEvent) *jsonrpc2.Error {
+	if e.ID == "" {
+		return invalidPayload("compaction event", "id")
+	}
+	if e.SessionID == "" {
+		return invalidPayload("compaction event", "sessionId")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Table names accepted by Batch.
+const (
+	TableSessions         = "sessions"
+	TableMessages         = "messages"
+	TableTools            = "tools"
+	TableSessionErrors    = "session_errors"
+	TableCompactionEvents = "compaction_events"
+)
+
+// Tables lists the data tables in dependency order: sessions before the
+// rows that reference them.
+var Tables = []string{TableSessions, TableMessages, TableTools, TableSessionErrors, TableCompactionEvents}
+
+// Change describes what an upsert did to the stored row.
+type Change string
+
+const (
+	ChangeInserted Change = "inserted"
+	ChangeUpdated  Change = "updated"
+	ChangeSkipped  Change = "skipped" // the row already held the same values
+	ChangeStale    Change = "stale"   // older than the stored row; version-gated fields were kept
+)
+
+// Batch applies upserts inside one transaction. Every write goes through it,
+// including the single-record Store.Upsert* methods. Each upsert reports how
+// it changed the stored row, and writes that change a sessions, messages or
+// tools row are appended to change_history.
+type Batch struct {
+	tx     *sql.Tx
+	stmts  map[string]*sql.Stmt
+	client Client
+}
+
+// BeginBatch starts a transaction on the writer connection. The caller must
+// Commit or Rollback it.
+func (s *Store) BeginBatch() (*Batch, error) {
+	if s.db == nil {
+		return nil, ErrReadOnly
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Batch{
+		tx: tx,
+		stmts: map[string]*sql.Stmt{
+			TableSessions:         tx.Stmt(s.upsertSession),
+			TableMessages:         tx.Stmt(s.upsertMessage),
+			TableTools:            tx.Stmt(s.upsertTool),
+			TableSessionErrors:    tx.Stmt(s.upsertSessionError),
+			TableCompactionEvents: tx.Stmt(s.upsertCompaction),
+		},
+	}, nil
+}
+
+// SetClient attributes the following upserts to client in change_history.
+func (b *Batch) SetClient(client Client) {
+	b.client = client
+}
+
+func (b *Batch) Commit() error {
+	return b.tx.Commit()
+}
+
+// Rollback discards the batch. It is safe to call after Commit.
+func (b *Batch) Rollback() error {
+	err := b.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+func (b *Batch) UpsertSession(session *Session) (Change, error) {
+	return b.upsert(TableSessions, session.ID, sessionArgs(session), checkSessionStaleSQL)
+}
+
+func (b *Batch) UpsertMessage(msg *Message) (Change, error) {
+	return b.upsert(TableMessages, msg.ID, messageArgs(msg), checkMessageStaleSQL)
+}
+
+func (b *Batch) UpsertTool(tool *Tool) (Change, error) {
+	return b.upsert(TableTools, tool.ID, toolArgs(tool), "")
+}
+
+func (b *Batch) UpsertSessionError(errRecord *SessionError) (Change, error) {
+	return b.upsert(TableSessionErrors, errRecord.ID, sessionErrorArgs(errRecord), "")
+}
+
+func (b *Batch) UpsertCompactionEvent(event *CompactionEvent) (Change, error) {
+	return b.upsert(TableCompactionEvents, event.ID, compactionEventArgs(event), "")
+}
+
+// upsert runs apply inside a savepoint. An upsert is several statements
+// (the row and its change_history entry), so a failure rolls all of them
+// back and leaves the rest of the batch usable.
+func (b *Batch) upsert(table, id string, args []any, staleSQL string) (Change, error) {
+	if _, err := b.tx.Exec("SAVEPOINT upsert"); err != nil {
+		return "", err
+	}
+	change, err := b.apply(table, id, args, staleSQL)
+	if err != nil {
+		// ROLLBACK TO keeps the savepoint open, so it is released as well.
+		b.tx.Exec("ROLLBACK TO upsert")
+		b.tx.Exec("RELEASE upsert")
+		return "", err
+	}
+	if _, err := b.tx.Exec("RELEASE upsert"); err != nil {
+		return "", err
+	}
+	return change, nil
+}
+
+// apply compares the stored row before and after running the statement,
+// so the reported change reflects the merge rules rather than the input.
+// For versioned tables, staleSQL evaluates the upsert's stale predicate with
+// the same arguments first.
+func (b *Batch) apply(table, id string, args []any, staleSQL string) (Change, error) {
+	_, before, err := b.snapshot(table, id)
+	if err != nil {
+		return "", err
+	}
+	stale := false
+	if before != nil && staleSQL != "" {
+		if err := b.tx.QueryRow(staleSQL, args...).Scan(&stale); err != nil {
+			return "", err
+		}
+	}
+	if _, err := b.stmts[table].Exec(args...); err != nil {
+		return "", err
+	}
+
+	change := ChangeUpdated
+	switch {
+	case before == nil:
+		change = ChangeInserted
+	case stale:
+		// Fields that are not version-gated may still have been filled,
+		// so stale writes are diffed for history like any other.
+		change = ChangeStale
+	}
+	if before == nil && !historyTables[table] {
+		return change, nil
+	}
+
+	columns, after, err := b.snapshot(table, id)
+	if err != nil {
+		return "", err
+	}
+	changes := diffColumns(columns, before, after)
+	if len(changes) == 0 {
+		if change == ChangeUpdated {
+			change = ChangeSkipped
+		}
+		return change, nil
+	}
+	if historyTables[table] {
+		operation := OperationUpdate
+		if before == nil {
+			operation = OperationInsert
+		}
+		if err := b.recordHistory(table, id, columns, after, operation, changes); err != nil {
+			return "", err
+		}
+	}
+	return change, nil
+}
+
+// snapshot returns the column names and every value of the row, or nil
+// values if it does not exist. table is always one of the Table* constants.
+func (b *Batch) snapshot(table, id string) ([]string, []any, error) {
+	rows, err := b.tx.Query(fmt.Sprintf("SELECT * FROM %s WHERE id = ?", table), id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, nil, err
+	}
+	return columns, values, rows.Err()
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBatchReportsChanges(t *testing.T) {
+	store := createStore(t)
+
+	batch, err := store.BeginBatch()
+	if err != nil {
+		t.Fatalf("failed to begin batch: %v", err)
+	}
+	defer batch.Rollback()
+
+	session := &Session{ID: "ses_1", Title: strPtr("First"), CreatedAt: int64Ptr(1000)}
+	steps := []struct {
+		name   string
+		upsert func() (Change, error)
+		want   Change
+	}{
+		{"new session", func() (Change, error) { return batch.UpsertSession(session) }, ChangeInserted},
+		{"same session", func() (Change, error) { return batch.UpsertSession(session) }, ChangeSkipped},
+		{"empty title keeps stored title", func() (Change, error) {
+			return batch.UpsertSession(&Session{ID: "ses_1", Title: strPtr(""), CreatedAt: int64Ptr(1000)})
+		}, ChangeSkipped},
+		{"new title", func() (Change, error) {
+			return batch.UpsertSession(&Session{ID: "ses_1", Title: strPtr("Second"), CreatedAt: int64Ptr(1000)})
+		}, ChangeUpdated},
+		{"new message", func() (Change, error) {
+			return batch.UpsertMessage(&Message{ID: "m1", SessionID: "ses_1", Role: "user", TextContent: "hi"})
+		}, ChangeInserted},
+		{"empty text keeps stored text", func() (Change, error) {
+			return batch.UpsertMessage(&Message{ID: "m1", SessionID: "ses_1", Role: "user"})
+		}, ChangeSkipped},
+	}
+
+	for _, step := range steps {
+		got, err := step.upsert()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: expected %s, got %s", step.name, step.want, got)
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	stored, _, err := store.GetSessionByID("ses_1")
+	if err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	if *stored.Title != "Second" {
+		t.Errorf("expected title Second, got %q", *stored.Title)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	store := createStore(t)
+
+	batch, err := store.BeginBatch()
+	if err != nil {
+		t.Fatalf("failed to begin batch: %v", err)
+	}
+	if _, err := batch.UpsertSession(&Session{ID: "ses_1"}); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	if err := batch.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %v", err)
+	}
+
+	if _, _, err := store.GetSessionByID("ses_1"); err == nil {
+		t.Error("expected rolled back session to be absent")
+	}
+}
+
+func TestBatchRollsBackFailedUpsert(t *testing.T) {
+	store := createStore(t)
+
+	// Fail the change_history insert that follows the session upsert.
+	if _, err := store.db.Exec(`CREATE TRIGGER fail_history BEFORE INSERT ON change_history
+		WHEN NEW.row_id = 'ses_bad' BEGIN SELECT RAISE(ABORT, 'history failed'); END`); err != nil {
+		t.Fatalf("failed to create trigger: %v", err)
+	}
+
+	batch, err := store.BeginBatch()
+	if err != nil {
+		t.Fatalf("failed to begin batch: %v", err)
+	}
+	defer batch.Rollback()
+
+	if _, err := batch.UpsertSession(&Session{ID: "ses_bad", Title: strPtr("Lost")}); err == nil {
+		t.Fatal("expected the history insert to fail the upsert")
+	}
+	if _, err := batch.UpsertSession(&Session{ID: "ses_good", Title: strPtr("Kept")}); err != nil {
+		t.Fatalf("expected the batch to continue, got %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	if _, _, err := store.GetSessionByID("ses_bad"); err == nil {
+		t.Error("expected the failed session write to be rolled back")
+	}
+	if _, _, err := store.GetSessionByID("ses_good"); err != nil {
+		t.Errorf("expected ses_good to be committed, got %v", err)
+	}
+}
+
+func TestBatchReportsStaleWrites(t *testing.T) {
+	store := createStore(t)
+
+	batch, err := store.BeginBatch()
+	if err != nil {
+		t.Fatalf("failed to begin batch: %v", err)
+	}
+	defer batch.Rollback()
+
+	if _, err := batch.UpsertSession(&Session{ID: "ses_1", PromptTokens: int64Ptr(5), UpdatedAt: int64Ptr(2000)}); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	change, err := batch.UpsertSession(&Session{ID: "ses_1", PromptTokens: int64Ptr(1), UpdatedAt: int64Ptr(1000)})
+	if err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	if change != ChangeStale {
+		t.Errorf("expected stale, got %s", change)
+	}
+	change, err = batch.UpsertSession(&Session{ID: "ses_1", PromptTokens: int64Ptr(9), UpdatedAt: int64Ptr(3000)})
+	if err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	if change != ChangeUpdated {
+		t.Errorf("expected updated, got %s", change)
+	}
+}
+
+func TestBatchRecordsHistory(t *testing.T) {
+	store := createStore(t)
+
+	batch, err := store.BeginBatch()
+	if err != nil {
+		t.Fatalf("failed to begin batch: %v", err)
+	}
+	defer batch.Rollback()
+
+	batch.SetClient(Client{Name: "opencode-plugin", Version: "1.2.0"})
+	upserts := []func() (Change, error){
+		func() (Change, error) { return batch.UpsertSession(&Session{ID: "ses_1", Title: strPtr("First")}) },
+		func() (Change, error) { return batch.UpsertSession(&Session{ID: "ses_1", Title: strPtr("First")}) },
+		func() (Change, error) {
+			return batch.UpsertMessage(&Message{ID: "m1", SessionID: "ses_1", Role: "user", TextContent: "hi"})
+		},
+		func() (Change, error) {
+			return batch.UpsertSessionError(&SessionError{ID: "e1", SessionID: "ses_1", CreatedAt: 1})
+		},
+	}
+	for i, upsert := range upserts {
+		if _, err := upsert(); err != nil {
+			t.Fatalf("upsert %d failed: %v", i, err)
+		}
+	}
+	batch.SetClient(Client{Name: "claude-plugin", Version: "0.3.0"})
+	if _, err := batch.UpsertSession(&Session{ID: "ses_1", Title: strPtr("Second")}); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	history, err := store.GetHistory("ses_1")
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+
+	// The skipped session write and the session error are not recorded.
+	if len(history) != 3 {
+		t.Fatalf("expected 3 history entries, got %+v", history)
+	}
+	if history[0].Operation != OperationInsert || history[0].Client.Name != "opencode-plugin" {
+		t.Errorf("expected an insert by opencode-plugin, got %+v", history[0])
+	}
+	if history[1].Table != TableMessages || history[1].RowID != "m1" || history[1].SessionID != "ses_1" {
+		t.Errorf("expected the message insert, got %+v", history[1])
+	}
+
+	update := history[2]
+	if update.Operation != OperationUpdate || update.Client != (Client{Name: "claude-plugin", Version: "0.3.0"}) {
+		t.Errorf("expected an update by claude-plugin, got %+v", update)
+	}
+	if len(update.Changes) != 1 {
+		t.Fatalf("expected only the title to change, got %+v", update.Changes)
+	}
+	if c := update.Changes[0]; c.Column != "title" || c.Old != "First" || c.New != "Second" {
+		t.Errorf("expected title First -> Second, got %+v", c)
+	}
+}
+
+func TestStoreUpsertRecordsHistory(t *testing.T) {
+	store := createStore(t)
+
+	steps := []error{
+		store.UpsertSession(&Session{ID: "ses_1", Title: strPtr("First")}),
+		store.UpsertSession(&Session{ID: "ses_1", Title: strPtr("Second")}),
+		store.UpsertMessage(&Message{ID: "m1", SessionID: "ses_1", Role: "user", TextContent: "hi"}),
+		store.UpsertTool(&Tool{ID: "t1", SessionID: "ses_1", ToolName: "Read", CreatedAt: 1}),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("upsert %d failed: %v", i, err)
+		}
+	}
+
+	history, err := store.GetHistory("ses_1")
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+	var got []string
+	for _, entry := range history {
+		got = append(got, entry.Table+" "+entry.Operation)
+	}
+	want := "sessions insert, sessions update, messages insert, tools insert"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+}
+
+func TestHistoryValueTruncates(t *testing.T) {
+	long := strings.Repeat("é", maxHistoryValue)
+	got, ok := historyValue(long).(string)
+	if !ok || len(got) > maxHistoryValue+len("…") || !utf8.ValidString(got) {
+		t.Errorf("expected a valid truncated string, got %q", got)
+	}
+	if historyValue("short") != "short" || historyValue(int64(5)) != int64(5) {
+		t.Error("expected short values to be kept")
+	}
+}
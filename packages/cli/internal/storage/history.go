@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// History operations.
+const (
+	OperationInsert = "insert"
+	OperationUpdate = "update"
+)
+
+// maxHistoryValue caps text values copied into change_history so that
+// message bodies and tool output do not double the database size. Longer
+// values are cut and marked with a trailing ellipsis.
+const maxHistoryValue = 256
+
+// historyTables are the tables whose changes Batch records.
+var historyTables = map[string]bool{
+	TableSessions: true,
+	TableMessages: true,
+	TableTools:    true,
+}
+
+// Client identifies who made a write. It is copied from the RPC request
+// envelope into change_history.
+type Client struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ColumnChange is one column's value before and after a write. Old is nil
+// for inserts.
+type ColumnChange struct {
+	Column string `json:"column"`
+	Old    any    `json:"old"`
+	New    any    `json:"new"`
+}
+
+// HistoryEntry is one recorded write to a sessions, messages or tools row.
+type HistoryEntry struct {
+	ID        int64          `json:"id"`
+	Table     string         `json:"table"`
+	RowID     string         `json:"rowId"`
+	SessionID string         `json:"sessionId"`
+	Operation string         `json:"operation"`
+	Changes   []ColumnChange `json:"changes"`
+	Client    Client         `json:"client"`
+	ChangedAt int64          `json:"changedAt"`
+}
+
+const insertHistorySQL = `
+INSERT INTO change_history (table_name, row_id, session_id, operation, changes, client_name, client_version, changed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+// diffColumns lists the columns whose values differ between two snapshots
+// of the same row. A nil before means the row was inserted, and only the
+// columns it was inserted with are listed.
+func diffColumns(columns []string, before, after []any) []ColumnChange {
+	var changes []ColumnChange
+	for i, column := range columns {
+		var old any
+		if before != nil {
+			old = before[i]
+		}
+		if reflect.DeepEqual(old, after[i]) {
+			continue
+		}
+		changes = append(changes, ColumnChange{
+			Column: column,
+			Old:    historyValue(old),
+			New:    historyValue(after[i]),
+		})
+	}
+	return changes
+}
+
+func historyValue(v any) any {
+	s, ok := v.(string)
+	if !ok || len(s) <= maxHistoryValue {
+		return v
+	}
+	cut := maxHistoryValue
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
+
+// recordHistory appends a change_history row for a write to table that
+// changed the listed columns.
+func (b *Batch) recordHistory(table, id string, columns []string, row []any, operation string, changes []ColumnChange) error {
+	sessionID := id
+	if table != TableSessions {
+		for i, column := range columns {
+			if column == "session_id" {
+				sessionID, _ = row[i].(string)
+			}
+		}
+	}
+
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.tx.Exec(insertHistorySQL,
+		table, id, sessionID, operation, string(encoded),
+		nullString(b.client.Name), nullString(b.client.Version), time.Now().UnixMilli(),
+	)
+	return err
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// GetHistory returns the recorded writes to a session and its messages and
+// tools, oldest first.
+func (s *Store) GetHistory(sessionID string) ([]HistoryEntry, error) {
+	rows, err := s.readDb.Query(`
+		SELECT id, table_name, row_id, COALESCE(session_id, ''), operation, changes,
+			COALESCE(client_name, ''), COALESCE(client_version, ''), changed_at
+		FROM change_history WHERE session_id = ? ORDER BY changed_at ASC, id ASC`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var changes string
+		err := rows.Scan(
+			&e.ID, &e.Table, &e.RowID, &e.SessionID, &e.Operation, &changes,
+			&e.Client.Name, &e.Client.Version, &e.ChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Keep integers exact: timestamps would otherwise decode as floats.
+		decoder := json.NewDecoder(strings.NewReader(changes))
+		decoder.UseNumber()
+		if err := decoder.Decode(&e.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
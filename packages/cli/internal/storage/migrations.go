@@ -0,0 +1,370 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Migration is a single forward-only schema change. Applied migrations are
+// recorded in schema_migrations together with a checksum of their SQL, so a
+// migration must never be edited once it has shipped; add a new one instead.
+type Migration struct {
+	Version     int
+	Description string
+	Up          string
+}
+
+// Checksum returns the hex-encoded SHA-256 of the migration SQL.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// migrations must stay ordered by version with no gaps.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		Up: `
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	title TEXT,
+	project_path TEXT,
+	project_name TEXT,
+	model TEXT,
+	provider TEXT,
+	source TEXT,
+	status TEXT,
+	prompt_tokens INTEGER,
+	completion_tokens INTEGER,
+	cost REAL,
+	message_count INTEGER,
+	tool_call_count INTEGER,
+	permission_mode TEXT,
+	created_at INTEGER,
+	updated_at INTEGER,
+	ended_at INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	session_id TEXT,
+	role TEXT,
+	text_content TEXT,
+	model TEXT,
+	source TEXT,
+	prompt_tokens INTEGER,
+	completion_tokens INTEGER,
+	duration_ms INTEGER,
+	created_at INTEGER,
+	completed_at INTEGER,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tools (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	message_id TEXT,
+	tool_name TEXT NOT NULL,
+	tool_input TEXT,
+	tool_output TEXT,
+	file_path TEXT,
+	success BOOLEAN,
+	error_message TEXT,
+	duration_ms INTEGER,
+	created_at INTEGER NOT NULL,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tools_session ON tools(session_id);
+CREATE INDEX IF NOT EXISTS idx_tools_name ON tools(tool_name);
+CREATE INDEX IF NOT EXISTS idx_tools_file ON tools(file_path);
+
+CREATE TABLE IF NOT EXISTS session_errors (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	error_type TEXT,
+	error_message TEXT,
+	created_at INTEGER NOT NULL,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_errors_session ON session_errors(session_id);
+
+CREATE TABLE IF NOT EXISTS compaction_events (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	tokens_before INTEGER,
+	tokens_after INTEGER,
+	messages_before INTEGER,
+	messages_after INTEGER,
+	created_at INTEGER NOT NULL,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_compaction_session ON compaction_events(session_id);
+`,
+	},
+	{
+		Version:     2,
+		Description: "full-text search over messages and tool I/O",
+		Up: `
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+	text_content,
+	content = 'messages',
+	content_rowid = 'rowid',
+	tokenize = 'porter unicode61'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS tools_fts USING fts5(
+	tool_input,
+	tool_output,
+	content = 'tools',
+	content_rowid = 'rowid',
+	tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts (rowid, text_content) VALUES (new.rowid, new.text_content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, text_content) VALUES ('delete', old.rowid, old.text_content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF text_content ON messages BEGIN
+	INSERT INTO messages_fts (messages_fts, rowid, text_content) VALUES ('delete', old.rowid, old.text_content);
+	INSERT INTO messages_fts (rowid, text_content) VALUES (new.rowid, new.text_content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS tools_fts_insert AFTER INSERT ON tools BEGIN
+	INSERT INTO tools_fts (rowid, tool_input, tool_output) VALUES (new.rowid, new.tool_input, new.tool_output);
+END;
+
+CREATE TRIGGER IF NOT EXISTS tools_fts_delete AFTER DELETE ON tools BEGIN
+	INSERT INTO tools_fts (tools_fts, rowid, tool_input, tool_output) VALUES ('delete', old.rowid, old.tool_input, old.tool_output);
+END;
+
+CREATE TRIGGER IF NOT EXISTS tools_fts_update AFTER UPDATE OF tool_input, tool_output ON tools BEGIN
+	INSERT INTO tools_fts (tools_fts, rowid, tool_input, tool_output) VALUES ('delete', old.rowid, old.tool_input, old.tool_output);
+	INSERT INTO tools_fts (rowid, tool_input, tool_output) VALUES (new.rowid, new.tool_input, new.tool_output);
+END;
+
+INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');
+INSERT INTO tools_fts (tools_fts) VALUES ('rebuild');
+`,
+	},
+	{
+		Version:     3,
+		Description: "indexes for session listing and transcripts",
+		Up: `
+CREATE INDEX IF NOT EXISTS idx_sessions_created ON sessions(created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_session ON messages(session_id, created_at);
+`,
+	},
+	{
+		Version:     4,
+		Description: "client revision counters for out-of-order protection",
+		Up: `
+ALTER TABLE sessions ADD COLUMN revision INTEGER;
+ALTER TABLE messages ADD COLUMN revision INTEGER;
+`,
+	},
+	{
+		Version:     5,
+		Description: "append-only change history for sessions, messages and tools",
+		Up: `
+CREATE TABLE IF NOT EXISTS change_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	table_name TEXT NOT NULL,
+	row_id TEXT NOT NULL,
+	session_id TEXT,
+	operation TEXT NOT NULL,
+	changes TEXT NOT NULL,
+	client_name TEXT,
+	client_version TEXT,
+	changed_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_history_session ON change_history(session_id, changed_at);
+`,
+	},
+}
+
+const schemaMigrationsSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	description TEXT,
+	checksum TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+);
+`
+
+type MigrateOptions struct {
+	Target int  // 0 migrates to the latest version
+	DryRun bool // report pending migrations without applying them
+	Backup bool // copy the database aside before applying anything
+}
+
+type MigrateResult struct {
+	FromVersion int
+	ToVersion   int
+	Pending     []Migration
+	BackupPath  string
+}
+
+// LatestSchemaVersion returns the version of the newest known migration.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate brings the database at dbPath up to opts.Target (or the latest
+// version), taking a backup first when opts.Backup is set and there is
+// something to apply.
+func Migrate(dbPath string, opts MigrateOptions) (*MigrateResult, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_foreign_keys=ON")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := configureDb(db); err != nil {
+		return nil, err
+	}
+
+	return migrate(db, dbPath, opts)
+}
+
+func migrate(db *sql.DB, dbPath string, opts MigrateOptions) (*MigrateResult, error) {
+	if _, err := db.Exec(schemaMigrationsSQL); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	target := opts.Target
+	if target == 0 {
+		target = LatestSchemaVersion()
+	}
+	if target < 0 || target > LatestSchemaVersion() {
+		return nil, fmt.Errorf("unknown schema version %d (latest is %d)", target, LatestSchemaVersion())
+	}
+
+	applied, err := appliedChecksums(db)
+	if err != nil {
+		return nil, err
+	}
+
+	current := 0
+	for _, m := range migrations {
+		checksum, ok := applied[m.Version]
+		if !ok {
+			continue
+		}
+		if checksum != m.Checksum() {
+			return nil, fmt.Errorf("checksum mismatch for migration %d (%s): database was migrated with different SQL", m.Version, m.Description)
+		}
+		current = m.Version
+	}
+	for version := range applied {
+		if version > LatestSchemaVersion() {
+			return nil, fmt.Errorf("database schema version %d is newer than this build supports (%d)", version, LatestSchemaVersion())
+		}
+	}
+	if target < current {
+		return nil, fmt.Errorf("cannot migrate down from version %d to %d: downgrades are not supported, restore a backup instead", current, target)
+	}
+
+	result := &MigrateResult{FromVersion: current, ToVersion: current}
+	for _, m := range migrations {
+		if m.Version > current && m.Version <= target {
+			result.Pending = append(result.Pending, m)
+		}
+	}
+
+	if opts.DryRun || len(result.Pending) == 0 {
+		return result, nil
+	}
+
+	if opts.Backup {
+		backupPath := fmt.Sprintf("%s.v%d-%s.bak", dbPath, current, time.Now().Format("20060102-150405"))
+		if _, err := db.Exec("VACUUM INTO ?", backupPath); err != nil {
+			return nil, fmt.Errorf("failed to back up database before migrating: %w", err)
+		}
+		result.BackupPath = backupPath
+	}
+
+	for _, m := range result.Pending {
+		if err := applyMigration(db, m); err != nil {
+			return result, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+		result.ToVersion = m.Version
+	}
+
+	return result, nil
+}
+
+func appliedChecksums(db *sql.DB) (map[int]string, error) {
+	rows, err := db.Query("SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		applied[version] = checksum
+	}
+
+	return applied, rows.Err()
+}
+
+// schemaVersion returns the highest applied migration, or 0 for a database
+// that predates schema_migrations.
+func schemaVersion(db *sql.DB) (int, error) {
+	var tracked int
+	if err := db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+	).Scan(&tracked); err != nil {
+		return 0, err
+	}
+	if tracked == 0 {
+		return 0, nil
+	}
+
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+func applyMigration(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.Up); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		m.Version, m.Description, m.Checksum(), time.Now().UnixMilli(),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("expected migration %d to have version %d, got %d", i, i+1, m.Version)
+		}
+		if m.Description == "" {
+			t.Errorf("expected migration %d to have a description", m.Version)
+		}
+	}
+}
+
+func TestEnsureDbRecordsMigrations(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "migrations.db")
+
+	if _, err := EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to ensure DB: %v", err)
+	}
+
+	result, err := Migrate(dbPath, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.FromVersion != LatestSchemaVersion() {
+		t.Errorf("expected version %d, got %d", LatestSchemaVersion(), result.FromVersion)
+	}
+	if len(result.Pending) != 0 {
+		t.Errorf("expected no pending migrations, got %d", len(result.Pending))
+	}
+
+	matches, _ := filepath.Glob(dbPath + ".*.bak")
+	if len(matches) != 0 {
+		t.Errorf("expected no backup for a new database, got %v", matches)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A database created before schema_migrations existed.
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	if _, err := db.Exec(migrations[0].Up); err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO sessions (id, title) VALUES ('legacy', 'Old Session')"); err != nil {
+		t.Fatalf("failed to seed legacy data: %v", err)
+	}
+	db.Close()
+
+	t.Run("dry run reports pending without applying", func(t *testing.T) {
+		result, err := Migrate(dbPath, MigrateOptions{DryRun: true, Backup: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result.FromVersion != 0 {
+			t.Errorf("expected version 0, got %d", result.FromVersion)
+		}
+		if len(result.Pending) != LatestSchemaVersion() {
+			t.Errorf("expected %d pending migrations, got %d", LatestSchemaVersion(), len(result.Pending))
+		}
+		if result.BackupPath != "" {
+			t.Errorf("expected no backup on dry run, got %s", result.BackupPath)
+		}
+	})
+
+	t.Run("applies migrations and keeps data", func(t *testing.T) {
+		created, err := EnsureDb(dbPath)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created {
+			t.Error("expected created to be false for legacy database")
+		}
+
+		matches, _ := filepath.Glob(dbPath + ".v0-*.bak")
+		if len(matches) != 1 {
+			t.Fatalf("expected one backup file, got %v", matches)
+		}
+
+		store, err := Open(dbPath)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		defer store.Close()
+
+		session, _, err := store.GetSessionByID("legacy")
+		if err != nil {
+			t.Fatalf("expected legacy session to survive, got %v", err)
+		}
+		if session.Title == nil || *session.Title != "Old Session" {
+			t.Errorf("expected title Old Session, got %v", session.Title)
+		}
+	})
+}
+
+func TestMigrateRejectsChecksumMismatch(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "checksum.db")
+
+	if _, err := EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to ensure DB: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	if _, err := db.Exec("UPDATE schema_migrations SET checksum = 'tampered' WHERE version = 1"); err != nil {
+		t.Fatalf("failed to tamper checksum: %v", err)
+	}
+	db.Close()
+
+	_, err = Migrate(dbPath, MigrateOptions{})
+	if err == nil {
+		t.Fatal("expected checksum mismatch error")
+	}
+	if !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch error, got %v", err)
+	}
+}
+
+func TestMigrateRejectsUnknownTarget(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "target.db")
+
+	if _, err := EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to ensure DB: %v", err)
+	}
+
+	if _, err := Migrate(dbPath, MigrateOptions{Target: LatestSchemaVersion() + 1}); err == nil {
+		t.Fatal("expected error for unknown target version")
+	}
+}
+
+func TestMigrateMissingDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "missing.db")
+
+	if _, err := Migrate(dbPath, MigrateOptions{}); !os.IsNotExist(err) {
+		t.Fatalf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestOpenRejectsOutdatedSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "outdated.db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("failed to create DB: %v", err)
+	}
+	db.Close()
+
+	if _, err := Migrate(dbPath, MigrateOptions{Target: LatestSchemaVersion() - 1}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	if _, err := Open(dbPath); err == nil || !strings.Contains(err.Error(), "db migrate") {
+		t.Fatalf("expected an outdated schema error, got %v", err)
+	}
+
+	if _, err := Migrate(dbPath, MigrateOptions{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	store, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("expected migrated database to open, got %v", err)
+	}
+	store.Close()
+}
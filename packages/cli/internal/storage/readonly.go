@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var ErrWriteNotAllowed = errors.New("write operations are not allowed from the CLI")
+
+// ErrReadOnly is returned by writes on a Store from OpenReadOnly.
+var ErrReadOnly = errors.New("database is open read-only")
+
+// deniedActions are authorizer actions refused while a query is prepared.
+// They change connection state rather than the database file, so
+// sqlite3_stmt_readonly reports them as read-only.
+var deniedActions = map[int32]bool{
+	sqlite3.SQLITE_TRANSACTION: true,
+	sqlite3.SQLITE_SAVEPOINT:   true,
+	sqlite3.SQLITE_ATTACH:      true,
+	sqlite3.SQLITE_DETACH:      true,
+}
+
+func authorize(_ *libc.TLS, _ uintptr, action int32, _, _, _, _ uintptr) int32 {
+	if deniedActions[action] {
+		return sqlite3.SQLITE_DENY
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// openReadOnly opens dbPath with SQLITE_OPEN_READONLY and query_only set, so
+// the engine itself refuses to write regardless of what SQL it is given.
+func openReadOnly(dbPath string) (*sql.DB, error) {
+	return sql.Open("sqlite", readOnlyDSN(dbPath))
+}
+
+// maxReadConns bounds the reader pool. Readers only contend on the WAL
+// index, so a few connections are enough for concurrent CLI and dashboard
+// queries.
+const maxReadConns = 4
+
+// openReadPool opens the bounded pool of read-only connections used for all
+// Store reads.
+func openReadPool(dbPath string) (*sql.DB, error) {
+	db, err := openReadOnly(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxReadConns)
+	db.SetMaxIdleConns(maxReadConns)
+	return db, nil
+}
+
+func readOnlyDSN(dbPath string) string {
+	path := filepath.ToSlash(dbPath)
+	if filepath.IsAbs(dbPath) && !strings.HasPrefix(path, "/") {
+		// Windows drive paths become file:///C:/...
+		path = "/" + path
+	}
+	u := url.URL{
+		Scheme:   "file",
+		Path:     path,
+		RawQuery: "mode=ro&_pragma=query_only(1)&_pragma=busy_timeout(5000)",
+	}
+	if !filepath.IsAbs(dbPath) {
+		return "file:" + u.EscapedPath() + "?" + u.RawQuery
+	}
+	return u.String()
+}
+
+// checkReadOnly installs authorize on conn and prepares stmt there, and
+// rejects it if the authorizer denies it or sqlite3_stmt_readonly reports
+// that it would write. The authorizer stays installed for the query that
+// follows on the same connection. Other prepare errors are left for the
+// query itself to report.
+func checkReadOnly(conn *sql.Conn, stmt string) error {
+	keyword := leadingKeyword(stmt)
+	if keyword == "EXPLAIN" {
+		return nil
+	}
+	blocked := fmt.Errorf("%w: %s statements are blocked", ErrWriteNotAllowed, keyword)
+
+	return conn.Raw(func(driverConn any) error {
+		db, err := sqliteHandle(driverConn)
+		if err != nil {
+			return err
+		}
+
+		tls := libc.NewTLS()
+		defer tls.Close()
+
+		// The callback is passed the way the driver passes its own hooks: as
+		// the address of the Go function value.
+		callback := authorize
+		sqlite3.Xsqlite3_set_authorizer(tls, db, *(*uintptr)(unsafe.Pointer(&callback)), 0)
+
+		text, err := libc.CString(stmt)
+		if err != nil {
+			return err
+		}
+		defer libc.Xfree(tls, text)
+		// SQLite writes the statement handle through this pointer, so it
+		// lives in C memory rather than on the Go heap.
+		out := libc.Xmalloc(tls, types.Size_t(unsafe.Sizeof(uintptr(0))))
+		if out == 0 {
+			return fmt.Errorf("cannot allocate a statement handle")
+		}
+		defer libc.Xfree(tls, out)
+
+		switch rc := sqlite3.Xsqlite3_prepare_v2(tls, db, text, -1, out, 0); rc {
+		case sqlite3.SQLITE_OK:
+		case sqlite3.SQLITE_AUTH:
+			return blocked
+		default:
+			return nil
+		}
+		prepared := libc.AtomicLoadPUintptr(out)
+		if prepared == 0 {
+			return nil
+		}
+		defer sqlite3.Xsqlite3_finalize(tls, prepared)
+
+		if sqlite3.Xsqlite3_stmt_readonly(tls, prepared) == 0 {
+			return blocked
+		}
+		return nil
+	})
+}
+
+// sqliteHandle returns the sqlite3* behind a modernc.org/sqlite driver
+// connection. The driver does not export it, so it is read from the
+// connection's db field.
+func sqliteHandle(driverConn any) (uintptr, error) {
+	v := reflect.ValueOf(driverConn)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("db"); f.IsValid() && f.Kind() == reflect.Uintptr && f.Uint() != 0 {
+			return uintptr(f.Uint()), nil
+		}
+	}
+	return 0, fmt.Errorf("unexpected sqlite driver connection %T", driverConn)
+}
+
+// discardConn marks conn as broken so database/sql closes it instead of
+// returning it to the pool. Arbitrary SQL can leave per-connection state
+// behind (flag pragmas, temp objects), so query connections are single-use.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+func leadingKeyword(stmt string) string {
+	fields := strings.FieldsFunc(stmt, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// SplitStatements splits input on semicolons that are outside string
+// literals, quoted identifiers and comments. Empty and comment-only
+// statements are dropped. The second return value reports whether the input
+// ends in a terminated statement.
+func SplitStatements(input string) ([]string, bool) {
+	var statements []string
+	var current strings.Builder
+	hasContent := false
+	terminated := false
+
+	flush := func() {
+		if hasContent {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		hasContent = false
+	}
+
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := byte(c)
+			if c == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for j < len(input) {
+				if input[j] == end {
+					// Doubled quotes are escapes inside quoted text.
+					if end != ']' && j+1 < len(input) && input[j+1] == end {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(input) {
+				j = len(input) - 1
+			}
+			current.WriteString(input[i : j+1])
+			hasContent = true
+			terminated = false
+			i = j
+		case c == '-' && i+1 < len(input) && input[i+1] == '-':
+			j := strings.IndexByte(input[i:], '\n')
+			if j < 0 {
+				j = len(input) - i - 1
+			}
+			current.WriteString(input[i : i+j+1])
+			i += j
+		case c == '/' && i+1 < len(input) && input[i+1] == '*':
+			j := strings.Index(input[i+2:], "*/")
+			end := len(input) - 1
+			if j >= 0 {
+				end = i + 2 + j + 1
+			}
+			current.WriteString(input[i : end+1])
+			i = end
+		case c == ';':
+			flush()
+			terminated = true
+		default:
+			current.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasContent = true
+				terminated = false
+			}
+		}
+	}
+	flush()
+
+	return statements, terminated
+}
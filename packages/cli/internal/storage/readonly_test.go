@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		want       []string
+		terminated bool
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}, false},
+		{"terminated", "SELECT 1;", []string{"SELECT 1"}, true},
+		{"multiple", "SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}, true},
+		{"semicolon in string", "SELECT 'a;b'", []string{"SELECT 'a;b'"}, false},
+		{"escaped quote", "SELECT 'it''s; fine';", []string{"SELECT 'it''s; fine'"}, true},
+		{"quoted identifier", `SELECT "a;b" FROM [c;d]`, []string{`SELECT "a;b" FROM [c;d]`}, false},
+		{"line comment", "SELECT 1 -- ; not a split\n;", []string{"SELECT 1 -- ; not a split"}, true},
+		{"block comment", "SELECT /* ; */ 1", []string{"SELECT /* ; */ 1"}, false},
+		{"comment only", "-- nothing here", nil, false},
+		{"trailing comment", "SELECT 1; -- done", []string{"SELECT 1"}, true},
+		{"empty", "  ;  ", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, terminated := SplitStatements(tt.input)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if terminated != tt.terminated {
+				t.Errorf("expected terminated=%v, got %v", tt.terminated, terminated)
+			}
+		})
+	}
+}
+
+func TestReadOnlyDSN(t *testing.T) {
+	got := readOnlyDSN("/tmp/dir with space/clankers.db")
+	want := "file:///tmp/dir%20with%20space/clankers.db?mode=ro&_pragma=query_only(1)&_pragma=busy_timeout(5000)"
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Snippet highlight markers. They are control characters (STX and ETX) so
+// they can never be confused with Markdown or other text in a message.
+const (
+	SearchHighlightStart = "\x02"
+	SearchHighlightEnd   = "\x03"
+)
+
+type SearchOptions struct {
+	Project string `json:"project,omitempty"` // matches sessions.project_name or sessions.project_path
+	Source  string `json:"source,omitempty"`
+	Since   int64  `json:"since,omitempty"` // unix milliseconds, 0 for no lower bound
+	Limit   int    `json:"limit,omitempty"`
+	Raw     bool   `json:"raw,omitempty"` // pass terms through as FTS5 query syntax
+}
+
+type SearchHit struct {
+	Kind         string  `json:"kind"` // "message" or "tool"
+	ID           string  `json:"id"`
+	SessionID    string  `json:"sessionId"`
+	SessionTitle *string `json:"sessionTitle,omitempty"`
+	ProjectName  *string `json:"projectName,omitempty"`
+	Source       *string `json:"source,omitempty"`
+	Role         string  `json:"role"`
+	Snippet      string  `json:"snippet"`
+	Rank         float64 `json:"rank"` // see Search
+	CreatedAt    *int64  `json:"createdAt,omitempty"`
+}
+
+// Search runs a ranked full-text query over message text and tool
+// input/output. Lower rank values are better matches.
+//
+// bm25 scores from different FTS tables are not comparable, so each table's
+// scores are divided by its best match before the two are merged: the best
+// message and the best tool call both rank -1, weaker matches approach 0.
+func (s *Store) Search(terms string, opts SearchOptions) ([]SearchHit, error) {
+	match := terms
+	if !opts.Raw {
+		match = buildMatchQuery(terms)
+	}
+	if match == "" {
+		return nil, fmt.Errorf("search terms must not be empty")
+	}
+
+	filters := func(alias string) (string, []any) {
+		var clause strings.Builder
+		var args []any
+		if opts.Project != "" {
+			clause.WriteString(" AND (s.project_name = ? OR s.project_path = ?)")
+			args = append(args, opts.Project, opts.Project)
+		}
+		if opts.Source != "" {
+			clause.WriteString(" AND s.source = ?")
+			args = append(args, opts.Source)
+		}
+		if opts.Since > 0 {
+			clause.WriteString(" AND " + alias + ".created_at >= ?")
+			args = append(args, opts.Since)
+		}
+		return clause.String(), args
+	}
+	messageFilter, messageArgs := filters("m")
+	toolFilter, toolArgs := filters("t")
+
+	// normalized scales a table's bm25 scores (negative, lower is better)
+	// by the best one among its matches.
+	const normalized = `kind, id, session_id, title, project_name, source, role, snippet,
+		COALESCE(score / NULLIF(ABS(MIN(score) OVER ()), 0), 0), created_at`
+
+	query := fmt.Sprintf(`
+		SELECT `+normalized+` FROM (
+			SELECT 'message' AS kind, m.id, m.session_id, s.title, s.project_name, s.source,
+				COALESCE(m.role, '') AS role,
+				snippet(messages_fts, 0, '%[1]s', '%[2]s', '…', 16) AS snippet,
+				bm25(messages_fts) AS score, m.created_at
+			FROM messages_fts
+			JOIN messages m ON m.rowid = messages_fts.rowid
+			LEFT JOIN sessions s ON s.id = m.session_id
+			WHERE messages_fts MATCH ?%[3]s
+		)
+		UNION ALL
+		SELECT `+normalized+` FROM (
+			SELECT 'tool' AS kind, t.id, t.session_id, s.title, s.project_name, s.source,
+				'tool:' || t.tool_name AS role,
+				snippet(tools_fts, -1, '%[1]s', '%[2]s', '…', 16) AS snippet,
+				bm25(tools_fts) AS score, t.created_at
+			FROM tools_fts
+			JOIN tools t ON t.rowid = tools_fts.rowid
+			LEFT JOIN sessions s ON s.id = t.session_id
+			WHERE tools_fts MATCH ?%[4]s
+		)
+		ORDER BY 9 ASC, 10 DESC`,
+		SearchHighlightStart, SearchHighlightEnd, messageFilter, toolFilter)
+
+	args := append([]any{match}, messageArgs...)
+	args = append(args, match)
+	args = append(args, toolArgs...)
+
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+
+	rows, err := s.readDb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		var hit SearchHit
+		var title sql.NullString
+		var projectName sql.NullString
+		var source sql.NullString
+		var snippet sql.NullString
+		var createdAt sql.NullInt64
+
+		if err := rows.Scan(
+			&hit.Kind, &hit.ID, &hit.SessionID, &title, &projectName, &source,
+			&hit.Role, &snippet, &hit.Rank, &createdAt,
+		); err != nil {
+			return nil, err
+		}
+
+		if title.Valid {
+			hit.SessionTitle = &title.String
+		}
+		if projectName.Valid {
+			hit.ProjectName = &projectName.String
+		}
+		if source.Valid {
+			hit.Source = &source.String
+		}
+		hit.Snippet = snippet.String
+		if createdAt.Valid {
+			hit.CreatedAt = &createdAt.Int64
+		}
+
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// RebuildSearchIndex regenerates the full-text indexes from the messages and
+// tools tables.
+func (s *Store) RebuildSearchIndex() error {
+	if s.db == nil {
+		return ErrReadOnly
+	}
+	if _, err := s.db.Exec("INSERT INTO messages_fts (messages_fts) VALUES ('rebuild')"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("INSERT INTO tools_fts (tools_fts) VALUES ('rebuild')")
+	return err
+}
+
+// buildMatchQuery turns free-form user input into an FTS5 query that matches
+// rows containing every term, quoting each one so punctuation such as "-" or
+// ":" is not parsed as query syntax.
+func buildMatchQuery(terms string) string {
+	var quoted []string
+	for _, term := range strings.Fields(terms) {
+		quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	store := createStore(t)
+
+	if err := store.UpsertSession(&Session{
+		ID:          "session-search",
+		Title:       strPtr("Fix migrations"),
+		ProjectName: strPtr("clankers"),
+		Source:      strPtr("opencode"),
+	}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := store.UpsertSession(&Session{
+		ID:          "session-other",
+		Title:       strPtr("Unrelated"),
+		ProjectName: strPtr("other"),
+		Source:      strPtr("claude-code"),
+	}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	createdAt := int64(1000)
+	if err := store.UpsertMessage(&Message{
+		ID:          "msg-search",
+		SessionID:   "session-search",
+		Role:        "assistant",
+		TextContent: "The migration bug was caused by a missing index",
+		CreatedAt:   &createdAt,
+	}); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	if err := store.UpsertMessage(&Message{
+		ID:          "msg-other",
+		SessionID:   "session-other",
+		Role:        "user",
+		TextContent: "Please look at the migration script",
+		CreatedAt:   &createdAt,
+	}); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	if err := store.UpsertTool(&Tool{
+		ID:         "tool-search",
+		SessionID:  "session-search",
+		ToolName:   "Bash",
+		ToolInput:  strPtr(`{"command": "go test ./internal/storage"}`),
+		ToolOutput: strPtr("ok github.com/dxta-dev/clankers/internal/storage"),
+		CreatedAt:  2000,
+	}); err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+
+	t.Run("matches messages with stemming and highlights", func(t *testing.T) {
+		hits, err := store.Search("migrations bug", SearchOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 {
+			t.Fatalf("expected 1 hit, got %d", len(hits))
+		}
+		hit := hits[0]
+		if hit.Kind != "message" || hit.ID != "msg-search" || hit.Role != "assistant" {
+			t.Errorf("unexpected hit: %+v", hit)
+		}
+		if hit.SessionTitle == nil || *hit.SessionTitle != "Fix migrations" {
+			t.Errorf("expected session title, got %v", hit.SessionTitle)
+		}
+		if !strings.Contains(hit.Snippet, SearchHighlightStart+"bug"+SearchHighlightEnd) {
+			t.Errorf("expected highlighted snippet, got %q", hit.Snippet)
+		}
+	})
+
+	t.Run("matches tool input and output", func(t *testing.T) {
+		hits, err := store.Search("internal/storage", SearchOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 || hits[0].Kind != "tool" || hits[0].Role != "tool:Bash" {
+			t.Fatalf("expected one Bash tool hit, got %+v", hits)
+		}
+	})
+
+	t.Run("ranks messages and tools on the same scale", func(t *testing.T) {
+		hits, err := store.Search("storage OR migration", SearchOptions{Raw: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		best := map[string]float64{}
+		for i, hit := range hits {
+			if hit.Rank < -1 || hit.Rank >= 0 {
+				t.Errorf("expected a rank in [-1, 0), got %+v", hit)
+			}
+			if i > 0 && hit.Rank < hits[i-1].Rank {
+				t.Errorf("expected hits in rank order, got %v after %v", hit.Rank, hits[i-1].Rank)
+			}
+			if r, ok := best[hit.Kind]; !ok || hit.Rank < r {
+				best[hit.Kind] = hit.Rank
+			}
+		}
+		if best["message"] != -1 || best["tool"] != -1 {
+			t.Errorf("expected the best message and tool to rank -1, got %v", best)
+		}
+	})
+
+	t.Run("highlights text that contains markdown", func(t *testing.T) {
+		if err := store.UpsertMessage(&Message{
+			ID:          "msg-markdown",
+			SessionID:   "session-other",
+			Role:        "user",
+			TextContent: "please fix the **schema** bug",
+		}); err != nil {
+			t.Fatalf("failed to create message: %v", err)
+		}
+
+		hits, err := store.Search("schema", SearchOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 {
+			t.Fatalf("expected 1 hit, got %+v", hits)
+		}
+		want := "please fix the **" + SearchHighlightStart + "schema" + SearchHighlightEnd + "** bug"
+		if hits[0].Snippet != want {
+			t.Errorf("expected %q, got %q", want, hits[0].Snippet)
+		}
+	})
+
+	t.Run("filters by project and source", func(t *testing.T) {
+		hits, err := store.Search("migration", SearchOptions{Project: "clankers"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 || hits[0].SessionID != "session-search" {
+			t.Fatalf("expected project filter to keep one hit, got %+v", hits)
+		}
+
+		hits, err = store.Search("migration", SearchOptions{Source: "claude-code"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 || hits[0].SessionID != "session-other" {
+			t.Fatalf("expected source filter to keep one hit, got %+v", hits)
+		}
+	})
+
+	t.Run("filters by since", func(t *testing.T) {
+		hits, err := store.Search("migration", SearchOptions{Since: 1500})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 0 {
+			t.Fatalf("expected no hits after since, got %+v", hits)
+		}
+	})
+
+	t.Run("follows message updates", func(t *testing.T) {
+		if err := store.UpsertMessage(&Message{
+			ID:          "msg-search",
+			SessionID:   "session-search",
+			Role:        "assistant",
+			TextContent: "Rewritten answer about sqlite",
+		}); err != nil {
+			t.Fatalf("failed to update message: %v", err)
+		}
+
+		hits, err := store.Search("missing index", SearchOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 0 {
+			t.Fatalf("expected stale text to be removed from index, got %+v", hits)
+		}
+
+		hits, err = store.Search("sqlite", SearchOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 {
+			t.Fatalf("expected updated text to be indexed, got %+v", hits)
+		}
+	})
+
+	t.Run("rejects empty terms", func(t *testing.T) {
+		if _, err := store.Search("   ", SearchOptions{}); err == nil {
+			t.Fatal("expected error for empty terms")
+		}
+	})
+
+	t.Run("rebuild keeps results", func(t *testing.T) {
+		if err := store.RebuildSearchIndex(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		hits, err := store.Search("sqlite", SearchOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hits) != 1 {
+			t.Fatalf("expected 1 hit after rebuild, got %d", len(hits))
+		}
+	})
+}
+
+func TestBuildMatchQuery(t *testing.T) {
+	got := buildMatchQuery(`fix "quoted" file-path`)
+	want := `"fix" """quoted""" "file-path"`
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	if buildMatchQuery("  ") != "" {
+		t.Fatal("expected empty query for blank input")
+	}
+}
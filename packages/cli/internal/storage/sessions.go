@@ -0,0 +1,570 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const sessionColumns = `id, title, project_path, project_name, model, provider, source, status,
+	prompt_tokens, completion_tokens, cost, message_count, tool_call_count,
+	permission_mode, created_at, updated_at, ended_at, revision`
+
+// SessionSort names the orderings ListSessions supports.
+type SessionSort string
+
+const (
+	SortCreated  SessionSort = "created"
+	SortUpdated  SessionSort = "updated"
+	SortCost     SessionSort = "cost"
+	SortTokens   SessionSort = "tokens"
+	SortMessages SessionSort = "messages"
+)
+
+// SessionSorts lists every valid SessionSort.
+var SessionSorts = []SessionSort{SortCreated, SortUpdated, SortCost, SortTokens, SortMessages}
+
+// sortExpressions are the SQL sort keys. NULLs are folded to zero so that
+// keyset pagination can compare them.
+var sortExpressions = map[SessionSort]string{
+	SortCreated:  "COALESCE(created_at, 0)",
+	SortUpdated:  "COALESCE(updated_at, created_at, 0)",
+	SortCost:     "COALESCE(cost, 0)",
+	SortTokens:   "COALESCE(prompt_tokens, 0) + COALESCE(completion_tokens, 0)",
+	SortMessages: "COALESCE(message_count, 0)",
+}
+
+type SessionFilter struct {
+	Project   string      `json:"project,omitempty"` // matches project_name or project_path
+	Source    string      `json:"source,omitempty"`
+	Model     string      `json:"model,omitempty"`
+	Status    string      `json:"status,omitempty"`
+	Since     int64       `json:"since,omitempty"` // created_at lower bound (inclusive), unix milliseconds
+	Until     int64       `json:"until,omitempty"` // created_at upper bound (exclusive), unix milliseconds
+	Sort      SessionSort `json:"sort,omitempty"`
+	Ascending bool        `json:"ascending,omitempty"`
+	Limit     int         `json:"limit,omitempty"`
+	Cursor    string      `json:"cursor,omitempty"` // NextCursor from the previous page
+}
+
+type SessionPage struct {
+	Sessions   []Session `json:"sessions"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// sessionCursor marks the last row of a page. It is opaque to callers.
+type sessionCursor struct {
+	Sort  SessionSort     `json:"s"`
+	Asc   bool            `json:"a,omitempty"`
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// ErrInvalidFilter is returned by ListSessions for an unknown sort or a
+// cursor it did not issue.
+var ErrInvalidFilter = errors.New("invalid session filter")
+
+var errInvalidCursor = fmt.Errorf("%w: invalid cursor", ErrInvalidFilter)
+
+// ListSessions returns one page of sessions matching filter. Pages are
+// keyset-paginated on the sort key and id, so rows inserted while paging do
+// not shift later pages.
+func (s *Store) ListSessions(filter SessionFilter) (*SessionPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = SortCreated
+	}
+	sortExpr, ok := sortExpressions[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort %s", ErrInvalidFilter, filter.Sort)
+	}
+
+	where, args := filterConditions(filter)
+
+	cmp, dir := "<", "DESC"
+	if filter.Ascending {
+		cmp, dir = ">", "ASC"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeSessionCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort || cursor.Asc != filter.Ascending {
+			return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidFilter)
+		}
+		value, err := cursor.key()
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortExpr, cmp))
+		args = append(args, value, value, cursor.ID)
+	}
+
+	query := "SELECT " + sessionColumns + ", " + sortExpr + " FROM sessions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", sortExpr, dir, dir)
+	if filter.Limit > 0 {
+		// One extra row tells us whether there is another page.
+		query += " LIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := s.readDb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &SessionPage{Sessions: []Session{}}
+	var lastKey any
+	for rows.Next() {
+		if filter.Limit > 0 && len(page.Sessions) == filter.Limit {
+			last := page.Sessions[len(page.Sessions)-1]
+			cursor, err := encodeSessionCursor(sessionCursor{Sort: filter.Sort, Asc: filter.Ascending, ID: last.ID}, lastKey)
+			if err != nil {
+				return nil, err
+			}
+			page.NextCursor = cursor
+			break
+		}
+
+		var key any
+		session, err := scanSession(rows, &key)
+		if err != nil {
+			return nil, err
+		}
+		page.Sessions = append(page.Sessions, *session)
+		lastKey = key
+	}
+
+	return page, rows.Err()
+}
+
+// filterConditions returns the WHERE conditions and their arguments for
+// filter's project, source, model, status and date range.
+func filterConditions(filter SessionFilter) ([]string, []any) {
+	var where []string
+	var args []any
+	if filter.Project != "" {
+		where = append(where, "(project_name = ? OR project_path = ?)")
+		args = append(args, filter.Project, filter.Project)
+	}
+	if filter.Source != "" {
+		where = append(where, "source = ?")
+		args = append(args, filter.Source)
+	}
+	if filter.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, filter.Model)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Since > 0 {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until > 0 {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.Until)
+	}
+	return where, args
+}
+
+func encodeSessionCursor(cursor sessionCursor, key any) (string, error) {
+	value, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	cursor.Value = value
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeSessionCursor(encoded string) (*sessionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor sessionCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == "" {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// key returns the cursor's sort value with its SQL type preserved: integer
+// keys must bind as integers, or SQLite compares them as text.
+func (c *sessionCursor) key() (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(c.Value))
+	decoder.UseNumber()
+	var number json.Number
+	if err := decoder.Decode(&number); err != nil {
+		return nil, errInvalidCursor
+	}
+	if i, err := number.Int64(); err == nil {
+		return i, nil
+	}
+	f, err := number.Float64()
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return f, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSession reads a row selected with sessionColumns. Any extra columns
+// selected after them are scanned into extra.
+func scanSession(row rowScanner, extra ...any) (*Session, error) {
+	var session Session
+	var title sql.NullString
+	var projectPath sql.NullString
+	var projectName sql.NullString
+	var model sql.NullString
+	var provider sql.NullString
+	var source sql.NullString
+	var status sql.NullString
+	var promptTokens sql.NullInt64
+	var completionTokens sql.NullInt64
+	var cost sql.NullFloat64
+	var messageCount sql.NullInt64
+	var toolCallCount sql.NullInt64
+	var permissionMode sql.NullString
+	var createdAt sql.NullInt64
+	var updatedAt sql.NullInt64
+	var endedAt sql.NullInt64
+	var revision sql.NullInt64
+
+	dest := []any{
+		&session.ID, &title, &projectPath, &projectName, &model, &provider, &source, &status,
+		&promptTokens, &completionTokens, &cost, &messageCount, &toolCallCount,
+		&permissionMode, &createdAt, &updatedAt, &endedAt, &revision,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if title.Valid {
+		session.Title = &title.String
+	}
+	if projectPath.Valid {
+		session.ProjectPath = &projectPath.String
+	}
+	if projectName.Valid {
+		session.ProjectName = &projectName.String
+	}
+	if model.Valid {
+		session.Model = &model.String
+	}
+	if provider.Valid {
+		session.Provider = &provider.String
+	}
+	if source.Valid {
+		session.Source = &source.String
+	}
+	if status.Valid {
+		session.Status = &status.String
+	}
+	if promptTokens.Valid {
+		session.PromptTokens = &promptTokens.Int64
+	}
+	if completionTokens.Valid {
+		session.CompletionTokens = &completionTokens.Int64
+	}
+	if cost.Valid {
+		session.Cost = &cost.Float64
+	}
+	if messageCount.Valid {
+		session.MessageCount = &messageCount.Int64
+	}
+	if toolCallCount.Valid {
+		session.ToolCallCount = &toolCallCount.Int64
+	}
+	if permissionMode.Valid {
+		session.PermissionMode = &permissionMode.String
+	}
+	if createdAt.Valid {
+		session.CreatedAt = &createdAt.Int64
+	}
+	if updatedAt.Valid {
+		session.UpdatedAt = &updatedAt.Int64
+	}
+	if endedAt.Valid {
+		session.EndedAt = &endedAt.Int64
+	}
+	if revision.Valid {
+		session.Revision = &revision.Int64
+	}
+
+	return &session, nil
+}
+
+func (s *Store) GetTools(sessionID string) ([]Tool, error) {
+	rows, err := s.readDb.Query(`
+		SELECT id, session_id, message_id, tool_name, tool_input, tool_output,
+			file_path, success, error_message, duration_ms, created_at
+		FROM tools WHERE session_id = ? ORDER BY created_at ASC, rowid ASC`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tools []Tool
+	for rows.Next() {
+		var t Tool
+		var messageID sql.NullString
+		var toolInput sql.NullString
+		var toolOutput sql.NullString
+		var filePath sql.NullString
+		var success sql.NullBool
+		var errorMessage sql.NullString
+		var durationMs sql.NullInt64
+
+		err := rows.Scan(
+			&t.ID, &t.SessionID, &messageID, &t.ToolName, &toolInput, &toolOutput,
+			&filePath, &success, &errorMessage, &durationMs, &t.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if messageID.Valid {
+			t.MessageID = &messageID.String
+		}
+		if toolInput.Valid {
+			t.ToolInput = &toolInput.String
+		}
+		if toolOutput.Valid {
+			t.ToolOutput = &toolOutput.String
+		}
+		if filePath.Valid {
+			t.FilePath = &filePath.String
+		}
+		if success.Valid {
+			t.Success = &success.Bool
+		}
+		if errorMessage.Valid {
+			t.ErrorMessage = &errorMessage.String
+		}
+		if durationMs.Valid {
+			t.DurationMs = &durationMs.Int64
+		}
+
+		tools = append(tools, t)
+	}
+
+	return tools, rows.Err()
+}
+
+func (s *Store) GetSessionErrors(sessionID string) ([]SessionError, error) {
+	rows, err := s.readDb.Query(`
+		SELECT id, session_id, error_type, error_message, created_at
+		FROM session_errors WHERE session_id = ? ORDER BY created_at ASC, rowid ASC`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessionErrors []SessionError
+	for rows.Next() {
+		var e SessionError
+		var errorType sql.NullString
+		var errorMessage sql.NullString
+
+		if err := rows.Scan(&e.ID, &e.SessionID, &errorType, &errorMessage, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if errorType.Valid {
+			e.ErrorType = &errorType.String
+		}
+		if errorMessage.Valid {
+			e.ErrorMessage = &errorMessage.String
+		}
+
+		sessionErrors = append(sessionErrors, e)
+	}
+
+	return sessionErrors, rows.Err()
+}
+
+func (s *Store) GetCompactionEvents(sessionID string) ([]CompactionEvent, error) {
+	rows, err := s.readDb.Query(`
+		SELECT id, session_id, tokens_before, tokens_after, messages_before, messages_after, created_at
+		FROM compaction_events WHERE session_id = ? ORDER BY created_at ASC, rowid ASC`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []CompactionEvent
+	for rows.Next() {
+		var e CompactionEvent
+		var tokensBefore sql.NullInt64
+		var tokensAfter sql.NullInt64
+		var messagesBefore sql.NullInt64
+		var messagesAfter sql.NullInt64
+
+		err := rows.Scan(
+			&e.ID, &e.SessionID, &tokensBefore, &tokensAfter, &messagesBefore, &messagesAfter, &e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if tokensBefore.Valid {
+			e.TokensBefore = &tokensBefore.Int64
+		}
+		if tokensAfter.Valid {
+			e.TokensAfter = &tokensAfter.Int64
+		}
+		if messagesBefore.Valid {
+			e.MessagesBefore = &messagesBefore.Int64
+		}
+		if messagesAfter.Valid {
+			e.MessagesAfter = &messagesAfter.Int64
+		}
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// SourceCount is the number of sessions recorded from one source.
+type SourceCount struct {
+	Source   string `json:"source"` // empty when sessions have no source
+	Sessions int64  `json:"sessions"`
+}
+
+// CountSessionsBySource returns per-source session counts, most sessions
+// first.
+func (s *Store) CountSessionsBySource() ([]SourceCount, error) {
+	rows, err := s.readDb.Query(`
+		SELECT COALESCE(source, '') AS source, COUNT(*) AS sessions
+		FROM sessions GROUP BY COALESCE(source, '') ORDER BY sessions DESC, source ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []SourceCount
+	for rows.Next() {
+		var c SourceCount
+		if err := rows.Scan(&c.Source, &c.Sessions); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Transcript entry kinds, in the order they sort when timestamps tie.
+const (
+	EntryMessage    = "message"
+	EntryTool       = "tool"
+	EntryError      = "error"
+	EntryCompaction = "compaction"
+)
+
+var entryRank = map[string]int{EntryMessage: 0, EntryTool: 1, EntryError: 2, EntryCompaction: 3}
+
+// TranscriptEntry is one event in a session transcript. Exactly one of the
+// pointer fields is set, matching Kind.
+type TranscriptEntry struct {
+	Kind       string           `json:"kind"`
+	CreatedAt  *int64           `json:"createdAt,omitempty"`
+	Message    *Message         `json:"message,omitempty"`
+	Tool       *Tool            `json:"tool,omitempty"`
+	Error      *SessionError    `json:"error,omitempty"`
+	Compaction *CompactionEvent `json:"compaction,omitempty"`
+}
+
+type Transcript struct {
+	Session *Session          `json:"session"`
+	Entries []TranscriptEntry `json:"entries"`
+}
+
+// GetTranscript returns a session with its messages, tool calls, errors and
+// compaction events merged in time order. Entries without a timestamp keep
+// their position relative to the message before them.
+func (s *Store) GetTranscript(sessionID string) (*Transcript, error) {
+	session, messages, err := s.GetSessionByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tools, err := s.GetTools(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	sessionErrors, err := s.GetSessionErrors(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.GetCompactionEvents(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]TranscriptEntry, 0, len(messages)+len(tools)+len(sessionErrors)+len(events))
+	var lastTime *int64
+	for i := range messages {
+		m := &messages[i]
+		if m.CreatedAt != nil {
+			lastTime = m.CreatedAt
+		}
+		entries = append(entries, TranscriptEntry{Kind: EntryMessage, CreatedAt: lastTime, Message: m})
+	}
+	for i := range tools {
+		t := &tools[i]
+		entries = append(entries, TranscriptEntry{Kind: EntryTool, CreatedAt: &t.CreatedAt, Tool: t})
+	}
+	for i := range sessionErrors {
+		e := &sessionErrors[i]
+		entries = append(entries, TranscriptEntry{Kind: EntryError, CreatedAt: &e.CreatedAt, Error: e})
+	}
+	for i := range events {
+		e := &events[i]
+		entries = append(entries, TranscriptEntry{Kind: EntryCompaction, CreatedAt: &e.CreatedAt, Compaction: e})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		ti, tj := entryTime(entries[i]), entryTime(entries[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return entryRank[entries[i].Kind] < entryRank[entries[j].Kind]
+	})
+
+	// Restore the original (nil) timestamp on messages that borrowed one for
+	// sorting.
+	for i := range entries {
+		if entries[i].Message != nil {
+			entries[i].CreatedAt = entries[i].Message.CreatedAt
+		}
+	}
+
+	return &Transcript{Session: session, Entries: entries}, nil
+}
+
+func entryTime(e TranscriptEntry) int64 {
+	if e.CreatedAt == nil {
+		return 0
+	}
+	return *e.CreatedAt
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func seedSessions(t *testing.T, store *Store) {
+	t.Helper()
+
+	sessions := []Session{
+		{ID: "s1", Title: strPtr("First"), ProjectName: strPtr("clankers"), Source: strPtr("opencode"), Model: strPtr("gpt-5"), Status: strPtr("completed"), Cost: float64Ptr(0.5), CreatedAt: int64Ptr(1000)},
+		{ID: "s2", Title: strPtr("Second"), ProjectName: strPtr("clankers"), Source: strPtr("claude-code"), Model: strPtr("sonnet"), Status: strPtr("active"), Cost: float64Ptr(2.25), CreatedAt: int64Ptr(2000)},
+		{ID: "s3", Title: strPtr("Third"), ProjectName: strPtr("other"), ProjectPath: strPtr("/src/other"), Source: strPtr("opencode"), Model: strPtr("gpt-5"), Status: strPtr("completed"), Cost: float64Ptr(1.0), CreatedAt: int64Ptr(3000)},
+		{ID: "s4", Title: strPtr("Fourth"), ProjectName: strPtr("clankers"), Source: strPtr("opencode"), Model: strPtr("gpt-5"), Status: strPtr("completed"), Cost: float64Ptr(1.0), CreatedAt: int64Ptr(3000)},
+	}
+	for i := range sessions {
+		if err := store.UpsertSession(&sessions[i]); err != nil {
+			t.Fatalf("failed to create session %s: %v", sessions[i].ID, err)
+		}
+	}
+}
+
+func sessionIDs(sessions []Session) []string {
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListSessions(t *testing.T) {
+	store := createStore(t)
+	seedSessions(t, store)
+
+	tests := []struct {
+		name     string
+		filter   SessionFilter
+		expected []string
+	}{
+		{"newest first by default", SessionFilter{}, []string{"s4", "s3", "s2", "s1"}},
+		{"ascending", SessionFilter{Ascending: true}, []string{"s1", "s2", "s3", "s4"}},
+		{"by project name", SessionFilter{Project: "clankers"}, []string{"s4", "s2", "s1"}},
+		{"by project path", SessionFilter{Project: "/src/other"}, []string{"s3"}},
+		{"by source", SessionFilter{Source: "claude-code"}, []string{"s2"}},
+		{"by model and status", SessionFilter{Model: "gpt-5", Status: "completed"}, []string{"s4", "s3", "s1"}},
+		{"date range", SessionFilter{Since: 2000, Until: 3000}, []string{"s2"}},
+		{"by cost", SessionFilter{Sort: SortCost}, []string{"s2", "s4", "s3", "s1"}},
+		{"no matches", SessionFilter{Source: "missing"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := store.ListSessions(tt.filter)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := sessionIDs(page.Sessions); !equalIDs(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("expected no next cursor without a limit, got %q", page.NextCursor)
+			}
+		})
+	}
+
+	t.Run("unknown sort", func(t *testing.T) {
+		if _, err := store.ListSessions(SessionFilter{Sort: "title"}); !errors.Is(err, ErrInvalidFilter) {
+			t.Fatalf("expected ErrInvalidFilter for an unknown sort, got %v", err)
+		}
+	})
+}
+
+func TestListSessionsPagination(t *testing.T) {
+	store := createStore(t)
+	seedSessions(t, store)
+
+	for _, sortBy := range SessionSorts {
+		for _, asc := range []bool{false, true} {
+			full, err := store.ListSessions(SessionFilter{Sort: sortBy, Ascending: asc})
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", sortBy, err)
+			}
+
+			var paged []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(full.Sessions) {
+					t.Fatalf("%s: pagination did not terminate", sortBy)
+				}
+				page, err := store.ListSessions(SessionFilter{Sort: sortBy, Ascending: asc, Limit: 1, Cursor: cursor})
+				if err != nil {
+					t.Fatalf("%s: expected no error, got %v", sortBy, err)
+				}
+				paged = append(paged, sessionIDs(page.Sessions)...)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+
+			if expected := sessionIDs(full.Sessions); !equalIDs(paged, expected) {
+				t.Errorf("%s (asc=%t): expected pages to cover %v, got %v", sortBy, asc, expected, paged)
+			}
+		}
+	}
+
+	t.Run("last page has no cursor", func(t *testing.T) {
+		page, err := store.ListSessions(SessionFilter{Limit: 4})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if page.NextCursor != "" {
+			t.Errorf("expected no next cursor, got %q", page.NextCursor)
+		}
+	})
+
+	t.Run("rejects a cursor from another sort", func(t *testing.T) {
+		page, err := store.ListSessions(SessionFilter{Limit: 1})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := store.ListSessions(SessionFilter{Limit: 1, Sort: SortCost, Cursor: page.NextCursor}); err == nil {
+			t.Fatal("expected an error for a mismatched cursor")
+		}
+	})
+
+	t.Run("rejects a malformed cursor", func(t *testing.T) {
+		if _, err := store.ListSessions(SessionFilter{Cursor: "not-a-cursor"}); !errors.Is(err, ErrInvalidFilter) {
+			t.Fatal("expected an error for a malformed cursor")
+		}
+	})
+}
+
+func TestGetTranscript(t *testing.T) {
+	store := createStore(t)
+
+	if err := store.UpsertSession(&Session{ID: "session-1", Title: strPtr("Transcript")}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	if err := store.UpsertMessage(&Message{ID: "m1", SessionID: "session-1", Role: "user", TextContent: "hi", CreatedAt: int64Ptr(100)}); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	if err := store.UpsertMessage(&Message{ID: "m2", SessionID: "session-1", Role: "assistant", TextContent: "hello", CreatedAt: int64Ptr(300)}); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	if err := store.UpsertTool(&Tool{ID: "t1", SessionID: "session-1", MessageID: strPtr("m2"), ToolName: "Read", CreatedAt: 300}); err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+	if err := store.UpsertSessionError(&SessionError{ID: "e1", SessionID: "session-1", ErrorType: strPtr("api"), CreatedAt: 200}); err != nil {
+		t.Fatalf("failed to create session error: %v", err)
+	}
+	if err := store.UpsertCompactionEvent(&CompactionEvent{ID: "c1", SessionID: "session-1", TokensBefore: int64Ptr(1000), TokensAfter: int64Ptr(100), CreatedAt: 400}); err != nil {
+		t.Fatalf("failed to create compaction event: %v", err)
+	}
+
+	transcript, err := store.GetTranscript("session-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if transcript.Session.ID != "session-1" {
+		t.Errorf("expected session-1, got %s", transcript.Session.ID)
+	}
+
+	var got []string
+	for _, entry := range transcript.Entries {
+		switch entry.Kind {
+		case EntryMessage:
+			got = append(got, entry.Message.ID)
+		case EntryTool:
+			got = append(got, entry.Tool.ID)
+		case EntryError:
+			got = append(got, entry.Error.ID)
+		case EntryCompaction:
+			got = append(got, entry.Compaction.ID)
+		}
+	}
+
+	// The tool call shares its message's timestamp and sorts after it.
+	expected := []string{"m1", "e1", "m2", "t1", "c1"}
+	if !equalIDs(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if _, err := store.GetTranscript("missing"); err == nil {
+		t.Error("expected an error for a missing session")
+	}
+}
+
+func TestCountSessionsBySource(t *testing.T) {
+	store := createStore(t)
+	seedSessions(t, store)
+	if err := store.UpsertSession(&Session{ID: "s5", CreatedAt: int64Ptr(500), UpdatedAt: int64Ptr(9000)}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	counts, err := store.CountSessionsBySource()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := []SourceCount{
+		{Source: "opencode", Sessions: 3},
+		{Source: "", Sessions: 1},
+		{Source: "claude-code", Sessions: 1},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("expected %d sources, got %+v", len(want), counts)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("source %d: expected %+v, got %+v", i, want[i], counts[i])
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StatsTotals counts what was recorded for the matching sessions.
+type StatsTotals struct {
+	Sessions         int64   `json:"sessions"`
+	Messages         int64   `json:"messages"`
+	ToolCalls        int64   `json:"toolCalls"`
+	FailedToolCalls  int64   `json:"failedToolCalls"`
+	Errors           int64   `json:"errors"`
+	Compactions      int64   `json:"compactions"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// StatsGroup summarises the matching sessions that share a source or model.
+type StatsGroup struct {
+	Key              string  `json:"key"` // empty when sessions have no value
+	Sessions         int64   `json:"sessions"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+type Stats struct {
+	Totals   StatsTotals  `json:"totals"`
+	BySource []StatsGroup `json:"bySource"`
+	ByModel  []StatsGroup `json:"byModel"`
+}
+
+// GetStats aggregates the sessions matching filter. Sort, paging and cursor
+// fields are ignored.
+func (s *Store) GetStats(filter SessionFilter) (*Stats, error) {
+	where, args := filterConditions(filter)
+	sessions := "SELECT id, prompt_tokens, completion_tokens, cost FROM sessions"
+	if len(where) > 0 {
+		sessions += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	stats := &Stats{}
+	t := &stats.Totals
+	err := s.readDb.QueryRow(`
+		WITH matched AS (`+sessions+`)
+		SELECT
+			(SELECT COUNT(*) FROM matched),
+			(SELECT COUNT(*) FROM messages WHERE session_id IN (SELECT id FROM matched)),
+			(SELECT COUNT(*) FROM tools WHERE session_id IN (SELECT id FROM matched)),
+			(SELECT COUNT(*) FROM tools WHERE success = 0 AND session_id IN (SELECT id FROM matched)),
+			(SELECT COUNT(*) FROM session_errors WHERE session_id IN (SELECT id FROM matched)),
+			(SELECT COUNT(*) FROM compaction_events WHERE session_id IN (SELECT id FROM matched)),
+			(SELECT COALESCE(SUM(prompt_tokens), 0) FROM matched),
+			(SELECT COALESCE(SUM(completion_tokens), 0) FROM matched),
+			(SELECT COALESCE(SUM(cost), 0) FROM matched)`, args...).Scan(
+		&t.Sessions, &t.Messages, &t.ToolCalls, &t.FailedToolCalls, &t.Errors, &t.Compactions,
+		&t.PromptTokens, &t.CompletionTokens, &t.Cost,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.BySource, err = s.statsGroups("source", where, args); err != nil {
+		return nil, err
+	}
+	if stats.ByModel, err = s.statsGroups("model", where, args); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// statsGroups groups the matching sessions by column, most sessions first.
+func (s *Store) statsGroups(column string, where []string, args []any) ([]StatsGroup, error) {
+	query := fmt.Sprintf(`
+		SELECT COALESCE(%[1]s, '') AS key, COUNT(*) AS sessions,
+			COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)
+		FROM sessions`, column)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " GROUP BY key ORDER BY sessions DESC, key ASC"
+
+	rows, err := s.readDb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []StatsGroup{}
+	for rows.Next() {
+		var g StatsGroup
+		if err := rows.Scan(&g.Key, &g.Sessions, &g.PromptTokens, &g.CompletionTokens, &g.Cost); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestGetStats(t *testing.T) {
+	store := createStore(t)
+	seedSessions(t, store)
+
+	failed := false
+	if err := store.UpsertMessage(&Message{ID: "m1", SessionID: "s1", Role: "user", TextContent: "hi", PromptTokens: int64Ptr(10)}); err != nil {
+		t.Fatalf("failed to create message: %v", err)
+	}
+	if err := store.UpsertTool(&Tool{ID: "t1", SessionID: "s1", ToolName: "Read", CreatedAt: 1}); err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+	if err := store.UpsertTool(&Tool{ID: "t2", SessionID: "s2", ToolName: "Edit", Success: &failed, CreatedAt: 2}); err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+	if err := store.UpsertSessionError(&SessionError{ID: "e1", SessionID: "s3", CreatedAt: 3}); err != nil {
+		t.Fatalf("failed to create session error: %v", err)
+	}
+
+	stats, err := store.GetStats(SessionFilter{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := StatsTotals{Sessions: 4, Messages: 1, ToolCalls: 2, FailedToolCalls: 1, Errors: 1, Cost: 4.75}
+	if stats.Totals != want {
+		t.Errorf("expected %+v, got %+v", want, stats.Totals)
+	}
+	if len(stats.BySource) != 2 || stats.BySource[0] != (StatsGroup{Key: "opencode", Sessions: 3, Cost: 2.5}) {
+		t.Errorf("expected opencode first with 3 sessions, got %+v", stats.BySource)
+	}
+	if len(stats.ByModel) != 2 || stats.ByModel[1].Key != "sonnet" {
+		t.Errorf("expected gpt-5 then sonnet, got %+v", stats.ByModel)
+	}
+
+	stats, err = store.GetStats(SessionFilter{Source: "claude-code"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want = StatsTotals{Sessions: 1, ToolCalls: 1, FailedToolCalls: 1, Cost: 2.25}
+	if stats.Totals != want {
+		t.Errorf("expected %+v, got %+v", want, stats.Totals)
+	}
+
+	stats, err = store.GetStats(SessionFilter{Source: "missing"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Totals != (StatsTotals{}) || stats.BySource == nil || len(stats.BySource) != 0 {
+		t.Errorf("expected empty stats, got %+v", stats)
+	}
+}
@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,95 +14,37 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-const schemaSQL = `
-CREATE TABLE IF NOT EXISTS sessions (
-	id TEXT PRIMARY KEY,
-	title TEXT,
-	project_path TEXT,
-	project_name TEXT,
-	model TEXT,
-	provider TEXT,
-	source TEXT,
-	status TEXT,
-	prompt_tokens INTEGER,
-	completion_tokens INTEGER,
-	cost REAL,
-	message_count INTEGER,
-	tool_call_count INTEGER,
-	permission_mode TEXT,
-	created_at INTEGER,
-	updated_at INTEGER,
-	ended_at INTEGER
-);
-
-CREATE TABLE IF NOT EXISTS messages (
-	id TEXT PRIMARY KEY,
-	session_id TEXT,
-	role TEXT,
-	text_content TEXT,
-	model TEXT,
-	source TEXT,
-	prompt_tokens INTEGER,
-	completion_tokens INTEGER,
-	duration_ms INTEGER,
-	created_at INTEGER,
-	completed_at INTEGER,
-	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
-);
-
-CREATE TABLE IF NOT EXISTS tools (
-	id TEXT PRIMARY KEY,
-	session_id TEXT NOT NULL,
-	message_id TEXT,
-	tool_name TEXT NOT NULL,
-	tool_input TEXT,
-	tool_output TEXT,
-	file_path TEXT,
-	success BOOLEAN,
-	error_message TEXT,
-	duration_ms INTEGER,
-	created_at INTEGER NOT NULL,
-	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
-);
-
-CREATE INDEX IF NOT EXISTS idx_tools_session ON tools(session_id);
-CREATE INDEX IF NOT EXISTS idx_tools_name ON tools(tool_name);
-CREATE INDEX IF NOT EXISTS idx_tools_file ON tools(file_path);
-
-CREATE TABLE IF NOT EXISTS session_errors (
-	id TEXT PRIMARY KEY,
-	session_id TEXT NOT NULL,
-	error_type TEXT,
-	error_message TEXT,
-	created_at INTEGER NOT NULL,
-	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
-);
-
-CREATE INDEX IF NOT EXISTS idx_session_errors_session ON session_errors(session_id);
-
-CREATE TABLE IF NOT EXISTS compaction_events (
-	id TEXT PRIMARY KEY,
-	session_id TEXT NOT NULL,
-	tokens_before INTEGER,
-	tokens_after INTEGER,
-	messages_before INTEGER,
-	messages_after INTEGER,
-	created_at INTEGER NOT NULL,
-	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
-);
-
-CREATE INDEX IF NOT EXISTS idx_compaction_session ON compaction_events(session_id);
-`
+// Session and message upserts bind numbered parameters so the raw payload
+// values can be inspected in the conflict clause: a NULL parameter means the
+// field was absent from the payload, as opposed to excluded.*, which holds
+// the value after insert defaults are applied.
+//
+// Version-gated fields are only overwritten when the payload carries them
+// and the write is not stale (see sessionStaleSQL and messageStaleSQL).
+// This keeps hooks that race from moving token totals, costs or completion
+// state backwards.
+
+// sessionStaleSQL is true when the incoming session write is older than the
+// stored row. Revisions are compared when both sides have one, otherwise
+// updated_at. Writes that carry neither are never stale.
+const sessionStaleSQL = `(CASE
+	WHEN ?18 IS NOT NULL AND sessions.revision IS NOT NULL THEN ?18 < sessions.revision
+	WHEN ?16 IS NOT NULL AND sessions.updated_at IS NOT NULL THEN ?16 < sessions.updated_at
+	ELSE 0 END)`
 
 const upsertSessionSQL = `
 INSERT INTO sessions (
 	id, title, project_path, project_name, model, provider, source, status,
 	prompt_tokens, completion_tokens, cost, message_count, tool_call_count,
-	permission_mode, created_at, updated_at, ended_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	permission_mode, created_at, updated_at, ended_at, revision
+) VALUES (
+	?1, COALESCE(?2, 'Untitled Session'), ?3, ?4, ?5, ?6, ?7, ?8,
+	COALESCE(?9, 0), COALESCE(?10, 0), COALESCE(?11, 0), COALESCE(?12, 0), COALESCE(?13, 0),
+	?14, ?15, ?16, ?17, ?18
+)
 ON CONFLICT(id) DO UPDATE SET
-	title = CASE WHEN excluded.title IS NOT NULL AND excluded.title != ''
-	             THEN excluded.title ELSE sessions.title END,
+	title = CASE WHEN ?2 IS NOT NULL AND ?2 != ''
+	             THEN ?2 ELSE sessions.title END,
 	model = CASE WHEN excluded.model IS NOT NULL AND excluded.model != ''
 	             THEN excluded.model ELSE sessions.model END,
 	provider = CASE WHEN excluded.provider IS NOT NULL AND excluded.provider != ''
@@ -110,38 +56,79 @@ ON CONFLICT(id) DO UPDATE SET
 	permission_mode = CASE WHEN excluded.permission_mode IS NOT NULL AND excluded.permission_mode != ''
 	                       THEN excluded.permission_mode ELSE sessions.permission_mode END,
 	created_at = COALESCE(sessions.created_at, excluded.created_at),
-	project_path = excluded.project_path,
-	project_name = excluded.project_name,
-	prompt_tokens = excluded.prompt_tokens,
-	completion_tokens = excluded.completion_tokens,
-	cost = excluded.cost,
-	message_count = COALESCE(excluded.message_count, sessions.message_count),
-	tool_call_count = COALESCE(excluded.tool_call_count, sessions.tool_call_count),
-	updated_at = excluded.updated_at,
-	ended_at = COALESCE(excluded.ended_at, sessions.ended_at);
+	ended_at = COALESCE(excluded.ended_at, sessions.ended_at),
+	project_path = CASE WHEN ?3 IS NULL OR ` + sessionStaleSQL + `
+	                    THEN sessions.project_path ELSE ?3 END,
+	project_name = CASE WHEN ?4 IS NULL OR ` + sessionStaleSQL + `
+	                    THEN sessions.project_name ELSE ?4 END,
+	prompt_tokens = CASE WHEN ?9 IS NULL OR ` + sessionStaleSQL + `
+	                     THEN sessions.prompt_tokens ELSE ?9 END,
+	completion_tokens = CASE WHEN ?10 IS NULL OR ` + sessionStaleSQL + `
+	                         THEN sessions.completion_tokens ELSE ?10 END,
+	cost = CASE WHEN ?11 IS NULL OR ` + sessionStaleSQL + `
+	            THEN sessions.cost ELSE ?11 END,
+	message_count = CASE WHEN ?12 IS NULL OR ` + sessionStaleSQL + `
+	                     THEN sessions.message_count ELSE ?12 END,
+	tool_call_count = CASE WHEN ?13 IS NULL OR ` + sessionStaleSQL + `
+	                       THEN sessions.tool_call_count ELSE ?13 END,
+	updated_at = CASE WHEN ` + sessionStaleSQL + `
+	                  THEN sessions.updated_at ELSE COALESCE(?16, sessions.updated_at) END,
+	revision = CASE WHEN ` + sessionStaleSQL + `
+	                THEN sessions.revision ELSE COALESCE(?18, sessions.revision) END;
 `
 
+// checkSessionStaleSQL evaluates sessionStaleSQL against the stored row with
+// the same arguments as upsertSessionSQL.
+const checkSessionStaleSQL = `SELECT ` + sessionStaleSQL + ` FROM sessions WHERE id = ?1`
+
+// messageStaleSQL is true when the incoming message write is older than the
+// stored row. Revisions are compared when both sides have one, otherwise
+// completed_at, which is the only timestamp a message update carries. Once a
+// message is completed, a write that carries neither is an in-progress
+// update that arrived late, so it is stale too.
+const messageStaleSQL = `(CASE
+	WHEN ?12 IS NOT NULL AND messages.revision IS NOT NULL THEN ?12 < messages.revision
+	WHEN messages.completed_at IS NULL THEN 0
+	WHEN ?11 IS NOT NULL THEN ?11 < messages.completed_at
+	ELSE ?12 IS NULL END)`
+
 const upsertMessageSQL = `
 INSERT INTO messages (
 	id, session_id, role, text_content, model, source,
 	prompt_tokens, completion_tokens, duration_ms,
-	created_at, completed_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	created_at, completed_at, revision
+) VALUES (
+	?1, ?2, ?3, ?4, ?5, ?6,
+	COALESCE(?7, 0), COALESCE(?8, 0), ?9,
+	?10, ?11, ?12
+)
 ON CONFLICT(id) DO UPDATE SET
-	text_content = CASE WHEN excluded.text_content IS NOT NULL AND excluded.text_content != ''
-	                    THEN excluded.text_content ELSE messages.text_content END,
 	source = CASE WHEN excluded.source IS NOT NULL AND excluded.source != ''
 	              THEN excluded.source ELSE messages.source END,
 	created_at = COALESCE(messages.created_at, excluded.created_at),
 	session_id = excluded.session_id,
-	role = excluded.role,
-	model = excluded.model,
-	prompt_tokens = excluded.prompt_tokens,
-	completion_tokens = excluded.completion_tokens,
-	duration_ms = excluded.duration_ms,
-	completed_at = excluded.completed_at;
+	text_content = CASE WHEN excluded.text_content IS NULL OR excluded.text_content = '' OR ` + messageStaleSQL + `
+	                    THEN messages.text_content ELSE excluded.text_content END,
+	role = CASE WHEN ` + messageStaleSQL + `
+	            THEN messages.role ELSE excluded.role END,
+	model = CASE WHEN ?5 IS NULL OR ` + messageStaleSQL + `
+	             THEN messages.model ELSE ?5 END,
+	prompt_tokens = CASE WHEN ?7 IS NULL OR ` + messageStaleSQL + `
+	                     THEN messages.prompt_tokens ELSE ?7 END,
+	completion_tokens = CASE WHEN ?8 IS NULL OR ` + messageStaleSQL + `
+	                         THEN messages.completion_tokens ELSE ?8 END,
+	duration_ms = CASE WHEN ?9 IS NULL OR ` + messageStaleSQL + `
+	                   THEN messages.duration_ms ELSE ?9 END,
+	completed_at = CASE WHEN ?11 IS NULL OR ` + messageStaleSQL + `
+	                    THEN messages.completed_at ELSE ?11 END,
+	revision = CASE WHEN ` + messageStaleSQL + `
+	                THEN messages.revision ELSE COALESCE(?12, messages.revision) END;
 `
 
+// checkMessageStaleSQL evaluates messageStaleSQL against the stored row with
+// the same arguments as upsertMessageSQL.
+const checkMessageStaleSQL = `SELECT ` + messageStaleSQL + ` FROM messages WHERE id = ?1`
+
 const upsertToolSQL = `
 INSERT INTO tools (
 	id, session_id, message_id, tool_name, tool_input, tool_output,
@@ -175,8 +162,12 @@ ON CONFLICT(id) DO UPDATE SET
 	messages_after = excluded.messages_after;
 `
 
+// Store owns one writer connection and a pool of read-only connections.
+// In WAL mode readers see the last committed state and never wait for the
+// writer, so long queries and ingestion do not block each other.
 type Store struct {
-	db                 *sql.DB
+	db                 *sql.DB // writer; pinned to one connection
+	readDb             *sql.DB // readers; up to maxReadConns connections
 	upsertSession      *sql.Stmt
 	upsertMessage      *sql.Stmt
 	upsertTool         *sql.Stmt
@@ -202,6 +193,7 @@ type Session struct {
 	CreatedAt        *int64   `json:"createdAt,omitempty"`
 	UpdatedAt        *int64   `json:"updatedAt,omitempty"`
 	EndedAt          *int64   `json:"endedAt,omitempty"`
+	Revision         *int64   `json:"revision,omitempty"`
 }
 
 type Message struct {
@@ -216,6 +208,7 @@ type Message struct {
 	DurationMs       *int64  `json:"durationMs,omitempty"`
 	CreatedAt        *int64  `json:"createdAt,omitempty"`
 	CompletedAt      *int64  `json:"completedAt,omitempty"`
+	Revision         *int64  `json:"revision,omitempty"`
 }
 
 type Tool struct {
@@ -250,7 +243,87 @@ type CompactionEvent struct {
 	CreatedAt      int64  `json:"createdAt"`
 }
 
-type QueryResult map[string]interface{}
+// QueryColumn describes one result column. DeclType is the declared type of
+// the underlying table column and is empty for expressions.
+type QueryColumn struct {
+	Name     string `json:"name"`
+	DeclType string `json:"type,omitempty"`
+}
+
+// QueryResult holds rows in column order so callers can render them stably.
+// Truncated is set when the statement had more rows than the caller's limit.
+//
+// In JSON, REAL values always carry a decimal point or exponent (2.0, not
+// 2), so decoding restores INTEGER values as int64 and REAL values as
+// float64, the types ExecuteQuery returns.
+type QueryResult struct {
+	Columns   []QueryColumn `json:"columns"`
+	Rows      [][]any       `json:"rows"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// queryResultJSON is QueryResult without its JSON methods.
+type queryResultJSON QueryResult
+
+func (r QueryResult) MarshalJSON() ([]byte, error) {
+	rows := make([][]any, len(r.Rows))
+	for i, row := range r.Rows {
+		rows[i] = make([]any, len(row))
+		for j, v := range row {
+			if f, ok := v.(float64); ok {
+				v = realValue(f)
+			}
+			rows[i][j] = v
+		}
+	}
+	plain := queryResultJSON(r)
+	plain.Rows = rows
+	return json.Marshal(plain)
+}
+
+func (r *QueryResult) UnmarshalJSON(data []byte) error {
+	var plain queryResultJSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&plain); err != nil {
+		return err
+	}
+	for _, row := range plain.Rows {
+		for i, v := range row {
+			if n, ok := v.(json.Number); ok {
+				row[i] = numberValue(n)
+			}
+		}
+	}
+	*r = QueryResult(plain)
+	return nil
+}
+
+// realValue encodes a REAL so it reads back as one.
+type realValue float64
+
+func (f realValue) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(float64(f))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.ContainsAny(data, ".eE") {
+		data = append(data, ".0"...)
+	}
+	return data, nil
+}
+
+// numberValue is an int64 for a number written without a decimal point or
+// exponent, and a float64 otherwise.
+func numberValue(n json.Number) any {
+	if !strings.ContainsAny(n.String(), ".eE") {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+	}
+	f, _ := n.Float64()
+	return f
+}
 
 var sqlitePragmas = []string{
 	"PRAGMA journal_mode = WAL;",
@@ -287,7 +360,8 @@ func EnsureDb(dbPath string) (bool, error) {
 		return false, err
 	}
 
-	if _, err := db.Exec(schemaSQL); err != nil {
+	// Freshly created databases have nothing worth backing up.
+	if _, err := migrate(db, dbPath, MigrateOptions{Backup: !created}); err != nil {
 		return false, err
 	}
 
@@ -305,6 +379,11 @@ func Open(dbPath string) (*Store, error) {
 		return nil, err
 	}
 
+	if err := checkSchema(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	upsertSession, err := db.Prepare(upsertSessionSQL)
 	if err != nil {
 		db.Close()
@@ -345,8 +424,20 @@ func Open(dbPath string) (*Store, error) {
 		return nil, err
 	}
 
+	readDb, err := openReadPool(dbPath)
+	if err != nil {
+		upsertSession.Close()
+		upsertMessage.Close()
+		upsertTool.Close()
+		upsertSessionError.Close()
+		upsertCompaction.Close()
+		db.Close()
+		return nil, err
+	}
+
 	return &Store{
 		db:                 db,
+		readDb:             readDb,
 		upsertSession:      upsertSession,
 		upsertMessage:      upsertMessage,
 		upsertTool:         upsertTool,
@@ -355,91 +446,149 @@ func Open(dbPath string) (*Store, error) {
 	}, nil
 }
 
+// OpenReadOnly opens only the read pool. Nothing is prepared or written, so
+// it is safe next to a running daemon. Writes return ErrReadOnly.
+func OpenReadOnly(dbPath string) (*Store, error) {
+	// mode=ro cannot create the file, but its error does not say why.
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+
+	readDb, err := openReadPool(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(readDb); err != nil {
+		readDb.Close()
+		return nil, err
+	}
+	return &Store{readDb: readDb}, nil
+}
+
+// checkSchema rejects a database older than this build. Statements and
+// reads reference columns from every migration, so an older schema fails
+// here with a useful message rather than on the first query. EnsureDb and
+// the daemon migrate; read-only commands do not.
+func checkSchema(db *sql.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version < LatestSchemaVersion() {
+		return fmt.Errorf("database schema is at version %d but this build needs %d: run 'clankers db migrate' or start the daemon", version, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// Checkpoint copies every WAL frame into the database file and truncates
+// the WAL, so the database file alone holds all committed data. It fails
+// if a reader kept part of the WAL from being copied.
+func (s *Store) Checkpoint() error {
+	if s.db == nil {
+		return ErrReadOnly
+	}
+	var busy, walFrames, checkpointed int
+	if err := s.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &walFrames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return fmt.Errorf("checkpoint blocked by a reader (%d of %d frames copied)", checkpointed, walFrames)
+	}
+	return nil
+}
+
 func (s *Store) Close() error {
+	if s.db == nil {
+		return s.readDb.Close()
+	}
 	s.upsertSession.Close()
 	s.upsertMessage.Close()
 	s.upsertTool.Close()
 	s.upsertSessionError.Close()
 	s.upsertCompaction.Close()
+	s.readDb.Close()
 	return s.db.Close()
 }
 
+// UpsertSession writes one session in a Batch of its own, so it is merged
+// and recorded in change_history like every other write.
 func (s *Store) UpsertSession(session *Session) error {
-	title := "Untitled Session"
-	if session.Title != nil {
-		title = *session.Title
-	}
-	promptTokens := int64(0)
-	if session.PromptTokens != nil {
-		promptTokens = *session.PromptTokens
-	}
-	completionTokens := int64(0)
-	if session.CompletionTokens != nil {
-		completionTokens = *session.CompletionTokens
-	}
-	cost := float64(0)
-	if session.Cost != nil {
-		cost = *session.Cost
-	}
-	messageCount := int64(0)
-	if session.MessageCount != nil {
-		messageCount = *session.MessageCount
+	return s.upsertOne(func(b *Batch) (Change, error) { return b.UpsertSession(session) })
+}
+
+func (s *Store) UpsertMessage(msg *Message) error {
+	return s.upsertOne(func(b *Batch) (Change, error) { return b.UpsertMessage(msg) })
+}
+
+func (s *Store) UpsertTool(tool *Tool) error {
+	return s.upsertOne(func(b *Batch) (Change, error) { return b.UpsertTool(tool) })
+}
+
+func (s *Store) UpsertSessionError(errRecord *SessionError) error {
+	return s.upsertOne(func(b *Batch) (Change, error) { return b.UpsertSessionError(errRecord) })
+}
+
+func (s *Store) UpsertCompactionEvent(event *CompactionEvent) error {
+	return s.upsertOne(func(b *Batch) (Change, error) { return b.UpsertCompactionEvent(event) })
+}
+
+// upsertOne commits a single upsert as its own unattributed Batch.
+func (s *Store) upsertOne(upsert func(*Batch) (Change, error)) error {
+	batch, err := s.BeginBatch()
+	if err != nil {
+		return err
 	}
-	toolCallCount := int64(0)
-	if session.ToolCallCount != nil {
-		toolCallCount = *session.ToolCallCount
+	defer batch.Rollback()
+	if _, err := upsert(batch); err != nil {
+		return err
 	}
+	return batch.Commit()
+}
 
-	_, err := s.upsertSession.Exec(
+// sessionArgs binds a session to upsertSessionSQL. Absent fields stay nil;
+// the SQL fills insert defaults and leaves stored values alone on update.
+func sessionArgs(session *Session) []any {
+	return []any{
 		session.ID,
-		title,
+		session.Title,
 		session.ProjectPath,
 		session.ProjectName,
 		session.Model,
 		session.Provider,
 		session.Source,
 		session.Status,
-		promptTokens,
-		completionTokens,
-		cost,
-		messageCount,
-		toolCallCount,
+		session.PromptTokens,
+		session.CompletionTokens,
+		session.Cost,
+		session.MessageCount,
+		session.ToolCallCount,
 		session.PermissionMode,
 		session.CreatedAt,
 		session.UpdatedAt,
 		session.EndedAt,
-	)
-	return err
-}
-
-func (s *Store) UpsertMessage(msg *Message) error {
-	promptTokens := int64(0)
-	if msg.PromptTokens != nil {
-		promptTokens = *msg.PromptTokens
-	}
-	completionTokens := int64(0)
-	if msg.CompletionTokens != nil {
-		completionTokens = *msg.CompletionTokens
+		session.Revision,
 	}
+}
 
-	_, err := s.upsertMessage.Exec(
+func messageArgs(msg *Message) []any {
+	return []any{
 		msg.ID,
 		msg.SessionID,
 		msg.Role,
 		msg.TextContent,
 		msg.Model,
 		msg.Source,
-		promptTokens,
-		completionTokens,
+		msg.PromptTokens,
+		msg.CompletionTokens,
 		msg.DurationMs,
 		msg.CreatedAt,
 		msg.CompletedAt,
-	)
-	return err
+		msg.Revision,
+	}
 }
 
-func (s *Store) UpsertTool(tool *Tool) error {
-	_, err := s.upsertTool.Exec(
+func toolArgs(tool *Tool) []any {
+	return []any{
 		tool.ID,
 		tool.SessionID,
 		tool.MessageID,
@@ -451,23 +600,21 @@ func (s *Store) UpsertTool(tool *Tool) error {
 		tool.ErrorMessage,
 		tool.DurationMs,
 		tool.CreatedAt,
-	)
-	return err
+	}
 }
 
-func (s *Store) UpsertSessionError(errRecord *SessionError) error {
-	_, err := s.upsertSessionError.Exec(
+func sessionErrorArgs(errRecord *SessionError) []any {
+	return []any{
 		errRecord.ID,
 		errRecord.SessionID,
 		errRecord.ErrorType,
 		errRecord.ErrorMessage,
 		errRecord.CreatedAt,
-	)
-	return err
+	}
 }
 
-func (s *Store) UpsertCompactionEvent(event *CompactionEvent) error {
-	_, err := s.upsertCompaction.Exec(
+func compactionEventArgs(event *CompactionEvent) []any {
+	return []any{
 		event.ID,
 		event.SessionID,
 		event.TokensBefore,
@@ -475,205 +622,52 @@ func (s *Store) UpsertCompactionEvent(event *CompactionEvent) error {
 		event.MessagesBefore,
 		event.MessagesAfter,
 		event.CreatedAt,
-	)
-	return err
+	}
 }
 
 func (s *Store) GetSessions(limit int) ([]Session, error) {
-	query := `SELECT id, title, project_path, project_name, model, provider, source, status,
-		prompt_tokens, completion_tokens, cost, message_count, tool_call_count,
-		permission_mode, created_at, updated_at, ended_at
-		FROM sessions ORDER BY created_at DESC`
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT %d", limit)
-	}
-
-	rows, err := s.db.Query(query)
+	page, err := s.ListSessions(SessionFilter{Limit: limit})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var sessions []Session
-	for rows.Next() {
-		var s Session
-		var title sql.NullString
-		var projectPath sql.NullString
-		var projectName sql.NullString
-		var model sql.NullString
-		var provider sql.NullString
-		var source sql.NullString
-		var status sql.NullString
-		var promptTokens sql.NullInt64
-		var completionTokens sql.NullInt64
-		var cost sql.NullFloat64
-		var messageCount sql.NullInt64
-		var toolCallCount sql.NullInt64
-		var permissionMode sql.NullString
-		var createdAt sql.NullInt64
-		var updatedAt sql.NullInt64
-		var endedAt sql.NullInt64
-
-		err := rows.Scan(
-			&s.ID, &title, &projectPath, &projectName, &model, &provider, &source, &status,
-			&promptTokens, &completionTokens, &cost, &messageCount, &toolCallCount,
-			&permissionMode, &createdAt, &updatedAt, &endedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if title.Valid {
-			s.Title = &title.String
-		}
-		if projectPath.Valid {
-			s.ProjectPath = &projectPath.String
-		}
-		if projectName.Valid {
-			s.ProjectName = &projectName.String
-		}
-		if model.Valid {
-			s.Model = &model.String
-		}
-		if provider.Valid {
-			s.Provider = &provider.String
-		}
-		if source.Valid {
-			s.Source = &source.String
-		}
-		if status.Valid {
-			s.Status = &status.String
-		}
-		if promptTokens.Valid {
-			s.PromptTokens = &promptTokens.Int64
-		}
-		if completionTokens.Valid {
-			s.CompletionTokens = &completionTokens.Int64
-		}
-		if cost.Valid {
-			s.Cost = &cost.Float64
-		}
-		if messageCount.Valid {
-			s.MessageCount = &messageCount.Int64
-		}
-		if toolCallCount.Valid {
-			s.ToolCallCount = &toolCallCount.Int64
-		}
-		if permissionMode.Valid {
-			s.PermissionMode = &permissionMode.String
-		}
-		if createdAt.Valid {
-			s.CreatedAt = &createdAt.Int64
-		}
-		if updatedAt.Valid {
-			s.UpdatedAt = &updatedAt.Int64
-		}
-		if endedAt.Valid {
-			s.EndedAt = &endedAt.Int64
-		}
-
-		sessions = append(sessions, s)
-	}
-
-	return sessions, rows.Err()
+	return page.Sessions, nil
 }
 
 func (s *Store) GetSessionByID(id string) (*Session, []Message, error) {
-	var session Session
-	var title sql.NullString
-	var projectPath sql.NullString
-	var projectName sql.NullString
-	var model sql.NullString
-	var provider sql.NullString
-	var source sql.NullString
-	var status sql.NullString
-	var promptTokens sql.NullInt64
-	var completionTokens sql.NullInt64
-	var cost sql.NullFloat64
-	var messageCount sql.NullInt64
-	var toolCallCount sql.NullInt64
-	var permissionMode sql.NullString
-	var createdAt sql.NullInt64
-	var updatedAt sql.NullInt64
-	var endedAt sql.NullInt64
-
-	err := s.db.QueryRow(`
-		SELECT id, title, project_path, project_name, model, provider, source, status,
-			prompt_tokens, completion_tokens, cost, message_count, tool_call_count,
-			permission_mode, created_at, updated_at, ended_at
-		FROM sessions WHERE id = ?`, id).Scan(
-		&session.ID, &title, &projectPath, &projectName, &model, &provider, &source, &status,
-		&promptTokens, &completionTokens, &cost, &messageCount, &toolCallCount,
-		&permissionMode, &createdAt, &updatedAt, &endedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil, fmt.Errorf("session not found: %s", id)
-	}
+	session, err := s.GetSession(id)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if title.Valid {
-		session.Title = &title.String
-	}
-	if projectPath.Valid {
-		session.ProjectPath = &projectPath.String
-	}
-	if projectName.Valid {
-		session.ProjectName = &projectName.String
-	}
-	if model.Valid {
-		session.Model = &model.String
-	}
-	if provider.Valid {
-		session.Provider = &provider.String
-	}
-	if source.Valid {
-		session.Source = &source.String
-	}
-	if status.Valid {
-		session.Status = &status.String
-	}
-	if promptTokens.Valid {
-		session.PromptTokens = &promptTokens.Int64
-	}
-	if completionTokens.Valid {
-		session.CompletionTokens = &completionTokens.Int64
-	}
-	if cost.Valid {
-		session.Cost = &cost.Float64
-	}
-	if messageCount.Valid {
-		session.MessageCount = &messageCount.Int64
-	}
-	if toolCallCount.Valid {
-		session.ToolCallCount = &toolCallCount.Int64
-	}
-	if permissionMode.Valid {
-		session.PermissionMode = &permissionMode.String
-	}
-	if createdAt.Valid {
-		session.CreatedAt = &createdAt.Int64
-	}
-	if updatedAt.Valid {
-		session.UpdatedAt = &updatedAt.Int64
-	}
-	if endedAt.Valid {
-		session.EndedAt = &endedAt.Int64
-	}
-
 	messages, err := s.GetMessages(id)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return &session, messages, nil
+	return session, messages, nil
+}
+
+// ErrSessionNotFound is returned when a session id is not in the database.
+var ErrSessionNotFound = errors.New("session not found")
+
+// GetSession returns one session without its messages.
+func (s *Store) GetSession(id string) (*Session, error) {
+	session, err := scanSession(s.readDb.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
 }
 
 func (s *Store) GetMessages(sessionID string) ([]Message, error) {
-	rows, err := s.db.Query(`
+	rows, err := s.readDb.Query(`
 		SELECT id, session_id, role, text_content, model, source,
-			prompt_tokens, completion_tokens, duration_ms, created_at, completed_at
+			prompt_tokens, completion_tokens, duration_ms, created_at, completed_at, revision
 		FROM messages WHERE session_id = ? ORDER BY created_at ASC`, sessionID)
 	if err != nil {
 		return nil, err
@@ -690,10 +684,11 @@ func (s *Store) GetMessages(sessionID string) ([]Message, error) {
 		var durationMs sql.NullInt64
 		var createdAt sql.NullInt64
 		var completedAt sql.NullInt64
+		var revision sql.NullInt64
 
 		err := rows.Scan(
 			&m.ID, &m.SessionID, &m.Role, &m.TextContent, &model, &source,
-			&promptTokens, &completionTokens, &durationMs, &createdAt, &completedAt,
+			&promptTokens, &completionTokens, &durationMs, &createdAt, &completedAt, &revision,
 		)
 		if err != nil {
 			return nil, err
@@ -720,6 +715,9 @@ func (s *Store) GetMessages(sessionID string) ([]Message, error) {
 		if completedAt.Valid {
 			m.CompletedAt = &completedAt.Int64
 		}
+		if revision.Valid {
+			m.Revision = &revision.Int64
+		}
 
 		messages = append(messages, m)
 	}
@@ -727,39 +725,55 @@ func (s *Store) GetMessages(sessionID string) ([]Message, error) {
 	return messages, rows.Err()
 }
 
-func (s *Store) ExecuteQuery(sql string) ([]QueryResult, error) {
-	writeKeywords := []string{
-		"INSERT", "UPDATE", "DELETE", "DROP", "CREATE", "ALTER", "TRUNCATE",
-		"REPLACE", "MERGE", "UPSERT", "ATTACH", "DETACH", "REINDEX", "VACUUM",
-		"PRAGMA", "BEGIN", "COMMIT", "ROLLBACK", "SAVEPOINT", "RELEASE",
+// ExecuteQuery runs a single read-only statement on a dedicated read-only
+// connection. Statements that would write are rejected before they run. The
+// statement is interrupted when ctx is done. When maxRows is positive, at
+// most maxRows rows are returned and Truncated reports that more were left.
+func (s *Store) ExecuteQuery(ctx context.Context, query string, maxRows int) (*QueryResult, error) {
+	statements, _ := SplitStatements(query)
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	if len(statements) > 1 {
+		return nil, fmt.Errorf("only one statement can be executed at a time (got %d)", len(statements))
 	}
 
-	upperSQL := strings.ToUpper(strings.TrimSpace(sql))
-	for _, keyword := range writeKeywords {
-		if strings.HasPrefix(upperSQL, keyword) || strings.Contains(upperSQL, " "+keyword+" ") {
-			return nil, fmt.Errorf("write operations are not allowed from the CLI: %s statements are blocked", keyword)
-		}
+	conn, err := s.readDb.Conn(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer discardConn(conn)
 
-	if !strings.HasPrefix(upperSQL, "SELECT") && !strings.HasPrefix(upperSQL, "WITH") {
-		return nil, fmt.Errorf("only SELECT queries are allowed from the CLI")
+	if err := checkReadOnly(conn, statements[0]); err != nil {
+		return nil, err
 	}
 
-	rows, err := s.db.Query(sql)
+	rows, err := conn.QueryContext(ctx, statements[0])
 	if err != nil {
-		return nil, err
+		return nil, queryStopped(ctx, err)
 	}
 	defer rows.Close()
 
-	columns, err := rows.Columns()
+	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
 		return nil, err
 	}
 
-	var results []QueryResult
+	result := &QueryResult{
+		Columns: make([]QueryColumn, len(columnTypes)),
+		Rows:    [][]any{},
+	}
+	for i, ct := range columnTypes {
+		result.Columns[i] = QueryColumn{Name: ct.Name(), DeclType: ct.DatabaseTypeName()}
+	}
+
 	for rows.Next() {
-		values := make([]any, len(columns))
-		valuePtrs := make([]any, len(columns))
+		if maxRows > 0 && len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		values := make([]any, len(columnTypes))
+		valuePtrs := make([]any, len(columnTypes))
 		for i := range values {
 			valuePtrs[i] = &values[i]
 		}
@@ -768,26 +782,30 @@ func (s *Store) ExecuteQuery(sql string) ([]QueryResult, error) {
 			return nil, err
 		}
 
-		row := make(QueryResult)
-		for i, col := range columns {
-			val := values[i]
-			switch v := val.(type) {
-			case []byte:
-				row[col] = string(v)
-			case nil:
-				row[col] = nil
-			default:
-				row[col] = v
+		for i, val := range values {
+			if v, ok := val.([]byte); ok {
+				values[i] = string(v)
 			}
 		}
-		results = append(results, row)
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryStopped(ctx, err)
 	}
+	return result, nil
+}
 
-	return results, rows.Err()
+// queryStopped reports a statement interrupted because ctx is done as
+// ctx's error, so callers can tell a timeout or cancellation from bad SQL.
+func queryStopped(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("query stopped: %w", ctx.Err())
+	}
+	return err
 }
 
 func (s *Store) GetTableSchema(tableName string) ([]string, error) {
-	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	rows, err := s.readDb.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
 	if err != nil {
 		return nil, err
 	}
@@ -811,12 +829,70 @@ func (s *Store) GetTableSchema(tableName string) ([]string, error) {
 	return columns, rows.Err()
 }
 
+// GetTableNames returns the user-visible tables and views in name order.
+// SQLite internals and full-text index shadow tables are left out.
+func (s *Store) GetTableNames() ([]string, error) {
+	rows, err := s.readDb.Query(`
+		SELECT name FROM pragma_table_list
+		WHERE schema = 'main'
+			AND type IN ('table', 'view', 'virtual')
+			AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+
+	return tables, rows.Err()
+}
+
+// GetSchemaSQL returns the CREATE statements for tableName and its indexes
+// and triggers, or for every user-visible table when tableName is empty.
+func (s *Store) GetSchemaSQL(tableName string) ([]string, error) {
+	rows, err := s.readDb.Query(`
+		SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL
+			AND name NOT LIKE 'sqlite_%'
+			AND tbl_name NOT IN (SELECT name FROM pragma_table_list WHERE type = 'shadow')
+			AND (? = '' OR tbl_name = ? COLLATE NOCASE)
+		ORDER BY tbl_name, type != 'table', name`, tableName, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return nil, err
+		}
+		statements = append(statements, stmt)
+	}
+
+	return statements, rows.Err()
+}
+
 func (s *Store) SuggestColumnNames(tableName string, input string) ([]string, error) {
 	columns, err := s.GetTableSchema(tableName)
 	if err != nil {
 		return nil, err
 	}
+	return MatchColumnNames(columns, input), nil
+}
 
+// MatchColumnNames returns the columns that contain input or are contained
+// in it, ignoring case.
+func MatchColumnNames(columns []string, input string) []string {
 	var suggestions []string
 	lowerInput := strings.ToLower(input)
 	for _, col := range columns {
@@ -825,6 +901,5 @@ func (s *Store) SuggestColumnNames(tableName string, input string) ([]string, er
 			suggestions = append(suggestions, col)
 		}
 	}
-
-	return suggestions, nil
+	return suggestions
 }
@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestEnsureDb(t *testing.T) {
@@ -135,6 +138,29 @@ func TestClose(t *testing.T) {
 
 }
 
+func TestCheckpointTruncatesWal(t *testing.T) {
+	store := createStore(t)
+
+	if err := store.UpsertSession(&Session{ID: "ses_1", Title: strPtr("Checkpointed")}); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+	if err := store.Checkpoint(); err != nil {
+		t.Fatalf("failed to checkpoint: %v", err)
+	}
+
+	var dbFile string
+	if err := store.db.QueryRow("PRAGMA database_list").Scan(new(int), new(string), &dbFile); err != nil {
+		t.Fatalf("failed to find database file: %v", err)
+	}
+	info, err := os.Stat(dbFile + "-wal")
+	if err != nil {
+		t.Fatalf("failed to stat WAL: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected an empty WAL after checkpoint, got %d bytes", info.Size())
+	}
+}
+
 func TestStoreUpsertSession(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "upsert_session_test.db")
@@ -241,6 +267,111 @@ func TestStoreUpsertMessage(t *testing.T) {
 	})
 }
 
+func TestUpsertSessionOutOfOrder(t *testing.T) {
+	store := createStore(t)
+
+	upsert := func(session *Session) {
+		t.Helper()
+		if err := store.UpsertSession(session); err != nil {
+			t.Fatalf("failed to upsert session: %v", err)
+		}
+	}
+	get := func() *Session {
+		t.Helper()
+		session, _, err := store.GetSessionByID("ses_1")
+		if err != nil {
+			t.Fatalf("failed to get session: %v", err)
+		}
+		return session
+	}
+
+	upsert(&Session{ID: "ses_1", Title: strPtr("Real title"), ProjectPath: strPtr("/new"),
+		PromptTokens: int64Ptr(500), Cost: float64Ptr(0.5), UpdatedAt: int64Ptr(2000)})
+
+	// A stale event must not move totals backwards.
+	upsert(&Session{ID: "ses_1", ProjectPath: strPtr("/old"), PromptTokens: int64Ptr(100),
+		Cost: float64Ptr(0.1), UpdatedAt: int64Ptr(1000)})
+	session := get()
+	if *session.PromptTokens != 500 || *session.Cost != 0.5 || *session.ProjectPath != "/new" || *session.UpdatedAt != 2000 {
+		t.Errorf("expected stale write to be ignored, got tokens=%d cost=%v path=%s updated=%d",
+			*session.PromptTokens, *session.Cost, *session.ProjectPath, *session.UpdatedAt)
+	}
+
+	// A partial payload leaves fields it does not carry alone.
+	upsert(&Session{ID: "ses_1", Model: strPtr("gpt-5")})
+	session = get()
+	if *session.PromptTokens != 500 || *session.Title != "Real title" || *session.Model != "gpt-5" {
+		t.Errorf("expected partial write to keep other fields, got tokens=%d title=%q model=%q",
+			*session.PromptTokens, *session.Title, *session.Model)
+	}
+
+	// Revisions win over timestamps when both sides have one.
+	upsert(&Session{ID: "ses_1", PromptTokens: int64Ptr(900), UpdatedAt: int64Ptr(3000), Revision: int64Ptr(5)})
+	upsert(&Session{ID: "ses_1", PromptTokens: int64Ptr(700), UpdatedAt: int64Ptr(9000), Revision: int64Ptr(4)})
+	session = get()
+	if *session.PromptTokens != 900 || *session.Revision != 5 {
+		t.Errorf("expected revision 5 to win, got tokens=%d revision=%d", *session.PromptTokens, *session.Revision)
+	}
+
+	// Newer writes still apply.
+	upsert(&Session{ID: "ses_1", PromptTokens: int64Ptr(1000), Revision: int64Ptr(6)})
+	if session = get(); *session.PromptTokens != 1000 {
+		t.Errorf("expected newer write to apply, got tokens=%d", *session.PromptTokens)
+	}
+}
+
+func TestUpsertMessageOutOfOrder(t *testing.T) {
+	store := createStore(t)
+	if err := store.UpsertSession(&Session{ID: "ses_1"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	upsert := func(msg *Message) *Message {
+		t.Helper()
+		if err := store.UpsertMessage(msg); err != nil {
+			t.Fatalf("failed to upsert message: %v", err)
+		}
+		messages, err := store.GetMessages("ses_1")
+		if err != nil {
+			t.Fatalf("failed to get messages: %v", err)
+		}
+		return &messages[0]
+	}
+
+	upsert(&Message{ID: "m1", SessionID: "ses_1", Role: "assistant", TextContent: "final answer",
+		Model: strPtr("gpt-5"), CompletionTokens: int64Ptr(300), CompletedAt: int64Ptr(2000)})
+
+	// An earlier completion is stale.
+	m := upsert(&Message{ID: "m1", SessionID: "ses_1", Role: "unknown", TextContent: "fin",
+		CompletionTokens: int64Ptr(10), CompletedAt: int64Ptr(1000)})
+	if m.Role != "assistant" || m.TextContent != "final answer" || *m.CompletionTokens != 300 || *m.CompletedAt != 2000 {
+		t.Errorf("expected the earlier completion to be ignored, got %+v", m)
+	}
+
+	// A late partial write without completed_at or a revision cannot undo
+	// the completion.
+	m = upsert(&Message{ID: "m1", SessionID: "ses_1", Role: "assistant", TextContent: "fi",
+		CompletionTokens: int64Ptr(10)})
+	if m.TextContent != "final answer" || *m.CompletionTokens != 300 || *m.CompletedAt != 2000 {
+		t.Errorf("expected the late partial write to be ignored, got %+v", m)
+	}
+
+	// A later completion applies.
+	m = upsert(&Message{ID: "m1", SessionID: "ses_1", Role: "assistant", TextContent: "final answer, edited",
+		CompletionTokens: int64Ptr(320), CompletedAt: int64Ptr(2500)})
+	if m.TextContent != "final answer, edited" || *m.CompletionTokens != 320 || *m.CompletedAt != 2500 {
+		t.Errorf("expected the later completion to apply, got %+v", m)
+	}
+
+	// Revisions win over completed_at when both sides have one.
+	upsert(&Message{ID: "m1", SessionID: "ses_1", Role: "assistant", CompletionTokens: int64Ptr(400), Revision: int64Ptr(3)})
+	m = upsert(&Message{ID: "m1", SessionID: "ses_1", Role: "user", CompletionTokens: int64Ptr(50),
+		CompletedAt: int64Ptr(9000), Revision: int64Ptr(2)})
+	if m.Role != "assistant" || *m.CompletionTokens != 400 || *m.CompletedAt != 2500 {
+		t.Errorf("expected revision 3 to win, got %+v", m)
+	}
+}
+
 func TestGetSessions(t *testing.T) {
 	store := createStore(t)
 
@@ -332,8 +463,8 @@ func TestGetSessionByID(t *testing.T) {
 		if err == nil {
 			t.Fatal("expected error for missing session")
 		}
-		if !strings.Contains(err.Error(), "session not found") {
-			t.Fatalf("expected not found error, got %v", err)
+		if !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("expected ErrSessionNotFound, got %v", err)
 		}
 	})
 }
@@ -390,39 +521,219 @@ func TestExecuteQuery(t *testing.T) {
 		t.Fatalf("failed to create session: %v", err)
 	}
 
-	results, err := store.ExecuteQuery("SELECT id, title FROM sessions WHERE id = 'session-query'")
+	results, err := store.ExecuteQuery(context.Background(), "SELECT id, title FROM sessions WHERE id = 'session-query'", 0)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
-	if len(results) != 1 {
-		t.Fatalf("expected 1 result, got %d", len(results))
+	if len(results.Rows) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results.Rows))
 	}
-	if results[0]["id"] != "session-query" {
-		t.Errorf("expected id session-query, got %v", results[0]["id"])
+	if len(results.Columns) != 2 || results.Columns[0].Name != "id" || results.Columns[1].Name != "title" {
+		t.Fatalf("expected columns [id title] in order, got %+v", results.Columns)
 	}
-	if results[0]["title"] != "Query Me" {
-		t.Errorf("expected title Query Me, got %v", results[0]["title"])
+	if results.Columns[0].DeclType != "TEXT" {
+		t.Errorf("expected declared type TEXT, got %q", results.Columns[0].DeclType)
 	}
+	if results.Rows[0][0] != "session-query" {
+		t.Errorf("expected id session-query, got %v", results.Rows[0][0])
+	}
+	if results.Rows[0][1] != "Query Me" {
+		t.Errorf("expected title Query Me, got %v", results.Rows[0][1])
+	}
+
+	t.Run("preserves column order", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			results, err := store.ExecuteQuery(context.Background(), "SELECT title, created_at, id FROM sessions", 0)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			names := []string{results.Columns[0].Name, results.Columns[1].Name, results.Columns[2].Name}
+			if names[0] != "title" || names[1] != "created_at" || names[2] != "id" {
+				t.Fatalf("expected [title created_at id], got %v", names)
+			}
+		}
+	})
+
+	t.Run("returns empty rows for no matches", func(t *testing.T) {
+		results, err := store.ExecuteQuery(context.Background(), "SELECT id FROM sessions WHERE id = 'missing'", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(results.Columns) != 1 || len(results.Rows) != 0 {
+			t.Fatalf("expected one column and no rows, got %+v", results)
+		}
+	})
+
+	t.Run("caps rows", func(t *testing.T) {
+		endless := "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT x FROM c"
+		results, err := store.ExecuteQuery(context.Background(), endless, 5)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(results.Rows) != 5 || !results.Truncated {
+			t.Fatalf("expected 5 rows and truncation, got %d rows, truncated %v", len(results.Rows), results.Truncated)
+		}
+
+		results, err = store.ExecuteQuery(context.Background(), "SELECT 1 UNION ALL SELECT 2", 2)
+		if err != nil || len(results.Rows) != 2 || results.Truncated {
+			t.Fatalf("expected both rows without truncation, got %+v, %v", results, err)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := store.ExecuteQuery(ctx, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c", 0)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("expected the query to be interrupted promptly, took %s", elapsed)
+		}
+	})
 }
 
 func TestExecuteQueryBlocksWrites(t *testing.T) {
 	store := createStore(t)
 
-	keywords := []string{
-		"INSERT", "UPDATE", "DELETE", "DROP", "CREATE", "ALTER", "TRUNCATE",
-		"REPLACE", "MERGE", "UPSERT", "ATTACH", "DETACH", "REINDEX", "VACUUM",
-		"PRAGMA", "BEGIN", "COMMIT", "ROLLBACK", "SAVEPOINT", "RELEASE",
-	}
-
-	for _, keyword := range keywords {
-		_, err := store.ExecuteQuery(keyword + " sessions")
+	statements := map[string]string{
+		"INSERT":    "INSERT INTO sessions (id) VALUES ('x')",
+		"UPDATE":    "UPDATE sessions SET title = 'x'",
+		"DELETE":    "DELETE FROM messages",
+		"REPLACE":   "REPLACE INTO sessions (id) VALUES ('x')",
+		"DROP":      "DROP TABLE sessions",
+		"CREATE":    "CREATE TABLE evil (id TEXT)",
+		"ALTER":     "ALTER TABLE sessions ADD COLUMN evil TEXT",
+		"ATTACH":    "ATTACH 'other.db' AS other",
+		"REINDEX":   "REINDEX",
+		"VACUUM":    "VACUUM",
+		"PRAGMA":    "PRAGMA user_version = 42",
+		"BEGIN":     "BEGIN",
+		"SAVEPOINT": "SAVEPOINT sp",
+		"WITH":      "WITH x AS (SELECT 1) DELETE FROM sessions",
+	}
+
+	for keyword, statement := range statements {
+		_, err := store.ExecuteQuery(context.Background(), statement, 0)
 		if err == nil {
-			t.Fatalf("expected error for %s", keyword)
+			t.Fatalf("expected error for %s", statement)
+		}
+		if !errors.Is(err, ErrWriteNotAllowed) {
+			t.Fatalf("expected ErrWriteNotAllowed for %s, got %v", statement, err)
 		}
 		if !strings.Contains(err.Error(), keyword) {
 			t.Fatalf("expected error to mention %s, got %v", keyword, err)
 		}
 	}
+
+	t.Run("rejects multiple statements", func(t *testing.T) {
+		_, err := store.ExecuteQuery(context.Background(), "SELECT 1; DELETE FROM sessions", 0)
+		if err == nil || !strings.Contains(err.Error(), "one statement") {
+			t.Fatalf("expected multiple statement error, got %v", err)
+		}
+	})
+
+	t.Run("rejects mutating pragmas", func(t *testing.T) {
+		for _, statement := range []string{"PRAGMA journal_mode = DELETE", "PRAGMA wal_checkpoint(TRUNCATE)", "DETACH main"} {
+			if _, err := store.ExecuteQuery(context.Background(), statement, 0); !errors.Is(err, ErrWriteNotAllowed) {
+				t.Errorf("expected ErrWriteNotAllowed for %s, got %v", statement, err)
+			}
+		}
+	})
+
+	t.Run("connection cannot be switched back to writable", func(t *testing.T) {
+		if _, err := store.ExecuteQuery(context.Background(), "PRAGMA query_only = 0", 0); err != nil {
+			t.Fatalf("expected pragma to be accepted, got %v", err)
+		}
+		if _, err := store.ExecuteQuery(context.Background(), "INSERT INTO sessions (id) VALUES ('x')", 0); !errors.Is(err, ErrWriteNotAllowed) {
+			t.Fatalf("expected write to stay blocked, got %v", err)
+		}
+	})
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "readonly.db")
+	if _, err := OpenReadOnly(dbPath); err == nil {
+		t.Fatal("expected a missing database to fail instead of being created")
+	}
+
+	if _, err := EnsureDb(dbPath); err != nil {
+		t.Fatalf("failed to ensure DB: %v", err)
+	}
+	writer, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer writer.Close()
+	if err := writer.UpsertSession(&Session{ID: "ses_ro"}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	store, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("expected read-only open to succeed, got %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetSession("ses_ro"); err != nil {
+		t.Errorf("expected reads to work, got %v", err)
+	}
+	if err := store.UpsertSession(&Session{ID: "ses_other"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly from an upsert, got %v", err)
+	}
+	if _, err := store.BeginBatch(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly from BeginBatch, got %v", err)
+	}
+	if err := store.RebuildSearchIndex(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly from RebuildSearchIndex, got %v", err)
+	}
+}
+
+func TestExecuteQueryAllowsReads(t *testing.T) {
+	store := createStore(t)
+
+	if err := store.UpsertSession(&Session{ID: "session-read", Title: strPtr("banana")}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	queries := map[string]string{
+		"replace function":   "SELECT replace(title, 'a', 'o') AS title FROM sessions",
+		"literal keyword":    "SELECT ' DELETE ' AS note, title FROM sessions",
+		"table info pragma":  "PRAGMA table_info(sessions)",
+		"common table expr":  "WITH s AS (SELECT * FROM sessions) SELECT id FROM s",
+		"explain":            "EXPLAIN DELETE FROM sessions",
+		"trailing semicolon": "SELECT id FROM sessions; -- done",
+	}
+
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			results, err := store.ExecuteQuery(context.Background(), query, 0)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(results.Rows) == 0 {
+				t.Fatal("expected at least one row")
+			}
+		})
+	}
+
+	results, err := store.ExecuteQuery(context.Background(), "SELECT replace(title, 'a', 'o') AS title FROM sessions", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if results.Rows[0][0] != "bonono" {
+		t.Fatalf("expected bonono, got %v", results.Rows[0][0])
+	}
+
+	session, _, err := store.GetSessionByID("session-read")
+	if err != nil {
+		t.Fatalf("expected session to exist, got %v", err)
+	}
+	if *session.Title != "banana" {
+		t.Fatalf("expected title to be unchanged, got %s", *session.Title)
+	}
 }
 
 func TestGetTableSchema(t *testing.T) {
@@ -448,6 +759,67 @@ func TestGetTableSchema(t *testing.T) {
 	}
 }
 
+func TestGetTableNames(t *testing.T) {
+	store := createStore(t)
+
+	tables, err := store.GetTableNames()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tableSet := make(map[string]bool)
+	for _, table := range tables {
+		tableSet[table] = true
+	}
+
+	for _, table := range []string{"sessions", "messages", "tools", "messages_fts"} {
+		if !tableSet[table] {
+			t.Errorf("expected table %s, got %v", table, tables)
+		}
+	}
+	for _, table := range []string{"messages_fts_data", "sqlite_sequence"} {
+		if tableSet[table] {
+			t.Errorf("expected internal table %s to be hidden", table)
+		}
+	}
+}
+
+func TestGetSchemaSQL(t *testing.T) {
+	store := createStore(t)
+
+	statements, err := store.GetSchemaSQL("messages")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(statements) == 0 {
+		t.Fatal("expected CREATE statements for messages")
+	}
+	if !strings.HasPrefix(statements[0], "CREATE TABLE") {
+		t.Errorf("expected the table definition first, got %q", statements[0])
+	}
+	for _, stmt := range statements {
+		if strings.Contains(stmt, "messages_fts_data") {
+			t.Errorf("expected shadow tables to be hidden, got %q", stmt)
+		}
+	}
+
+	all, err := store.GetSchemaSQL("")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(all) <= len(statements) {
+		t.Errorf("expected the full schema to cover more than one table, got %d statements", len(all))
+	}
+
+	none, err := store.GetSchemaSQL("missing")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(none) != 0 {
+		t.Errorf("expected no statements for an unknown table, got %v", none)
+	}
+}
+
 func TestSuggestColumnNames(t *testing.T) {
 	store := createStore(t)
 
@@ -466,6 +838,54 @@ func TestSuggestColumnNames(t *testing.T) {
 	}
 }
 
+func TestReadsDoNotWaitForWriter(t *testing.T) {
+	store := createStore(t)
+
+	if err := store.UpsertSession(&Session{ID: "committed", CreatedAt: int64Ptr(1)}); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	// Hold an open write transaction on the writer connection.
+	batch, err := store.BeginBatch()
+	if err != nil {
+		t.Fatalf("failed to begin batch: %v", err)
+	}
+	defer batch.Rollback()
+	if _, err := batch.UpsertSession(&Session{ID: "pending", CreatedAt: int64Ptr(2)}); err != nil {
+		t.Fatalf("failed to upsert: %v", err)
+	}
+
+	done := make(chan []Session, 1)
+	go func() {
+		page, err := store.ListSessions(SessionFilter{})
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		done <- page.Sessions
+	}()
+
+	select {
+	case sessions := <-done:
+		if len(sessions) != 1 || sessions[0].ID != "committed" {
+			t.Errorf("expected only the committed session, got %v", sessionIDs(sessions))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read blocked on the open write transaction")
+	}
+
+	// A long-running read does not block writes either.
+	rows, err := store.ExecuteQuery(context.Background(), "SELECT id FROM sessions", 0)
+	if err != nil {
+		t.Fatalf("expected query to succeed during a write, got %v", err)
+	}
+	if len(rows.Rows) != 1 {
+		t.Errorf("expected 1 committed row, got %d", len(rows.Rows))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
 func createStore(t *testing.T) *Store {
 	t.Helper()
 
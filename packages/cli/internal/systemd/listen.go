@@ -0,0 +1,53 @@
+// Package systemd implements the parts of the systemd service protocol the
+// daemon uses: socket activation (sd_listen_fds), readiness and watchdog
+// notifications (sd_notify), and generating user units. Nothing here
+// links against libsystemd; the protocol is a handful of environment
+// variables and a datagram socket.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first inherited descriptor (SD_LISTEN_FDS_START).
+const listenFdsStart = 3
+
+// Listeners returns the sockets passed by systemd socket activation, or nil
+// if the process was not socket-activated. It unsets LISTEN_PID, LISTEN_FDS
+// and LISTEN_FDNAMES so child processes do not try to use them again.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		// FileListener duplicates the descriptor, so the original is
+		// closed either way.
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("inherited descriptor %d is not a listening socket: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
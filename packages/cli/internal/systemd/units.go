@@ -0,0 +1,101 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Unit file names written by 'clankers service install --user'.
+const (
+	SocketUnitName  = "clankers.socket"
+	ServiceUnitName = "clankers.service"
+)
+
+// UnitOptions describe the daemon the generated units start.
+type UnitOptions struct {
+	// Command is the daemon command line, starting with the executable.
+	Command []string
+	// SocketPath is where systemd listens on behalf of the daemon.
+	SocketPath string
+	// Environment holds KEY=value pairs for the service, in order.
+	Environment []string
+	// StopTimeout bounds how long systemd waits after SIGTERM.
+	StopTimeout time.Duration
+	// Watchdog is WatchdogSec=; zero disables it.
+	Watchdog time.Duration
+}
+
+// SocketUnit returns clankers.socket. Enabling it makes systemd listen on
+// the daemon socket at login and start clankers.service on the first
+// connection.
+func SocketUnit(opts UnitOptions) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Clankers daemon socket\n\n")
+	b.WriteString("[Socket]\n")
+	fmt.Fprintf(&b, "ListenStream=%s\n", escapeSpecifiers(opts.SocketPath))
+	b.WriteString("SocketMode=0600\n")
+	b.WriteString("RemoveOnStop=yes\n\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=sockets.target\n")
+	return b.String()
+}
+
+// ServiceUnit returns clankers.service. It has no [Install] section: it is
+// started through the socket.
+func ServiceUnit(opts UnitOptions) string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Clankers daemon\n")
+	fmt.Fprintf(&b, "Requires=%s\n", SocketUnitName)
+	fmt.Fprintf(&b, "After=%s\n\n", SocketUnitName)
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=notify\n")
+	args := make([]string, len(opts.Command))
+	for i, arg := range opts.Command {
+		args[i] = quote(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	for _, env := range opts.Environment {
+		fmt.Fprintf(&b, "Environment=%s\n", quote(env))
+	}
+	if opts.StopTimeout > 0 {
+		fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int(opts.StopTimeout.Round(time.Second)/time.Second))
+	}
+	if opts.Watchdog > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", int(opts.Watchdog.Round(time.Second)/time.Second))
+	}
+	b.WriteString("Restart=on-failure\n")
+	return b.String()
+}
+
+// UserUnitDir returns where systemd looks for the user's own units.
+func UserUnitDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+// escapeSpecifiers keeps systemd from expanding % in a literal value.
+func escapeSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// quote makes s one word on an ExecStart= or Environment= line.
+func quote(s string) string {
+	s = escapeSpecifiers(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;$") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,62 @@
+package systemd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServiceUnit(t *testing.T) {
+	unit := ServiceUnit(UnitOptions{
+		Command:     []string{"/opt/my tools/clankers", "daemon", "--log-level=debug"},
+		Environment: []string{"CLANKERS_DATA_PATH=/home/me/100%"},
+		StopTimeout: 20 * time.Second,
+		Watchdog:    30 * time.Second,
+	})
+
+	for _, want := range []string{
+		"Type=notify\n",
+		`ExecStart="/opt/my tools/clankers" daemon --log-level=debug` + "\n",
+		"Environment=CLANKERS_DATA_PATH=/home/me/100%%\n",
+		"TimeoutStopSec=20\n",
+		"WatchdogSec=30\n",
+		"Requires=clankers.socket\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("expected unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(unit, "[Install]") {
+		t.Error("expected the service to be started only through the socket")
+	}
+}
+
+func TestSocketUnit(t *testing.T) {
+	unit := SocketUnit(UnitOptions{SocketPath: "/run/user/1000/clankers.sock"})
+
+	for _, want := range []string{
+		"ListenStream=/run/user/1000/clankers.sock\n",
+		"SocketMode=0600\n",
+		"WantedBy=sockets.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("expected unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	cases := map[string]string{
+		"plain":      "plain",
+		"":           `""`,
+		"two words":  `"two words"`,
+		`say "hi"`:   `"say \"hi\""`,
+		`back\slash`: `"back\\slash"`,
+		"50%":        "50%%",
+	}
+	for in, want := range cases {
+		if got := quote(in); got != want {
+			t.Errorf("quote(%q): expected %s, got %s", in, want, got)
+		}
+	}
+}
@@ -37,6 +37,15 @@ export {
 	type ToolPayload,
 	type SessionErrorPayload,
 	type CompactionEventPayload,
+	type IngestItem,
+	type IngestItemResult,
+	type IngestBatchResult,
+	MAX_INGEST_BATCH_ITEMS,
+	SCHEMA_VERSION,
+	RPC_ERROR_INCOMPATIBLE_SCHEMA,
+	RPC_ERROR_SHUTTING_DOWN,
+	RPC_ERROR_UNAUTHORIZED,
+	type HandshakeResult,
 	type HealthResult,
 	type EnsureDbResult,
 	type GetDbPathResult,
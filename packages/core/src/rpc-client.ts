@@ -1,4 +1,5 @@
-import { createConnection } from "node:net";
+import { readFileSync } from "node:fs";
+import { createConnection, type NetConnectOpts } from "node:net";
 import { homedir } from "node:os";
 import { join } from "node:path";
 import type { LogEntry } from "./types.js";
@@ -6,6 +7,7 @@ import type { LogEntry } from "./types.js";
 const SOCKET_NAME = "dxta-clankers.sock";
 const CONTENT_LENGTH_HEADER = "Content-Length: ";
 const DATA_DIR_NAME = "clankers";
+const DISCOVERY_FILE = "daemon.json";
 
 interface RpcRequest {
 	jsonrpc: "2.0";
@@ -16,7 +18,8 @@ interface RpcRequest {
 
 interface RpcResponse<T = unknown> {
 	jsonrpc: "2.0";
-	id: string;
+	id?: string;
+	method?: string;
 	result?: T;
 	error?: {
 		code: number;
@@ -35,11 +38,29 @@ interface RequestEnvelope {
 	client: ClientInfo;
 }
 
+// Params shape this client sends. The daemon upgrades older supported
+// versions and rejects unknown ones with RPC_ERROR_INCOMPATIBLE_SCHEMA.
+export const SCHEMA_VERSION = "v1";
+
+export const RPC_ERROR_INCOMPATIBLE_SCHEMA = 4002;
+// Returned while the daemon drains before exiting. Nothing was written.
+export const RPC_ERROR_SHUTTING_DOWN = 4003;
+// Returned on the TCP listener when the request carries no valid token.
+export const RPC_ERROR_UNAUTHORIZED = 4004;
+
 export interface HealthResult {
 	ok: boolean;
 	version: string;
 }
 
+export interface HandshakeResult {
+	daemonVersion: string;
+	schemaVersion: string;
+	supportedSchemaVersions: string[];
+	methods: string[];
+	capabilities: string[];
+}
+
 export interface EnsureDbResult {
 	dbPath: string;
 	created: boolean;
@@ -71,6 +92,9 @@ export interface SessionPayload {
   createdAt?: number;
   updatedAt?: number;
   endedAt?: number;
+  // Monotonic per-session counter. Writes with a lower revision than the
+  // stored row do not overwrite tokens, cost or project fields.
+  revision?: number;
 }
 
 export interface MessagePayload {
@@ -85,6 +109,8 @@ export interface MessagePayload {
 	durationMs?: number;
 	createdAt?: number;
 	completedAt?: number;
+	// Monotonic per-message counter; lower revisions are ignored.
+	revision?: number;
 }
 
 export interface ToolPayload {
@@ -119,6 +145,32 @@ export interface CompactionEventPayload {
 	createdAt: number;
 }
 
+export type IngestItem =
+	| { kind: "session"; session: SessionPayload }
+	| { kind: "message"; message: MessagePayload }
+	| { kind: "tool"; tool: ToolPayload }
+	| { kind: "sessionError"; sessionError: SessionErrorPayload }
+	| { kind: "compactionEvent"; compactionEvent: CompactionEventPayload };
+
+export interface IngestItemResult {
+	ok: boolean;
+	change?: "inserted" | "updated" | "skipped" | "stale";
+	error?: {
+		code: number;
+		message: string;
+		data?: unknown;
+	};
+}
+
+export interface IngestBatchResult {
+	applied: number;
+	failed: number;
+	results: IngestItemResult[];
+}
+
+// Matches MaxIngestBatchItems in the daemon.
+export const MAX_INGEST_BATCH_ITEMS = 1000;
+
 function getSocketPath(): string {
 	if (process.env.CLANKERS_SOCKET_PATH) {
 		return process.env.CLANKERS_SOCKET_PATH;
@@ -129,6 +181,48 @@ function getSocketPath(): string {
 	return join(getDataDir(), SOCKET_NAME);
 }
 
+interface DaemonTarget {
+	connect: NetConnectOpts;
+	token?: string;
+}
+
+// CLANKERS_DAEMON_URL=tcp://host:port selects the daemon's TCP listener,
+// e.g. from a devcontainer. Its token comes from CLANKERS_DAEMON_TOKEN or
+// the discovery file the daemon writes to its data directory.
+function getDaemonTarget(): DaemonTarget {
+	const url = process.env.CLANKERS_DAEMON_URL;
+	if (!url) {
+		return { connect: { path: getSocketPath() } };
+	}
+
+	const parsed = new URL(url);
+	if (parsed.protocol !== "tcp:" || !parsed.port) {
+		throw new Error(`Invalid CLANKERS_DAEMON_URL ${url}: expected tcp://host:port`);
+	}
+	return {
+		connect: { host: parsed.hostname, port: Number(parsed.port) },
+		token: process.env.CLANKERS_DAEMON_TOKEN ?? readDiscoveryToken(),
+	};
+}
+
+function readDiscoveryToken(): string | undefined {
+	const path =
+		process.env.CLANKERS_DISCOVERY_PATH ?? join(getDataDir(), DISCOVERY_FILE);
+	try {
+		return JSON.parse(readFileSync(path, "utf8")).token;
+	} catch {
+		return undefined;
+	}
+}
+
+// The daemon strips the token before handling the request.
+function withToken(params: unknown, token: string | undefined): unknown {
+	if (!token) {
+		return params;
+	}
+	return { ...((params as object | undefined) ?? {}), token };
+}
+
 function getDataRoot(): string {
 	if (process.env.CLANKERS_DATA_PATH) {
 		return process.env.CLANKERS_DATA_PATH;
@@ -153,10 +247,9 @@ function nextRequestId(): string {
 }
 
 async function rpcCall<T>(method: string, params?: unknown): Promise<T> {
-	const socketPath = getSocketPath();
-
 	return new Promise((resolve, reject) => {
-		const socket = createConnection(socketPath);
+		const target = getDaemonTarget();
+		const socket = createConnection(target.connect);
 		let buffer = Buffer.alloc(0);
 		let expectedLength: number | null = null;
 
@@ -164,7 +257,7 @@ async function rpcCall<T>(method: string, params?: unknown): Promise<T> {
 			jsonrpc: "2.0",
 			id: nextRequestId(),
 			method,
-			params,
+			params: withToken(params, target.token),
 		};
 
 		socket.on("connect", () => {
@@ -204,6 +297,11 @@ async function rpcCall<T>(method: string, params?: unknown): Promise<T> {
 					try {
 						const response: RpcResponse<T> = JSON.parse(body);
 
+						// Notifications such as daemon.shutdown carry no id.
+						if (response.id === undefined) {
+							continue;
+						}
+
 						if (response.error) {
 							socket.end();
 							reject(
@@ -228,17 +326,17 @@ async function rpcCall<T>(method: string, params?: unknown): Promise<T> {
 			reject(new Error(`Socket error: ${err.message}`));
 		});
 
+		// A no-op once the promise has settled. Without it a call would hang
+		// when the daemon closes the connection during shutdown.
 		socket.on("close", () => {
-			if (expectedLength !== null) {
-				reject(new Error("Connection closed before response completed"));
-			}
+			reject(new Error("Connection closed before response completed"));
 		});
 	});
 }
 
 function createEnvelope(clientName: string, clientVersion: string): RequestEnvelope {
 	return {
-		schemaVersion: "v1",
+		schemaVersion: SCHEMA_VERSION,
 		client: { name: clientName, version: clientVersion },
 	};
 }
@@ -252,6 +350,12 @@ export function createRpcClient(options: RpcClientOptions) {
 	const envelope = createEnvelope(options.clientName, options.clientVersion);
 
 	return {
+		// Fails with RPC_ERROR_INCOMPATIBLE_SCHEMA when the daemon does not
+		// accept SCHEMA_VERSION.
+		async handshake(): Promise<HandshakeResult> {
+			return rpcCall<HandshakeResult>("handshake", envelope);
+		},
+
 		async health(): Promise<HealthResult> {
 			return rpcCall<HealthResult>("health");
 		},
@@ -299,6 +403,15 @@ export function createRpcClient(options: RpcClientOptions) {
 			});
 		},
 
+		// Applies the items in order in one daemon transaction. Invalid items
+		// are reported in results[i].error and do not fail the call.
+		async ingestBatch(items: IngestItem[]): Promise<IngestBatchResult> {
+			return rpcCall<IngestBatchResult>("ingestBatch", {
+				...envelope,
+				items,
+			});
+		},
+
 		async logWrite(entry: LogEntry): Promise<OkResult> {
 			return rpcCall<OkResult>("log.write", {
 				...envelope,
@@ -310,22 +423,30 @@ export function createRpcClient(options: RpcClientOptions) {
 		},
 
 		logWriteNotify(entry: LogEntry): void {
-			const socketPath = getSocketPath();
+			let target: DaemonTarget;
+			try {
+				target = getDaemonTarget();
+			} catch {
+				return;
+			}
 
 			const request = {
 				jsonrpc: "2.0",
 				id: `notify-${Date.now()}`,
 				method: "log.write",
-				params: {
-					...envelope,
-					entry: {
-						...entry,
-						timestamp: new Date().toISOString(),
+				params: withToken(
+					{
+						...envelope,
+						entry: {
+							...entry,
+							timestamp: new Date().toISOString(),
+						},
 					},
-				},
+					target.token,
+				),
 			};
 
-			const socket = createConnection(socketPath);
+			const socket = createConnection(target.connect);
 
 			socket.on("connect", () => {
 				const body = JSON.stringify(request);
@@ -81,6 +81,7 @@ export const SessionPayloadSchema = z.object({
   createdAt: z.number().optional(),
   updatedAt: z.number().optional(),
   endedAt: z.number().optional(),
+  revision: z.number().optional(),
 });
 
 export const MessagePayloadSchema = z.object({
@@ -95,6 +96,7 @@ export const MessagePayloadSchema = z.object({
 	durationMs: z.number().optional(),
 	createdAt: z.number().optional(),
 	completedAt: z.number().optional(),
+	revision: z.number().optional(),
 });
 
 export const ToolPayloadSchema = z.object({